@@ -0,0 +1,168 @@
+// Package analytics computes trends over lift history, to answer questions
+// like "did that cycle actually make me any stronger?"
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bcspragu/stronk"
+)
+
+// Period is how lifts are bucketed into a time series.
+type Period string
+
+const (
+	// Session groups lifts by day of the routine.
+	Session = Period("SESSION")
+	// Week groups lifts by week of the routine.
+	Week = Period("WEEK")
+	// Iteration groups lifts by full run through the routine.
+	Iteration = Period("ITERATION")
+)
+
+// DefaultWindow is the number of points in a rolling average if none is given.
+const DefaultWindow = 3
+
+var ErrInvalidPeriod = errors.New("period must be one of SESSION, WEEK, or ITERATION")
+
+// ParsePeriod converts a user-provided period, defaulting to Session if empty.
+func ParsePeriod(in string) (Period, error) {
+	switch p := Period(in); p {
+	case "":
+		return Session, nil
+	case Session, Week, Iteration:
+		return p, nil
+	default:
+		return "", fmt.Errorf("%w, was %q", ErrInvalidPeriod, in)
+	}
+}
+
+// Point is the best estimated one rep max for a single period.
+type Point struct {
+	// Week and Day are only set if they're part of the period, e.g. Day is
+	// always zero for weekly points.
+	IterationNumber int
+	WeekNumber      int
+	DayNumber       int
+
+	// LiftID is the lift that had the best estimated one rep max, and Date is
+	// when it was done.
+	LiftID    stronk.LiftID
+	Date      time.Time
+	OneRepMax stronk.Weight
+	// RollingAverage is the average one rep max over this point and up to
+	// Window-1 points before it.
+	RollingAverage stronk.Weight
+}
+
+// Trend is a time series of estimated one rep maxes for an exercise.
+type Trend struct {
+	Exercise stronk.Exercise
+	Period   Period
+	Window   int
+	Points   []*Point
+	// SlopePerPeriod is how much the estimated one rep max changes each period,
+	// according to a least squares fit, in the unit of the lifts. It's zero if
+	// there are fewer than two points.
+	SlopePerPeriod float64
+}
+
+type periodKey struct {
+	iter, week, day int
+}
+
+// OneRepMaxTrend computes a trend of the best estimated one rep max per period
+// for the given exercise. Warmup sets are ignored.
+func OneRepMaxTrend(ex stronk.Exercise, lifts []*stronk.Lift, period Period, window int) *Trend {
+	if window < 1 {
+		window = DefaultWindow
+	}
+
+	best := make(map[periodKey]*stronk.Lift)
+	for _, l := range lifts {
+		if l.Exercise != ex || l.SetType == stronk.Warmup || l.Reps < 1 {
+			continue
+		}
+		key := periodKey{iter: l.IterationNumber}
+		switch period {
+		case Session:
+			key.week, key.day = l.WeekNumber, l.DayNumber
+		case Week:
+			key.week = l.WeekNumber
+		}
+		if cur, ok := best[key]; !ok || l.AsRPEOneRepMax().Value > cur.AsRPEOneRepMax().Value {
+			best[key] = l
+		}
+	}
+
+	var keys []periodKey
+	for k := range best {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b periodKey) int {
+		if a.iter != b.iter {
+			return a.iter - b.iter
+		}
+		if a.week != b.week {
+			return a.week - b.week
+		}
+		return a.day - b.day
+	})
+
+	trend := &Trend{
+		Exercise: ex,
+		Period:   period,
+		Window:   window,
+		Points:   []*Point{},
+	}
+	var ys []float64
+	for i, k := range keys {
+		l := best[k]
+		orm := l.AsRPEOneRepMax()
+		ys = append(ys, float64(orm.Value))
+
+		start := max(0, i-window+1)
+		var sum float64
+		for _, y := range ys[start:] {
+			sum += y
+		}
+
+		trend.Points = append(trend.Points, &Point{
+			IterationNumber: k.iter,
+			WeekNumber:      k.week,
+			DayNumber:       k.day,
+			LiftID:          l.ID,
+			Date:            l.CreatedAt,
+			OneRepMax:       orm,
+			RollingAverage: stronk.Weight{
+				Value: int(sum / float64(len(ys[start:]))),
+				Unit:  orm.Unit,
+			},
+		})
+	}
+	trend.SlopePerPeriod = slope(ys)
+
+	return trend
+}
+
+// slope returns the slope of the least squares line through the points (i,
+// ys[i]).
+func slope(ys []float64) float64 {
+	n := float64(len(ys))
+	if n < 2 {
+		return 0
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range ys {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
@@ -0,0 +1,105 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bcspragu/stronk"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOneRepMaxTrend(t *testing.T) {
+	wt := func(v int) stronk.Weight { return stronk.Weight{Value: v, Unit: stronk.DeciPounds} }
+	// Singles, so the estimated one rep max is easy to work out.
+	single := func(id stronk.LiftID, iter, week, day, weight int) *stronk.Lift {
+		return &stronk.Lift{
+			ID:              id,
+			Exercise:        stronk.Squat,
+			SetType:         stronk.Main,
+			Weight:          wt(weight),
+			Reps:            1,
+			DayNumber:       day,
+			WeekNumber:      week,
+			IterationNumber: iter,
+		}
+	}
+
+	lifts := []*stronk.Lift{
+		single(1, 0, 0, 0, 1000),
+		single(2, 0, 0, 0, 1200),
+		single(3, 0, 1, 0, 1100),
+		single(4, 1, 0, 0, 1400),
+		// Should be ignored.
+		{ID: 5, Exercise: stronk.Squat, SetType: stronk.Warmup, Weight: wt(5000), Reps: 1},
+		{ID: 6, Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: wt(5000), Reps: 1},
+	}
+
+	orm := func(v int) stronk.Weight {
+		return (&stronk.Lift{Weight: wt(v), Reps: 1}).AsRPEOneRepMax()
+	}
+
+	tests := []struct {
+		period    Period
+		wantIDs   []stronk.LiftID
+		wantAvgs  []stronk.Weight
+		wantSlope float64
+	}{
+		{
+			period:   Session,
+			wantIDs:  []stronk.LiftID{2, 3, 4},
+			wantAvgs: []stronk.Weight{orm(1200), wt((orm(1200).Value + orm(1100).Value) / 2), wt((orm(1100).Value + orm(1400).Value) / 2)},
+			// Points are 1239, 1136, and 1446
+			wantSlope: 103.5,
+		},
+		{
+			period:    Iteration,
+			wantIDs:   []stronk.LiftID{2, 4},
+			wantAvgs:  []stronk.Weight{orm(1200), wt((orm(1200).Value + orm(1400).Value) / 2)},
+			wantSlope: float64(orm(1400).Value - orm(1200).Value),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.period), func(t *testing.T) {
+			got := OneRepMaxTrend(stronk.Squat, lifts, test.period, 2)
+
+			var gotIDs []stronk.LiftID
+			var gotAvgs []stronk.Weight
+			for _, p := range got.Points {
+				gotIDs = append(gotIDs, p.LiftID)
+				gotAvgs = append(gotAvgs, p.RollingAverage)
+			}
+			if diff := cmp.Diff(test.wantIDs, gotIDs); diff != "" {
+				t.Errorf("unexpected best lifts (-want +got)\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantAvgs, gotAvgs); diff != "" {
+				t.Errorf("unexpected rolling averages (-want +got)\n%s", diff)
+			}
+			if math.Abs(got.SlopePerPeriod-test.wantSlope) > 0.01 {
+				t.Errorf("slope = %g, want %g", got.SlopePerPeriod, test.wantSlope)
+			}
+		})
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Period
+		wantErr bool
+	}{
+		{in: "", want: Session},
+		{in: "WEEK", want: Week},
+		{in: "week", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParsePeriod(test.in)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ParsePeriod(%q) error = %v, want error %t", test.in, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("ParsePeriod(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
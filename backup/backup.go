@@ -0,0 +1,179 @@
+// Package backup writes periodic snapshots of the database to a local
+// directory, keeping only the most recent ones.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "stronk-"
+	fileSuffix = ".db"
+	timeFormat = "20060102T150405Z"
+)
+
+// Source is anything that can write a consistent snapshot of itself to a file,
+// like *sqldb.DB.
+type Source interface {
+	Backup(destPath string) error
+}
+
+type Snapshot struct {
+	Name      string
+	CreatedAt time.Time
+	SizeBytes int64
+}
+
+type Manager struct {
+	src Source
+	dir string
+	// keep is the number of snapshots to retain, zero or less keeps them all.
+	keep int
+	now  func() time.Time
+
+	mu sync.Mutex
+}
+
+// New returns a Manager that writes snapshots of src to dir, keeping the keep
+// most recent ones.
+func New(src Source, dir string, keep int) *Manager {
+	return &Manager{
+		src:  src,
+		dir:  dir,
+		keep: keep,
+		now:  time.Now,
+	}
+}
+
+// Snapshot writes a new snapshot to the backup directory, then removes any
+// snapshots beyond the retention limit.
+func (m *Manager) Snapshot() (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup dir: %w", err)
+	}
+
+	createdAt := m.now().UTC().Truncate(time.Second)
+	name := filePrefix + createdAt.Format(timeFormat) + fileSuffix
+	path := filepath.Join(m.dir, name)
+
+	// Write to a temp file first so that a failed backup never leaves a partial
+	// snapshot that looks valid.
+	tmpPath := path + ".tmp"
+	if err := m.src.Backup(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	if err := m.prune(); err != nil {
+		return nil, fmt.Errorf("failed to prune old snapshots: %w", err)
+	}
+
+	return &Snapshot{
+		Name:      name,
+		CreatedAt: createdAt,
+		SizeBytes: fi.Size(),
+	}, nil
+}
+
+// Snapshots returns the snapshots in the backup directory, newest first.
+func (m *Manager) Snapshots() ([]*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshots()
+}
+
+// Run takes a snapshot every interval until done is closed. Failures are
+// logged, and don't stop future snapshots.
+func (m *Manager) Run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			snap, err := m.Snapshot()
+			if err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("Wrote scheduled backup %q (%d bytes)", snap.Name, snap.SizeBytes)
+		}
+	}
+}
+
+func (m *Manager) snapshots() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup dir: %w", err)
+	}
+
+	var snaps []*Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(timeFormat, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+		if err != nil {
+			// Not one of ours.
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat snapshot %q: %w", name, err)
+		}
+		snaps = append(snaps, &Snapshot{
+			Name:      name,
+			CreatedAt: createdAt,
+			SizeBytes: fi.Size(),
+		})
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.After(snaps[j].CreatedAt)
+	})
+	return snaps, nil
+}
+
+func (m *Manager) prune() error {
+	if m.keep <= 0 {
+		return nil
+	}
+	snaps, err := m.snapshots()
+	if err != nil {
+		return err
+	}
+	if len(snaps) <= m.keep {
+		return nil
+	}
+	for _, s := range snaps[m.keep:] {
+		if err := os.Remove(filepath.Join(m.dir, s.Name)); err != nil {
+			return fmt.Errorf("failed to remove snapshot %q: %w", s.Name, err)
+		}
+	}
+	return nil
+}
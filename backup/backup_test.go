@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeSource struct {
+	err error
+}
+
+func (f *fakeSource) Backup(destPath string) error {
+	if f.err != nil {
+		return f.err
+	}
+	return os.WriteFile(destPath, []byte("snapshot"), 0o644)
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	src := &fakeSource{}
+	m := New(src, filepath.Join(dir, "backups"), 2)
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var names []string
+	for i := 0; i < 3; i++ {
+		m.now = func() time.Time { return start.Add(time.Duration(i) * time.Hour) }
+		snap, err := m.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		names = append(names, snap.Name)
+	}
+
+	snaps, err := m.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	want := []*Snapshot{
+		{Name: "stronk-20261018T140000Z.db", CreatedAt: start.Add(2 * time.Hour), SizeBytes: 8},
+		{Name: "stronk-20261018T130000Z.db", CreatedAt: start.Add(time.Hour), SizeBytes: 8},
+	}
+	if diff := cmp.Diff(want, snaps); diff != "" {
+		t.Errorf("unexpected snapshots (-want +got)\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backups", names[0])); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("oldest snapshot wasn't pruned, stat returned %v", err)
+	}
+
+	// A failed backup shouldn't leave anything behind.
+	src.err = errors.New("disk full")
+	m.now = func() time.Time { return start.Add(3 * time.Hour) }
+	if _, err := m.Snapshot(); err == nil {
+		t.Fatal("Snapshot succeeded, want an error")
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if n := len(entries); n != 2 {
+		t.Errorf("got %d files in backup dir after failed snapshot, want 2", n)
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/backup"
+	"github.com/bcspragu/stronk/db/pgdb"
 	"github.com/bcspragu/stronk/db/sqldb"
 	"github.com/bcspragu/stronk/server"
 	"github.com/namsral/flag"
@@ -26,9 +30,15 @@ func run() error {
 		routineFile = flag.String("routine_file", "routine.json", "Path to the JSON file containing a routine")
 
 		dbFile       = flag.String("db_file", "stronk.db", "Path to the SQLite database")
-		migrationDir = flag.String("migration_dir", "db/sqldb/migrations", "Path to the directory containing our migration set files")
+		dbDSN        = flag.String("db_dsn", "", "Postgres connection string (URL or key=value), uses Postgres instead of SQLite if set")
+		migrationDir = flag.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones, for development")
 
-		addr = flag.String("addr", ":8080", "The address to run the HTTP server on")
+		backupDir      = flag.String("backup_dir", "", "Directory to write database snapshots to, backups are disabled if empty")
+		backupInterval = flag.Duration("backup_interval", 24*time.Hour, "How often to take a scheduled snapshot")
+		backupKeep     = flag.Int("backup_keep", 7, "How many snapshots to retain, zero or less retains all of them")
+
+		addr           = flag.String("addr", ":8080", "The address to run the HTTP server on")
+		requestTimeout = flag.Duration("request_timeout", 30*time.Second, "How long a request can run before it's abandoned, zero means no limit")
 	)
 	flag.Parse()
 
@@ -37,13 +47,39 @@ func run() error {
 		return fmt.Errorf("failed to load users file: %v", err)
 	}
 
-	db, err := sqldb.New(*dbFile, *migrationDir)
-	if err != nil {
-		return fmt.Errorf("failed to load SQLite db: %v", err)
+	var (
+		db  database
+		src backup.Source
+	)
+	if *dbDSN != "" {
+		if *backupDir != "" {
+			return errors.New("--backup_dir only works with SQLite, use pg_dump to back up Postgres")
+		}
+		pdb, err := pgdb.New(*dbDSN, *migrationDir)
+		if err != nil {
+			return fmt.Errorf("failed to load Postgres db: %v", err)
+		}
+		db = pdb
+	} else {
+		sdb, err := sqldb.New(*dbFile, *migrationDir)
+		if err != nil {
+			return fmt.Errorf("failed to load SQLite db: %v", err)
+		}
+		db, src = sdb, sdb
 	}
 	defer db.Close()
 
 	srv := server.New(routine, db)
+	srv.SetRequestTimeout(*requestTimeout)
+
+	if *backupDir != "" {
+		backups := backup.New(src, *backupDir, *backupKeep)
+		srv.SetBackups(backups)
+
+		done := make(chan struct{})
+		defer close(done)
+		go backups.Run(*backupInterval, done)
+	}
 
 	errChan := make(chan error)
 	go func() {
@@ -57,12 +93,27 @@ func run() error {
 
 	go func() {
 		log.Printf("Starting server on %q", *addr)
-		errChan <- http.ListenAndServe(*addr, cors.Default().Handler(srv))
+		errChan <- http.ListenAndServe(*addr, corsHandler(srv))
 	}()
 
 	return <-errChan
 }
 
+// corsHandler is cors.Default, plus the Idempotency-Key header the frontend
+// sends when recording lifts, and the Last-Event-ID header browsers send when
+// reconnecting to the event stream.
+func corsHandler(h http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodHead},
+		AllowedHeaders: []string{"Accept", "Content-Type", "X-Requested-With", "Idempotency-Key", "Last-Event-ID"},
+	}).Handler(h)
+}
+
+type database interface {
+	server.DB
+	Close() error
+}
+
 func loadRoutine(usersFile string) (*stronk.Routine, error) {
 	f, err := os.Open(usersFile)
 	if err != nil {
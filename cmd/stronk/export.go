@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/db/sqldb"
+	"github.com/bcspragu/stronk/export"
+	"github.com/namsral/flag"
+)
+
+const exportUsage = `usage: stronk export [flags]
+
+Writes all lifts, training maxes, smallest denominations, skipped weeks and the
+active routine as a JSON document.
+
+Flags:
+`
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, exportUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		dbFile       = fs.String("db_file", "stronk.db", "Path to the SQLite database")
+		migrationDir = fs.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones")
+		routineFile  = fs.String("routine_file", "routine.json", "Path to the JSON file containing the active routine")
+		out          = fs.String("out", "", "File to write the export to, defaults to stdout")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	routine, err := loadRoutine(*routineFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := sqldb.New(*dbFile, *migrationDir)
+	if err != nil {
+		return fmt.Errorf("failed to load SQLite db: %w", err)
+	}
+	defer db.Close()
+
+	doc, err := export.Export(context.Background(), db, routine, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+const importUsage = `usage: stronk import [flags] FILE
+
+Imports a JSON document written by 'stronk export' or /api/export. Records that
+already exist are skipped, so importing the same file twice is safe.
+
+Flags:
+`
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, importUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		dbFile       = fs.String("db_file", "stronk.db", "Path to the SQLite database")
+		migrationDir = fs.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones")
+		routineFile  = fs.String("routine_file", "routine.json", "Path to the JSON file containing the active routine, which the import is validated against")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one file to import")
+	}
+
+	routine, err := loadRoutine(*routineFile)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open export: %w", err)
+	}
+	defer f.Close()
+
+	doc, err := export.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	db, err := sqldb.New(*dbFile, *migrationDir)
+	if err != nil {
+		return fmt.Errorf("failed to load SQLite db: %w", err)
+	}
+	defer db.Close()
+
+	res, err := export.Import(context.Background(), db, doc, routine)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d lifts, %d training maxes, %d smallest denominations and %d skipped weeks, skipped %d duplicates\n",
+		res.Lifts, res.TrainingMaxes, res.SmallestDenoms, res.SkippedWeeks, res.Duplicates)
+	return nil
+}
+
+func loadRoutine(routineFile string) (*stronk.Routine, error) {
+	f, err := os.Open(routineFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open routine file: %w", err)
+	}
+	defer f.Close()
+
+	var routine *stronk.Routine
+	if err := json.NewDecoder(f).Decode(&routine); err != nil {
+		return nil, fmt.Errorf("failed to parse routine file as JSON: %w", err)
+	}
+	return routine, nil
+}
+
+const exportLiftsUsage = `usage: stronk export-lifts [flags]
+
+Writes every lift as CSV, for analysis in spreadsheets and the like.
+
+Flags:
+`
+
+func runExportLifts(args []string) error {
+	fs := flag.NewFlagSet("export-lifts", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, exportLiftsUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		dbFile       = fs.String("db_file", "stronk.db", "Path to the SQLite database")
+		migrationDir = fs.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones")
+		routineFile  = fs.String("routine_file", "routine.json", "Path to the JSON file containing the active routine, used for week and day names")
+		unitStr      = fs.String("unit", "LB", "Unit to write weights in, LB or KG")
+		exercise     = fs.String("exercise", "", "Only export lifts of this exercise, e.g. SQUAT")
+		setType      = fs.String("set_type", "", "Only export lifts of this set type, e.g. MAIN")
+		out          = fs.String("out", "", "File to write the CSV to, defaults to stdout")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	unit, err := export.ParseUnit(*unitStr)
+	if err != nil {
+		return err
+	}
+
+	routine, err := loadRoutine(*routineFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := sqldb.New(*dbFile, *migrationDir)
+	if err != nil {
+		return fmt.Errorf("failed to load SQLite db: %w", err)
+	}
+	defer db.Close()
+
+	lifts, err := db.LiftHistory(context.Background(), stronk.LiftFilter{
+		Exercise: stronk.Exercise(*exercise),
+		SetType:  stronk.SetType(*setType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load lifts: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return export.WriteLiftsCSV(w, lifts, routine, unit)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bcspragu/stronk/db/sqldb"
+	"github.com/bcspragu/stronk/export"
+	"github.com/bcspragu/stronk/importer"
+	"github.com/namsral/flag"
+)
+
+const importHistoryUsage = `usage: stronk import-history [flags] FILE
+
+Imports sets from a Strong, Hevy or FitNotes CSV export as historical lifts,
+which count towards records and comparables but not towards progress through
+the routine. Exercises are matched by name using a built-in mapping for the
+main lifts, which can be extended with -mapping, a JSON file like:
+
+  {"Front Squat (Barbell)": "FRONT_SQUAT", "Squat (Barbell)": "SQUAT"}
+
+Sets of unmapped exercises are skipped. Importing the same file twice is safe.
+
+Flags:
+`
+
+func runImportHistory(args []string) error {
+	fs := flag.NewFlagSet("import-history", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, importHistoryUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		dbFile       = fs.String("db_file", "stronk.db", "Path to the SQLite database")
+		migrationDir = fs.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones")
+		formatStr    = fs.String("format", "", "Format of the export, one of STRONG, HEVY or FITNOTES")
+		mappingFile  = fs.String("mapping", "", "Path to a JSON file mapping exercise names in the export to stronk exercises")
+		unitStr      = fs.String("unit", "LB", "Unit of weights in the export, LB or KG, for formats that don't specify it")
+		tz           = fs.String("tz", "UTC", "Time zone of timestamps in the export, e.g. America/New_York")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one file to import")
+	}
+
+	format, err := importer.ParseFormat(*formatStr)
+	if err != nil {
+		return err
+	}
+	unit, err := export.ParseUnit(*unitStr)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return fmt.Errorf("invalid time zone: %w", err)
+	}
+
+	mapping := importer.DefaultMapping()
+	if *mappingFile != "" {
+		f, err := os.Open(*mappingFile)
+		if err != nil {
+			return fmt.Errorf("failed to open mapping file: %w", err)
+		}
+		defer f.Close()
+		custom, err := importer.LoadMapping(f)
+		if err != nil {
+			return err
+		}
+		for name, ex := range custom {
+			mapping[name] = ex
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open export: %w", err)
+	}
+	defer f.Close()
+
+	db, err := sqldb.New(*dbFile, *migrationDir)
+	if err != nil {
+		return fmt.Errorf("failed to load SQLite db: %w", err)
+	}
+	defer db.Close()
+
+	res, imported, err := importer.Import(context.Background(), db, f, importer.Options{
+		Format:   format,
+		Mapping:  mapping,
+		Unit:     unit,
+		Location: loc,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d of %d sets, skipped %d duplicates\n", imported.Lifts, len(res.Lifts), imported.Duplicates)
+	if len(res.Unmapped) > 0 {
+		names := make([]string, 0, len(res.Unmapped))
+		for name := range res.Unmapped {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return res.Unmapped[names[i]] > res.Unmapped[names[j]] })
+		fmt.Println("Skipped sets of unmapped exercises:")
+		for _, name := range names {
+			fmt.Printf("  %q: %d sets\n", name, res.Unmapped[name])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Command stronk contains administrative tooling for a stronk deployment, like
+// managing database migrations and restoring backups.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: stronk <command> [flags] [args]
+
+Commands:
+  migrate         Inspect and manage the database schema version
+  export          Export all user data as JSON
+  export-lifts    Export lift history as CSV
+  import          Import user data from a JSON export
+  import-history  Import lifts from Strong, Hevy or FitNotes
+  restore         Replace the database with a backup snapshot
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("no command given")
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "migrate":
+		return runMigrate(args)
+	case "export":
+		return runExport(args)
+	case "export-lifts":
+		return runExportLifts(args)
+	case "import":
+		return runImport(args)
+	case "import-history":
+		return runImportHistory(args)
+	case "restore":
+		return runRestore(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
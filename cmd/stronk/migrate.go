@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/bcspragu/stronk/db/sqldb"
+	"github.com/namsral/flag"
+)
+
+const migrateUsage = `usage: stronk migrate [flags] <subcommand>
+
+Subcommands:
+  status         Show the current schema version and any pending migrations
+  up             Apply all pending migrations
+  down N         Roll back the N most recently applied migrations
+  goto VERSION   Migrate up or down to VERSION
+  force VERSION  Set the schema version and clear the dirty flag without
+                 running any migrations, use 0 for "no migrations applied"
+
+Flags:
+`
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		dbFile       = fs.String("db_file", "stronk.db", "Path to the SQLite database")
+		migrationDir = fs.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones")
+		dryRun       = fs.Bool("dry_run", false, "Print the SQL of the migrations that would run, without running them")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no migrate subcommand given")
+	}
+
+	m, err := sqldb.NewMigrator(*dbFile, *migrationDir)
+	if err != nil {
+		return fmt.Errorf("failed to load migrator: %w", err)
+	}
+	defer m.Close()
+
+	sub, subArgs := fs.Arg(0), fs.Args()[1:]
+	argCount := map[string]int{"status": 0, "up": 0, "down": 1, "goto": 1, "force": 1}
+	n, ok := argCount[sub]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown migrate subcommand %q", sub)
+	}
+	if len(subArgs) != n {
+		return fmt.Errorf("%q takes %d argument(s), got %d", sub, n, len(subArgs))
+	}
+
+	var num uint64
+	if n == 1 {
+		if num, err = strconv.ParseUint(subArgs[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid argument %q: %w", subArgs[0], err)
+		}
+	}
+
+	switch sub {
+	case "status":
+		return printStatus(m)
+	case "up":
+		if *dryRun {
+			return printPlan(m.PlanUp())
+		}
+		if err := m.Up(); err != nil {
+			return err
+		}
+	case "down":
+		if *dryRun {
+			return printPlan(m.PlanDown(int(num)))
+		}
+		if err := m.Down(int(num)); err != nil {
+			return err
+		}
+	case "goto":
+		if *dryRun {
+			return printPlan(m.PlanGoto(uint(num)))
+		}
+		if err := m.Goto(uint(num)); err != nil {
+			return err
+		}
+	case "force":
+		if *dryRun {
+			fmt.Printf("Would force version %d, no migrations would run\n", num)
+			return nil
+		}
+		if err := m.Force(uint(num)); err != nil {
+			return err
+		}
+	}
+
+	return printStatus(m)
+}
+
+func printStatus(m *sqldb.Migrator) error {
+	status, err := m.Status()
+	if err != nil {
+		return fmt.Errorf("failed to load migration status: %w", err)
+	}
+
+	dirty := ""
+	if status.Dirty {
+		dirty = " (dirty)"
+	}
+	fmt.Printf("Current version: %d%s\n", status.Version, dirty)
+	fmt.Printf("Latest version:  %d\n", status.Latest)
+	if len(status.Pending) == 0 {
+		fmt.Println("No pending migrations")
+		return nil
+	}
+	fmt.Printf("%d pending migration(s):\n", len(status.Pending))
+	for _, v := range status.Pending {
+		fmt.Printf("  %d\n", v)
+	}
+	return nil
+}
+
+func printPlan(steps []*sqldb.MigrationStep, err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to plan migrations: %w", err)
+	}
+	if len(steps) == 0 {
+		fmt.Println("No migrations would run")
+		return nil
+	}
+	for _, s := range steps {
+		dir := "down"
+		if s.Up {
+			dir = "up"
+		}
+		fmt.Printf("-- %d_%s.%s.sql\n%s\n", s.Version, s.Identifier, dir, s.SQL)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bcspragu/stronk/db/sqldb"
+	"github.com/namsral/flag"
+)
+
+const restoreUsage = `usage: stronk restore [flags] SNAPSHOT
+
+Replaces the database with the given snapshot, after checking that the
+snapshot's schema version is one this release knows about. Stop the server
+before restoring, the database is locked while it's replaced so restoring
+fails if the server still has it open.
+
+Flags:
+`
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, restoreUsage)
+		fs.PrintDefaults()
+	}
+	var (
+		dbFile       = fs.String("db_file", "stronk.db", "Path to the SQLite database to restore into")
+		migrationDir = fs.String("migration_dir", "", "Path to a directory of migration set files to use instead of the embedded ones")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one snapshot to restore")
+	}
+
+	version, err := sqldb.Restore(fs.Arg(0), *dbFile, *migrationDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %q to %q at schema version %d\n", fs.Arg(0), *dbFile, version)
+	return nil
+}
@@ -0,0 +1,56 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	migratepostgres "github.com/golang-migrate/migrate/v4/database/postgres"
+)
+
+func newMigrate(conn *sql.Conn, migrationsPath string) (*migrate.Migrate, error) {
+	driver, err := migratepostgres.WithConnection(context.Background(), conn, &migratepostgres.Config{
+		MigrationsTable: migratepostgres.DefaultMigrationsTable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init go-migrate driver: %w", err)
+	}
+
+	src, err := migrationSource(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("migrations", src, "postgres", driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return m, nil
+}
+
+func migrationSource(migrationsPath string) (source.Driver, error) {
+	if migrationsPath == "" {
+		src, err := iofs.New(migrations, "migrations")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load embedded migrations: %w", err)
+		}
+		return src, nil
+	}
+
+	rootedMigrationsPath, err := filepath.Abs(migrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a rooted migrations file path: %w", err)
+	}
+
+	src, err := (&file.File{}).Open("file://" + rootedMigrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations from %q: %w", migrationsPath, err)
+	}
+	return src, nil
+}
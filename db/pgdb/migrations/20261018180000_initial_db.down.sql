@@ -0,0 +1,6 @@
+DROP TABLE achievements;
+DROP TABLE skipped_weeks;
+DROP TABLE smallest_denom;
+DROP TABLE training_maxes;
+DROP TABLE lifts;
+DROP TABLE exercises;
@@ -0,0 +1,62 @@
+CREATE TABLE exercises (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE lifts (
+  id BIGSERIAL PRIMARY KEY,
+  exercise_id BIGINT NOT NULL REFERENCES exercises (id),
+  set_type TEXT NOT NULL CHECK( set_type IN ('WARMUP', 'MAIN', 'ASSISTANCE') ),
+  set_number INTEGER NOT NULL,
+  reps INTEGER NOT NULL,
+  weight_value INTEGER NOT NULL,
+  weight_unit TEXT NOT NULL,
+  day_number INTEGER NOT NULL,
+  week_number INTEGER NOT NULL,
+  iteration_number INTEGER NOT NULL,
+  lift_note TEXT,
+  to_failure BOOLEAN NOT NULL DEFAULT FALSE,
+  extra_set TEXT CHECK( extra_set IN ('JOKER', 'FIRST_SET_LAST') ),
+  rpe DOUBLE PRECISION,
+  reps_in_reserve INTEGER,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', now())
+);
+
+CREATE INDEX lifts_exercise_weight ON lifts (exercise_id, weight_unit, weight_value);
+
+CREATE TABLE training_maxes (
+  id BIGSERIAL PRIMARY KEY,
+  exercise_id BIGINT NOT NULL REFERENCES exercises (id),
+  training_max_value INTEGER NOT NULL,
+  training_max_unit TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', now())
+);
+
+CREATE TABLE smallest_denom (
+  id BIGSERIAL PRIMARY KEY,
+  smallest_denom_value INTEGER NOT NULL,
+  smallest_denom_unit TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', now())
+);
+
+CREATE TABLE skipped_weeks (
+  id BIGSERIAL PRIMARY KEY,
+  week_number INTEGER NOT NULL,
+  iteration_number INTEGER NOT NULL,
+  note TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', now())
+);
+
+CREATE TABLE achievements (
+  id BIGSERIAL PRIMARY KEY,
+  achievement_type TEXT NOT NULL CHECK( achievement_type IN ('ONE_REP_MAX_PR', 'REP_PR', 'WEIGHT_PR') ),
+  lift_id BIGINT NOT NULL REFERENCES lifts (id),
+  weight_value INTEGER NOT NULL,
+  weight_unit TEXT NOT NULL,
+  reps INTEGER NOT NULL,
+  previous_lift_id BIGINT NOT NULL REFERENCES lifts (id),
+  previous_weight_value INTEGER NOT NULL,
+  previous_weight_unit TEXT NOT NULL,
+  previous_reps INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', now())
+);
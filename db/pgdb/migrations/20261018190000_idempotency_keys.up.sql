@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+  idempotency_key TEXT PRIMARY KEY,
+  request_path TEXT NOT NULL,
+  request_hash TEXT NOT NULL,
+  response_status INTEGER NOT NULL,
+  response_body BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', now())
+);
+
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,1184 @@
+// Package pgdb implements the server.DB interface, backed by a PostgreSQL
+// database.
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/lib/pq"
+)
+
+// DB is safe for concurrent use. Unlike sqldb, there's no process-wide lock,
+// each method runs in its own transaction and Postgres handles the rest.
+type DB struct {
+	sql         *sql.DB
+	mainLiftIDs map[stronk.Exercise]int
+}
+
+func (db *DB) Close() error {
+	return db.sql.Close()
+}
+
+// liftColumns are the columns scanned by lifts, in order.
+const liftColumns = `lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at`
+
+func (db *DB) EditLift(ctx context.Context, id stronk.LiftID, note string, reps int, rpe float64, rir *int) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+UPDATE lifts
+	SET reps = $1, lift_note = $2, rpe = $3, reps_in_reserve = $4
+WHERE id = $5
+`
+		res, err := tx.ExecContext(ctx, q, reps, note, nullFloat(rpe), nullInt(rir), id)
+		if err != nil {
+			return fmt.Errorf("failed to update lift: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check updated rows: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("lift %d not found", id)
+		}
+		return nil
+	})
+}
+
+func (db *DB) Lift(ctx context.Context, id stronk.LiftID) (*stronk.Lift, error) {
+	var lift *stronk.Lift
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT ` + liftColumns + `
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+WHERE lifts.id = $1`
+
+		rows, err := tx.QueryContext(ctx, q, id)
+		if err != nil {
+			return fmt.Errorf("failed to query lift: %w", err)
+		}
+		lfs, err := lifts(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan lift: %w", err)
+		}
+		if n := len(lfs); n != 1 {
+			return fmt.Errorf("unexpected number of lifts %d", n)
+		}
+		lift = lfs[0]
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lift: %w", err)
+	}
+	return lift, nil
+}
+
+func (db *DB) RecordLift(ctx context.Context, ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool, extra stronk.ExtraSet, rpe float64, rir *int) (stronk.LiftID, error) {
+	l := &stronk.Lift{
+		Exercise:        ex,
+		SetType:         st,
+		Weight:          weight,
+		SetNumber:       set,
+		Reps:            reps,
+		Note:            note,
+		DayNumber:       day,
+		WeekNumber:      week,
+		IterationNumber: iter,
+		ToFailure:       toFailure,
+		Extra:           extra,
+		RPE:             rpe,
+		RIR:             rir,
+	}
+	var id stronk.LiftID
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		id, err = insertLift(ctx, tx, l)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (db *DB) RecordNextLift(ctx context.Context, l *stronk.Lift, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error, achieve func(stronk.LiftID, []*stronk.Lift) []*stronk.Achievement) (stronk.LiftID, *stronk.WorkoutContext, error) {
+	var (
+		id stronk.LiftID
+		wc *stronk.WorkoutContext
+	)
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		// Nothing else can record a lift or skip a week until we're done, but
+		// reads can carry on.
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE lifts, skipped_weeks IN EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("failed to lock lifts: %w", err)
+		}
+		before, err := queryWorkoutContext(ctx, tx, exs)
+		if err != nil {
+			return err
+		}
+		if err := check(before); err != nil {
+			return err
+		}
+		if id, err = insertLift(ctx, tx, l); err != nil {
+			return err
+		}
+		if achieve != nil {
+			history, err := queryLiftHistory(ctx, tx, stronk.LiftFilter{Exercise: l.Exercise})
+			if err != nil {
+				return err
+			}
+			if err := insertAchievements(ctx, tx, achieve(id, history)); err != nil {
+				return err
+			}
+		}
+		wc, err = queryWorkoutContext(ctx, tx, exs)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, wc, nil
+}
+
+// insertLift records a new lift, creating its exercise if it doesn't exist,
+// since exercises outside of the main lifts (e.g. for assistance work) might
+// not have been seen before.
+func insertLift(ctx context.Context, tx *sql.Tx, l *stronk.Lift) (stronk.LiftID, error) {
+	if err := insertExercise(ctx, tx, l.Exercise); err != nil {
+		return 0, err
+	}
+
+	q := `INSERT INTO lifts
+(exercise_id, set_type, set_number, reps, weight_value, weight_unit, day_number, week_number, iteration_number, lift_note, to_failure, extra_set, rpe, reps_in_reserve, created_at)
+VALUES ((SELECT id FROM exercises WHERE name = $1), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, COALESCE($15::TIMESTAMPTZ, date_trunc('second', now())))
+RETURNING lifts.id`
+	var id stronk.LiftID
+	if err := tx.QueryRowContext(ctx, q, l.Exercise, l.SetType, l.SetNumber, l.Reps, l.Weight.Value, l.Weight.Unit, l.DayNumber, l.WeekNumber, l.IterationNumber, nullString(l.Note), l.ToFailure, nullString(string(l.Extra)), nullFloat(l.RPE), nullInt(l.RIR), nullTime(l.CreatedAt)).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert lift: %w", err)
+	}
+	return id, nil
+}
+
+func (db *DB) RecordAchievements(ctx context.Context, achs []*stronk.Achievement) error {
+	if len(achs) == 0 {
+		return nil
+	}
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		return insertAchievements(ctx, tx, achs)
+	})
+}
+
+func insertAchievements(ctx context.Context, tx *sql.Tx, achs []*stronk.Achievement) error {
+	q := `INSERT INTO achievements
+(achievement_type, lift_id, weight_value, weight_unit, reps, previous_lift_id, previous_weight_value, previous_weight_unit, previous_reps)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	for _, a := range achs {
+		if _, err := tx.ExecContext(ctx, q, a.Type, a.LiftID, a.Weight.Value, a.Weight.Unit, a.Reps, a.PreviousLiftID, a.PreviousWeight.Value, a.PreviousWeight.Unit, a.PreviousReps); err != nil {
+			return fmt.Errorf("failed to insert achievement: %w", err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) Achievements(ctx context.Context, ex stronk.Exercise) ([]*stronk.Achievement, error) {
+	var achs []*stronk.Achievement
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT achievements.achievement_type, exercises.name, achievements.lift_id, achievements.weight_value, achievements.weight_unit, achievements.reps, achievements.previous_lift_id, achievements.previous_weight_value, achievements.previous_weight_unit, achievements.previous_reps, lifts.created_at
+FROM achievements
+JOIN lifts
+	ON achievements.lift_id = lifts.id
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+WHERE $1 = '' OR exercises.name = $1
+ORDER BY lifts.created_at DESC, lifts.id DESC, achievements.id ASC`
+
+		rows, err := tx.QueryContext(ctx, q, ex)
+		if err != nil {
+			return fmt.Errorf("failed to query achievements: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var a stronk.Achievement
+			if err := rows.Scan(
+				&a.Type, &a.Exercise, &a.LiftID, &a.Weight.Value, &a.Weight.Unit, &a.Reps,
+				&a.PreviousLiftID, &a.PreviousWeight.Value, &a.PreviousWeight.Unit, &a.PreviousReps,
+				&a.AchievedAt); err != nil {
+				return fmt.Errorf("failed to scan achievement: %w", err)
+			}
+			a.AchievedAt = a.AchievedAt.UTC()
+			achs = append(achs, &a)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to scan achievements: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load achievements: %w", err)
+	}
+	return achs, nil
+}
+
+func (db *DB) SkippedWeeks(ctx context.Context) ([]stronk.SkippedWeek, error) {
+	var weeks []stronk.SkippedWeek
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		weeks, err = querySkippedWeeks(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load skipped weeks: %w", err)
+	}
+	return weeks, nil
+}
+
+func querySkippedWeeks(ctx context.Context, tx *sql.Tx) ([]stronk.SkippedWeek, error) {
+	q := `
+SELECT week_number, iteration_number, note
+FROM skipped_weeks
+ORDER BY iteration_number DESC, week_number DESC, id DESC
+LIMIT 100`
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query skipped weeks: %w", err)
+	}
+	weeks, err := skippedWeeks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan skipped weeks: %w", err)
+	}
+	return weeks, nil
+}
+
+func (db *DB) SkipWeek(ctx context.Context, note string, week, iter int) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		return insertSkippedWeek(ctx, tx, note, week, iter)
+	})
+}
+
+func (db *DB) SkipNextWeek(ctx context.Context, note string, week, iter int, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error) (*stronk.WorkoutContext, error) {
+	var wc *stronk.WorkoutContext
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		// Same lock as RecordNextLift, so the two can't race each other.
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE lifts, skipped_weeks IN EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("failed to lock lifts: %w", err)
+		}
+		before, err := queryWorkoutContext(ctx, tx, exs)
+		if err != nil {
+			return err
+		}
+		if err := check(before); err != nil {
+			return err
+		}
+		if err := insertSkippedWeek(ctx, tx, note, week, iter); err != nil {
+			return err
+		}
+		wc, err = queryWorkoutContext(ctx, tx, exs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+func insertSkippedWeek(ctx context.Context, tx *sql.Tx, note string, week, iter int) error {
+	q := `INSERT INTO skipped_weeks
+(week_number, iteration_number, note)
+VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, q, week, iter, note); err != nil {
+		return fmt.Errorf("failed to insert skipped week: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) ExportData(ctx context.Context) (*stronk.UserData, error) {
+	data := &stronk.UserData{}
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT ` + liftColumns + `
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+ORDER BY lifts.created_at ASC, lifts.id ASC`
+		rows, err := tx.QueryContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("failed to query lifts: %w", err)
+		}
+		if data.Lifts, err = lifts(rows); err != nil {
+			return fmt.Errorf("failed to scan lifts: %w", err)
+		}
+
+		q = `
+SELECT exercises.name, training_maxes.training_max_value, training_maxes.training_max_unit, training_maxes.created_at
+FROM training_maxes
+JOIN exercises
+	ON training_maxes.exercise_id = exercises.id
+ORDER BY training_maxes.created_at ASC, training_maxes.id ASC`
+		if rows, err = tx.QueryContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to query training_maxes: %w", err)
+		}
+		if data.TrainingMaxes, err = trainingMaxes(rows); err != nil {
+			return fmt.Errorf("failed to scan training_maxes: %w", err)
+		}
+
+		q = `
+SELECT smallest_denom_value, smallest_denom_unit, created_at
+FROM smallest_denom
+ORDER BY created_at ASC, id ASC`
+		if rows, err = tx.QueryContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to query smallest_denom: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sd stronk.SmallestDenom
+			if err := rows.Scan(&sd.Weight.Value, &sd.Weight.Unit, &sd.SetAt); err != nil {
+				return fmt.Errorf("failed to scan smallest denominator: %w", err)
+			}
+			sd.SetAt = sd.SetAt.UTC()
+			data.SmallestDenoms = append(data.SmallestDenoms, &sd)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to scan smallest denominators: %w", err)
+		}
+
+		q = `
+SELECT week_number, iteration_number, note
+FROM skipped_weeks
+ORDER BY created_at ASC, id ASC`
+		if rows, err = tx.QueryContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to query skipped weeks: %w", err)
+		}
+		if data.SkippedWeeks, err = skippedWeeks(rows); err != nil {
+			return fmt.Errorf("failed to scan skipped weeks: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+	return data, nil
+}
+
+func (db *DB) ImportData(ctx context.Context, data *stronk.UserData) (*stronk.ImportResult, error) {
+	res := &stronk.ImportResult{}
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		// exists runs a SELECT EXISTS(...) query.
+		exists := func(q string, args ...interface{}) (bool, error) {
+			var found bool
+			if err := tx.QueryRowContext(ctx, q, args...).Scan(&found); err != nil {
+				return false, err
+			}
+			return found, nil
+		}
+
+		for _, l := range data.Lifts {
+			if err := insertExercise(ctx, tx, l.Exercise); err != nil {
+				return err
+			}
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM lifts
+	JOIN exercises
+		ON lifts.exercise_id = exercises.id
+	WHERE exercises.name = $1
+		AND lifts.set_type = $2
+		AND lifts.set_number = $3
+		AND lifts.day_number = $4
+		AND lifts.week_number = $5
+		AND lifts.iteration_number = $6
+		AND COALESCE(lifts.extra_set, '') = $7
+		AND lifts.created_at = $8
+)`, l.Exercise, l.SetType, l.SetNumber, l.DayNumber, l.WeekNumber, l.IterationNumber, l.Extra, sqlTime(l.CreatedAt))
+			if err != nil {
+				return fmt.Errorf("failed to check for existing lift: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO lifts
+(exercise_id, set_type, set_number, reps, weight_value, weight_unit, day_number, week_number, iteration_number, lift_note, to_failure, extra_set, rpe, reps_in_reserve, created_at)
+VALUES ((SELECT id FROM exercises WHERE name = $1), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+			if _, err := tx.ExecContext(ctx, q, l.Exercise, l.SetType, l.SetNumber, l.Reps, l.Weight.Value, l.Weight.Unit, l.DayNumber, l.WeekNumber, l.IterationNumber, nullString(l.Note), l.ToFailure, nullString(string(l.Extra)), nullFloat(l.RPE), nullInt(l.RIR), sqlTime(l.CreatedAt)); err != nil {
+				return fmt.Errorf("failed to insert lift: %w", err)
+			}
+			res.Lifts++
+		}
+
+		for _, tm := range data.TrainingMaxes {
+			if err := insertExercise(ctx, tx, tm.Exercise); err != nil {
+				return err
+			}
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM training_maxes
+	JOIN exercises
+		ON training_maxes.exercise_id = exercises.id
+	WHERE exercises.name = $1
+		AND training_maxes.training_max_value = $2
+		AND training_maxes.training_max_unit = $3
+		AND training_maxes.created_at = $4
+)`, tm.Exercise, tm.Max.Value, tm.Max.Unit, sqlTime(tm.SetAt))
+			if err != nil {
+				return fmt.Errorf("failed to check for existing training max: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO training_maxes
+(exercise_id, training_max_value, training_max_unit, created_at)
+VALUES ((SELECT id FROM exercises WHERE name = $1), $2, $3, $4)`
+			if _, err := tx.ExecContext(ctx, q, tm.Exercise, tm.Max.Value, tm.Max.Unit, sqlTime(tm.SetAt)); err != nil {
+				return fmt.Errorf("failed to insert training max: %w", err)
+			}
+			res.TrainingMaxes++
+		}
+
+		for _, sd := range data.SmallestDenoms {
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM smallest_denom
+	WHERE smallest_denom_value = $1
+		AND smallest_denom_unit = $2
+		AND created_at = $3
+)`, sd.Weight.Value, sd.Weight.Unit, sqlTime(sd.SetAt))
+			if err != nil {
+				return fmt.Errorf("failed to check for existing smallest denominator: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO smallest_denom (smallest_denom_value, smallest_denom_unit, created_at) VALUES ($1, $2, $3)`
+			if _, err := tx.ExecContext(ctx, q, sd.Weight.Value, sd.Weight.Unit, sqlTime(sd.SetAt)); err != nil {
+				return fmt.Errorf("failed to insert smallest denominator: %w", err)
+			}
+			res.SmallestDenoms++
+		}
+
+		for _, wk := range data.SkippedWeeks {
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM skipped_weeks
+	WHERE week_number = $1
+		AND iteration_number = $2
+)`, wk.Week, wk.Iteration)
+			if err != nil {
+				return fmt.Errorf("failed to check for existing skipped week: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO skipped_weeks (week_number, iteration_number, note) VALUES ($1, $2, $3)`
+			if _, err := tx.ExecContext(ctx, q, wk.Week, wk.Iteration, wk.Note); err != nil {
+				return fmt.Errorf("failed to insert skipped week: %w", err)
+			}
+			res.SkippedWeeks++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import data: %w", err)
+	}
+	return res, nil
+}
+
+// oneRepMaxExpr mirrors stronk.Lift.AsRPEOneRepMax: Epley on reps plus reps in
+// reserve, falling back to 10 - RPE when only RPE was recorded, capped at
+// stronk.MaxRepsInReserve. TRUNC matches the integer truncation in Go (and
+// SQLite's CAST).
+const oneRepMaxExpr = `TRUNC(lifts.weight_value + 0.033333333 * lifts.weight_value * (lifts.reps + LEAST(COALESCE(lifts.reps_in_reserve, CASE WHEN lifts.rpe IS NULL THEN 0 ELSE 10 - lifts.rpe END), 4)))`
+
+func (db *DB) WorkoutContext(ctx context.Context, exs []stronk.Exercise) (*stronk.WorkoutContext, error) {
+	var wc *stronk.WorkoutContext
+	err := db.snapshot(ctx, func(tx *sql.Tx) (err error) {
+		wc, err = queryWorkoutContext(ctx, tx, exs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+func queryWorkoutContext(ctx context.Context, tx *sql.Tx, exs []stronk.Exercise) (*stronk.WorkoutContext, error) {
+	wc := &stronk.WorkoutContext{}
+	var err error
+	if wc.RecentLifts, err = queryRecentLifts(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.SkippedWeeks, err = querySkippedWeeks(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.TrainingMaxes, err = queryTrainingMaxes(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.SmallestDenom, err = querySmallestDenom(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.FailureSets, err = queryFailureSets(ctx, tx, exs); err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// queryFailureSets loads the best to-failure lift at each weight for the given
+// exercises, most recent first, see stronk.WorkoutContext.FailureSets.
+func queryFailureSets(ctx context.Context, tx *sql.Tx, exs []stronk.Exercise) (map[stronk.Exercise][]*stronk.Lift, error) {
+	out := make(map[stronk.Exercise][]*stronk.Lift)
+	if len(exs) == 0 {
+		return out, nil
+	}
+
+	q := `
+WITH ranked AS (
+	SELECT lifts.id, ROW_NUMBER() OVER (
+		PARTITION BY lifts.exercise_id, lifts.weight_unit, lifts.weight_value
+		ORDER BY ` + oneRepMaxExpr + ` DESC, lifts.iteration_number DESC, lifts.week_number DESC, lifts.day_number DESC, lifts.created_at DESC, lifts.id DESC
+	) AS weight_rank
+	FROM lifts
+	JOIN exercises
+		ON lifts.exercise_id = exercises.id
+	WHERE exercises.name = ANY($1)
+		AND lifts.to_failure = TRUE
+)
+SELECT ` + liftColumns + `
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+JOIN ranked
+	ON lifts.id = ranked.id
+WHERE ranked.weight_rank = 1
+ORDER BY lifts.iteration_number DESC, lifts.week_number DESC, lifts.day_number DESC, lifts.created_at DESC, lifts.id DESC`
+
+	names := make([]string, len(exs))
+	for i, ex := range exs {
+		names[i] = string(ex)
+	}
+
+	rows, err := tx.QueryContext(ctx, q, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failure sets: %w", err)
+	}
+	lfs, err := lifts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan failure sets: %w", err)
+	}
+	for _, l := range lfs {
+		out[l.Exercise] = append(out[l.Exercise], l)
+	}
+	return out, nil
+}
+
+func (db *DB) RecentFailureSets(ctx context.Context) ([]*stronk.Lift, error) {
+	var lfs []*stronk.Lift
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT ` + liftColumns + `
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+WHERE set_type = 'MAIN'
+	AND to_failure = TRUE
+	AND extra_set IS NULL
+	AND iteration_number >= 0
+ORDER BY iteration_number DESC, week_number DESC, day_number DESC, lifts.created_at DESC, lifts.id DESC
+LIMIT 250`
+
+		rows, err := tx.QueryContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("failed to query lifts: %w", err)
+		}
+		if lfs, err = lifts(rows); err != nil {
+			return fmt.Errorf("failed to scan lifts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failure sets: %w", err)
+	}
+	return lfs, nil
+}
+
+func (db *DB) LiftHistory(ctx context.Context, filter stronk.LiftFilter) ([]*stronk.Lift, error) {
+	var lfs []*stronk.Lift
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		lfs, err = queryLiftHistory(ctx, tx, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lfs, nil
+}
+
+func queryLiftHistory(ctx context.Context, tx *sql.Tx, filter stronk.LiftFilter) ([]*stronk.Lift, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.Exercise != "" {
+		args = append(args, filter.Exercise)
+		where = append(where, fmt.Sprintf("exercises.name = $%d", len(args)))
+	}
+	if filter.SetType != "" {
+		args = append(args, filter.SetType)
+		where = append(where, fmt.Sprintf("lifts.set_type = $%d", len(args)))
+	}
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, "\n\tAND ")
+	}
+
+	q := fmt.Sprintf(`
+SELECT `+liftColumns+`
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+%s
+ORDER BY lifts.created_at ASC, lifts.id ASC`, whereClause)
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lift history: %w", err)
+	}
+	lfs, err := lifts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan lift history: %w", err)
+	}
+	return lfs, nil
+}
+
+func (db *DB) RecentLifts(ctx context.Context) ([]*stronk.Lift, error) {
+	var lfs []*stronk.Lift
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		lfs, err = queryRecentLifts(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set lifts: %w", err)
+	}
+	return lfs, nil
+}
+
+func queryRecentLifts(ctx context.Context, tx *sql.Tx) ([]*stronk.Lift, error) {
+	q := `
+SELECT `
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent lifts: %w", err)
+	}
+	lfs, err := lifts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan recent lifts: %w", err)
+	}
+	return lfs, nil
+}
+
+func (db *DB) SavedResponse(ctx context.Context, key string) (*stronk.SavedResponse, error) {
+	var resp *stronk.SavedResponse
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		resp, err = querySavedResponse(ctx, tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved response: %w", err)
+	}
+	return resp, nil
+}
+
+func querySavedResponse(ctx context.Context, tx *sql.Tx, key string) (*stronk.SavedResponse, error) {
+	q := `
+SELECT idempotency_key, request_path, request_hash, response_status, response_body, created_at
+FROM idempotency_keys
+WHERE idempotency_key = $1`
+	var r stronk.SavedResponse
+	err := tx.QueryRowContext(ctx, q, key).Scan(&r.Key, &r.Path, &r.RequestHash, &r.Status, &r.Body, &r.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan saved response: %w", err)
+	}
+	r.CreatedAt = r.CreatedAt.UTC()
+	return &r, nil
+}
+
+func (db *DB) ReserveResponse(ctx context.Context, resp *stronk.SavedResponse, abandonBefore, expireBefore time.Time) (*stronk.SavedResponse, error) {
+	var saved *stronk.SavedResponse
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `DELETE FROM idempotency_keys WHERE created_at < $1 OR (response_status = 0 AND created_at < $2)`
+		if _, err := tx.ExecContext(ctx, q, expireBefore, abandonBefore); err != nil {
+			return fmt.Errorf("failed to delete expired responses: %w", err)
+		}
+		// If another request has the key, this waits for it to commit or roll
+		// back, so we either get the key or see what's saved for it.
+		q = `INSERT INTO idempotency_keys
+(idempotency_key, request_path, request_hash, response_status)
+VALUES ($1, $2, $3, 0)
+ON CONFLICT (idempotency_key) DO NOTHING`
+		res, err := tx.ExecContext(ctx, q, resp.Key, resp.Path, resp.RequestHash)
+		if err != nil {
+			return fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if n > 0 {
+			return nil
+		}
+		saved, err = querySavedResponse(ctx, tx, resp.Key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (db *DB) SaveResponse(ctx context.Context, resp *stronk.SavedResponse) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		q := `UPDATE idempotency_keys
+SET response_status = $1, response_body = $2
+WHERE idempotency_key = $3
+	AND response_status = 0`
+		res, err := tx.ExecContext(ctx, q, resp.Status, resp.Body, resp.Key)
+		if err != nil {
+			return fmt.Errorf("failed to save response: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("idempotency key %q isn't reserved", resp.Key)
+		}
+		return nil
+	})
+}
+
+func (db *DB) ReleaseResponse(ctx context.Context, key string) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND response_status = 0`, key); err != nil {
+			return fmt.Errorf("failed to release idempotency key: %w", err)
+		}
+		return nil
+	})
+}
+
+func (db *DB) transact(ctx context.Context, dbFn func(tx *sql.Tx) error) error {
+	return db.runTx(ctx, nil, dbFn)
+}
+
+// snapshot runs dbFn in a read-only transaction where every query sees the
+// same state, which Postgres' default READ COMMITTED doesn't guarantee.
+func (db *DB) snapshot(ctx context.Context, dbFn func(tx *sql.Tx) error) error {
+	return db.runTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, dbFn)
+}
+
+func (db *DB) runTx(ctx context.Context, opts *sql.TxOptions, dbFn func(tx *sql.Tx) error) error {
+	tx, err := db.sql.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := dbFn(tx); err != nil {
+		return fmt.Errorf("failed to perform DB action: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) SetTrainingMaxes(ctx context.Context, press, squat, bench, deadlift stronk.Weight) error {
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `INSERT INTO training_maxes
+(exercise_id, training_max_value, training_max_unit) VALUES
+($1, $2, $3), ($4, $5, $6), ($7, $8, $9), ($10, $11, $12)`
+		args := []interface{}{
+			db.mainLiftIDs[stronk.OverheadPress], press.Value, press.Unit,
+			db.mainLiftIDs[stronk.Squat], squat.Value, squat.Unit,
+			db.mainLiftIDs[stronk.BenchPress], bench.Value, bench.Unit,
+			db.mainLiftIDs[stronk.Deadlift], deadlift.Value, deadlift.Unit,
+		}
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return fmt.Errorf("failed to insert to training_maxes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set training maxes: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) TrainingMaxes(ctx context.Context) ([]*stronk.TrainingMax, error) {
+	var tms []*stronk.TrainingMax
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		tms, err = queryTrainingMaxes(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set training maxes: %w", err)
+	}
+	return tms, nil
+}
+
+// queryTrainingMaxes returns the latest training max for each exercise.
+func queryTrainingMaxes(ctx context.Context, tx *sql.Tx) ([]*stronk.TrainingMax, error) {
+	q := `
+SELECT exercises.name, a.training_max_value, a.training_max_unit, a.created_at
+FROM training_maxes a
+JOIN exercises
+	ON a.exercise_id = exercises.id
+WHERE a.id = (
+	SELECT b.id
+	FROM training_maxes b
+	WHERE b.exercise_id = a.exercise_id
+	ORDER BY b.created_at DESC, b.id DESC
+	LIMIT 1
+)
+ORDER BY exercises.id ASC`
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query training_maxes: %w", err)
+	}
+	tms, err := trainingMaxes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan training_maxes: %w", err)
+	}
+	return tms, nil
+}
+
+func (db *DB) TrainingMaxHistory(ctx context.Context) ([]*stronk.TrainingMax, error) {
+	var tms []*stronk.TrainingMax
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT exercises.name, training_maxes.training_max_value, training_maxes.training_max_unit, training_maxes.created_at
+FROM training_maxes
+JOIN exercises
+	ON training_maxes.exercise_id = exercises.id
+ORDER BY training_maxes.created_at ASC, training_maxes.id ASC`
+
+		rows, err := tx.QueryContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("failed to query training_maxes: %w", err)
+		}
+		if tms, err = trainingMaxes(rows); err != nil {
+			return fmt.Errorf("failed to scan training_maxes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load training max history: %w", err)
+	}
+	return tms, nil
+}
+
+func trainingMaxes(rows *sql.Rows) ([]*stronk.TrainingMax, error) {
+	defer rows.Close()
+
+	var tms []*stronk.TrainingMax
+	for rows.Next() {
+		var tm stronk.TrainingMax
+		if err := rows.Scan(&tm.Exercise, &tm.Max.Value, &tm.Max.Unit, &tm.SetAt); err != nil {
+			return nil, fmt.Errorf("failed to scan training max: %w", err)
+		}
+		tm.SetAt = tm.SetAt.UTC()
+		tms = append(tms, &tm)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan training maxes: %w", err)
+	}
+	return tms, nil
+}
+
+func (db *DB) SetSmallestDenom(ctx context.Context, small stronk.Weight) error {
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `INSERT INTO smallest_denom (smallest_denom_value, smallest_denom_unit) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(ctx, q, small.Value, small.Unit); err != nil {
+			return fmt.Errorf("failed to insert to smallest_denom: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set smallest denominator: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) SmallestDenom(ctx context.Context) (stronk.Weight, error) {
+	var small stronk.Weight
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		small, err = querySmallestDenom(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return stronk.Weight{}, err
+	}
+	return small, nil
+}
+
+func querySmallestDenom(ctx context.Context, tx *sql.Tx) (stronk.Weight, error) {
+	q := `
+SELECT a.smallest_denom_value, a.smallest_denom_unit
+FROM smallest_denom a
+ORDER BY a.created_at DESC, a.id DESC
+LIMIT 1`
+	var small stronk.Weight
+	err := tx.QueryRowContext(ctx, q).Scan(&small.Value, &small.Unit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stronk.Weight{}, stronk.ErrNoSmallestDenom
+	}
+	if err != nil {
+		return stronk.Weight{}, fmt.Errorf("failed to scan smallest denominator: %w", err)
+	}
+	return small, nil
+}
+
+func lifts(rows *sql.Rows) ([]*stronk.Lift, error) {
+	defer rows.Close()
+
+	var lfs []*stronk.Lift
+	for rows.Next() {
+		var (
+			lf    stronk.Lift
+			note  sql.NullString
+			extra sql.NullString
+			rpe   sql.NullFloat64
+			rir   sql.NullInt64
+		)
+		if err := rows.Scan(
+			&lf.ID,
+			&lf.Exercise, &lf.SetType, &lf.Weight.Value, &lf.Weight.Unit,
+			&lf.SetNumber, &lf.Reps, &note,
+			&lf.DayNumber, &lf.WeekNumber, &lf.IterationNumber,
+			&lf.ToFailure, &extra, &rpe, &rir, &lf.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan lift: %w", err)
+		}
+		lf.CreatedAt = lf.CreatedAt.UTC()
+		if note.Valid {
+			lf.Note = note.String
+		}
+		if extra.Valid {
+			lf.Extra = stronk.ExtraSet(extra.String)
+		}
+		if rpe.Valid {
+			lf.RPE = rpe.Float64
+		}
+		if rir.Valid {
+			v := int(rir.Int64)
+			lf.RIR = &v
+		}
+		lfs = append(lfs, &lf)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan lifts: %w", err)
+	}
+	return lfs, nil
+}
+
+func skippedWeeks(rows *sql.Rows) ([]stronk.SkippedWeek, error) {
+	defer rows.Close()
+
+	var wks []stronk.SkippedWeek
+	for rows.Next() {
+		var wk stronk.SkippedWeek
+		if err := rows.Scan(&wk.Week, &wk.Iteration, &wk.Note); err != nil {
+			return nil, fmt.Errorf("failed to scan skipped week: %w", err)
+		}
+		wks = append(wks, wk)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan skipped weeks: %w", err)
+	}
+	return wks, nil
+}
+
+// migrations is the Postgres migration set. It's separate from the SQLite
+// one, and starts from the schema SQLite had reached when this package was
+// added.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// New connects to the Postgres database described by dsn (either a URL or a
+// key=value connection string, see lib/pq) and migrates it to the latest
+// version. migrationsPath is interpreted the same way as in sqldb.New.
+func New(dsn, migrationsPath string) (*DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Postgres DB: %w", err)
+	}
+	cleanupOnError := func(origErr error) error {
+		if closeErr := db.Close(); closeErr != nil {
+			return fmt.Errorf("error closing DB (%v) while handling original error: %w", closeErr, origErr)
+		}
+		return origErr
+	}
+
+	if err := migrateUp(db, migrationsPath); err != nil {
+		return nil, cleanupOnError(err)
+	}
+
+	pdb := &DB{sql: db}
+
+	if err := pdb.initMainLifts(context.Background()); err != nil {
+		return nil, cleanupOnError(fmt.Errorf("failed to init main lifts: %w", err))
+	}
+
+	return pdb, nil
+}
+
+func migrateUp(db *sql.DB, migrationsPath string) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+	// Closing the migrator closes conn, which returns it to the pool.
+	m, err := newMigrate(conn, migrationsPath)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer m.Close()
+
+	prevV, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("failed to load current DB version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("database was marked dirty at version %d, fix the schema by hand and reset schema_migrations", prevV)
+	}
+
+	switch err := m.Up(); {
+	case err == nil:
+		// Fine, good.
+	case errors.Is(err, migrate.ErrNoChange):
+		log.Print("No new migrations to apply")
+	default:
+		return fmt.Errorf("failed to migrate database up: %w", err)
+	}
+
+	curV, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("failed to load DB version post-migration: %w", err)
+	}
+	if dirty {
+		return errors.New("database was marked dirty after migration")
+	}
+
+	if prevV != curV {
+		log.Printf("Migrated from version %d to version %d", prevV, curV)
+	}
+	return nil
+}
+
+func (db *DB) CreateExercise(ctx context.Context, ex stronk.Exercise) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		return insertExercise(ctx, tx, ex)
+	})
+}
+
+// insertExercise adds the exercise if it doesn't already exist.
+func insertExercise(ctx context.Context, tx *sql.Tx, ex stronk.Exercise) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO exercises (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, ex); err != nil {
+		return fmt.Errorf("failed to insert exercise %q: %w", ex, err)
+	}
+	return nil
+}
+
+type exercise struct {
+	ID       int
+	Exercise stronk.Exercise
+}
+
+func (db *DB) exercises(ctx context.Context, exs []stronk.Exercise) ([]exercise, error) {
+	names := make([]string, len(exs))
+	for i, ex := range exs {
+		names[i] = string(ex)
+	}
+
+	var out []exercise
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT id, name
+FROM exercises
+WHERE name = ANY($1)`
+
+		rows, err := tx.QueryContext(ctx, q, pq.Array(names))
+		if err != nil {
+			return fmt.Errorf("failed to query exercises: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e exercise
+			if err := rows.Scan(&e.ID, &e.Exercise); err != nil {
+				return fmt.Errorf("failed to scan exercise: %w", err)
+			}
+			out = append(out, e)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to scan exercises: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exercises: %w", err)
+	}
+	return out, nil
+}
+
+func (db *DB) initMainLifts(ctx context.Context) error {
+	// First, create all the main lifts.
+	exs := stronk.MainExercises()
+	for _, ex := range exs {
+		if err := db.CreateExercise(ctx, ex); err != nil {
+			return fmt.Errorf("failed to create exercise %q: %w", ex, err)
+		}
+	}
+
+	// Now, load all of their IDs.
+	mainLiftIDs := make(map[stronk.Exercise]int)
+	exsWithIDs, err := db.exercises(ctx, exs)
+	if err != nil {
+		return err
+	}
+	for _, ex := range exsWithIDs {
+		mainLiftIDs[ex.Exercise] = ex.ID
+	}
+
+	db.mainLiftIDs = mainLiftIDs
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package pgdb
+
+import (
+	"bytes"
+	"database/sql"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcspragu/stronk/server"
+	"github.com/bcspragu/stronk/testing/dbtest"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// TestDB runs against the Postgres server in STRONK_TEST_POSTGRES_DSN, or an
+// embedded one if that isn't set, see the README. Every subtest wipes the
+// public schema, so don't point this at a database you care about.
+func TestDB(t *testing.T) {
+	dsn := os.Getenv("STRONK_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		if testing.Short() {
+			t.Skip("skipping embedded Postgres in short mode, set STRONK_TEST_POSTGRES_DSN to use an existing server")
+		}
+		dsn = startPostgres(t)
+	}
+
+	dbtest.Run(t, func(t *testing.T) server.DB {
+		resetSchema(t, dsn)
+		db, err := New(dsn, "")
+		if err != nil {
+			t.Fatalf("failed to create DB: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := db.Close(); err != nil {
+				t.Errorf("failed to close DB: %v", err)
+			}
+		})
+		return db
+	})
+}
+
+func resetSchema(t *testing.T, dsn string) {
+	t.Helper()
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open Postgres DB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatalf("failed to reset schema: %v", err)
+	}
+}
+
+// startPostgres starts an embedded Postgres server for the test, downloading
+// its binaries the first time, and returns a DSN for it. Postgres refuses to
+// run as root, so neither can the test.
+func startPostgres(t *testing.T) string {
+	t.Helper()
+
+	// Postgres needs a fixed port, so grab a free one.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to free port: %v", err)
+	}
+
+	var logs bytes.Buffer
+	cfg := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V15).
+		Port(uint32(port)).
+		RuntimePath(filepath.Join(t.TempDir(), "postgres")).
+		Logger(&logs)
+	pg := embeddedpostgres.NewDatabase(cfg)
+	if err := pg.Start(); err != nil {
+		t.Fatalf("failed to start embedded Postgres, set STRONK_TEST_POSTGRES_DSN to use an existing server: %v\n%s", err, logs.String())
+	}
+	t.Cleanup(func() {
+		if err := pg.Stop(); err != nil {
+			t.Errorf("failed to stop embedded Postgres: %v", err)
+		}
+	})
+	return cfg.GetConnectionURL() + "?sslmode=disable"
+}
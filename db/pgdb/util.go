@@ -0,0 +1,42 @@
+package pgdb
+
+import (
+	"database/sql"
+	"time"
+)
+
+func nullString(in string) sql.NullString {
+	if in == "" {
+		return sql.NullString{Valid: false}
+	}
+	return sql.NullString{Valid: true, String: in}
+}
+
+func nullFloat(in float64) sql.NullFloat64 {
+	if in == 0 {
+		return sql.NullFloat64{Valid: false}
+	}
+	return sql.NullFloat64{Valid: true, Float64: in}
+}
+
+func nullInt(in *int) sql.NullInt64 {
+	if in == nil {
+		return sql.NullInt64{Valid: false}
+	}
+	return sql.NullInt64{Valid: true, Int64: int64(*in)}
+}
+
+// sqlTime truncates a time to the second, matching the precision of our
+// created_at defaults, so that imported timestamps can be compared for
+// equality.
+func sqlTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// nullTime is like sqlTime, but maps the zero time to NULL.
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{Valid: false}
+	}
+	return sql.NullTime{Valid: true, Time: sqlTime(t)}
+}
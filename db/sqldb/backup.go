@@ -0,0 +1,176 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup writes a consistent snapshot of the database to destPath, using
+// SQLite's online backup API. The backup holds the only read-write
+// connection, so writes are blocked while it's running, reads aren't.
+func (db *DB) Backup(destPath string) error {
+	if err := copyDB(db.rw, destPath); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the database at dbPath with the snapshot at snapshotPath,
+// and returns the snapshot's schema version. The snapshot must be cleanly
+// migrated to a version in the migration set (see New for how
+// migrationsPath is interpreted), so we don't restore a snapshot from a newer
+// release than this one. The database is locked exclusively while it's
+// replaced, so Restore fails if the server is still running.
+func Restore(snapshotPath, dbPath, migrationsPath string) (uint, error) {
+	if _, err := os.Stat(snapshotPath); err != nil {
+		return 0, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	snap, err := sql.Open("sqlite3", "file:"+snapshotPath+"?mode=ro&_loc=UTC")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer snap.Close()
+
+	version, err := validateSnapshot(snap, migrationsPath)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	// In exclusive locking mode, a connection never releases a lock once it has
+	// it, so nothing else can read or write the database until we're done.
+	dest, err := sql.Open("sqlite3", "file:"+dbPath+"?_locking_mode=EXCLUSIVE&_busy_timeout="+busyTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	lockErr := func(err error) error {
+		return fmt.Errorf("failed to lock database, is the server still running? %w", err)
+	}
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return 0, lockErr(err)
+	}
+	defer destConn.Close()
+
+	if _, err := destConn.ExecContext(ctx, `BEGIN EXCLUSIVE; COMMIT`); err != nil {
+		return 0, lockErr(err)
+	}
+	if err := backupTo(ctx, destConn, snap); err != nil {
+		return 0, fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return version, nil
+}
+
+func validateSnapshot(snap *sql.DB, migrationsPath string) (uint, error) {
+	var check string
+	if err := snap.QueryRow(`PRAGMA quick_check`).Scan(&check); err != nil {
+		return 0, fmt.Errorf("failed to check snapshot integrity: %w", err)
+	}
+	if check != "ok" {
+		return 0, fmt.Errorf("snapshot failed integrity check: %s", check)
+	}
+
+	var (
+		version uint
+		dirty   bool
+	)
+	switch err := snap.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty); {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, errors.New("snapshot has no migrations applied")
+	case err != nil:
+		return 0, fmt.Errorf("failed to load snapshot schema version: %w", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("snapshot was marked dirty at version %d", version)
+	}
+
+	src, err := migrationSource(migrationsPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == version {
+			return version, nil
+		}
+	}
+	return 0, fmt.Errorf("snapshot schema version %d isn't in the migration set", version)
+}
+
+// copyDB copies the full contents of src to the SQLite database at destPath,
+// creating it if it doesn't exist.
+func copyDB(src *sql.DB, destPath string) error {
+	dest, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return fmt.Errorf("failed to open destination: %w", err)
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get destination connection: %w", err)
+	}
+	defer destConn.Close()
+
+	return backupTo(ctx, destConn, src)
+}
+
+// backupTo copies the full contents of src over the database destConn is
+// connected to.
+func backupTo(ctx context.Context, destConn *sql.Conn, src *sql.DB) error {
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get source connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			d, ok := destRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected destination connection type %T", destRaw)
+			}
+			s, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected source connection type %T", srcRaw)
+			}
+
+			bk, err := d.Backup("main", s, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			for {
+				// Step returns false with no error if the source is busy, so we
+				// just try again shortly.
+				done, err := bk.Step(-1)
+				if err != nil {
+					bk.Finish()
+					return fmt.Errorf("failed to copy pages: %w", err)
+				}
+				if done {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err := bk.Finish(); err != nil {
+				return fmt.Errorf("failed to finish backup: %w", err)
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bcspragu/stronk"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, snapPath := filepath.Join(dir, "stronk.db"), filepath.Join(dir, "snapshot.db")
+	ctx := context.Background()
+
+	db, err := New(dbPath, "")
+	if err != nil {
+		t.Fatalf("failed to create DB: %v", err)
+	}
+	recordSquat(t, db, 1000)
+	if err := db.Backup(snapPath); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	// This one isn't in the snapshot, so restoring should lose it.
+	recordSquat(t, db, 1100)
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close DB: %v", err)
+	}
+
+	version, err := Restore(snapPath, dbPath, "")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if version != latestVersion(t) {
+		t.Errorf("restored version %d, want %d", version, latestVersion(t))
+	}
+
+	if db, err = New(dbPath, ""); err != nil {
+		t.Fatalf("failed to open restored DB: %v", err)
+	}
+	defer db.Close()
+	lifts, err := db.RecentLifts(ctx)
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if len(lifts) != 1 || lifts[0].Weight.Value != 1000 {
+		t.Errorf("unexpected lifts after restoring: %+v", lifts)
+	}
+}
+
+func TestRestoreWhileRunning(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, snapPath := filepath.Join(dir, "stronk.db"), filepath.Join(dir, "snapshot.db")
+	db := newTestDBAt(t, dbPath)
+	recordSquat(t, db, 1000)
+	if err := db.Backup(snapPath); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	recordSquat(t, db, 1100)
+
+	// The server holds its connections open even when idle, so the database is
+	// in use for as long as it's up.
+	if _, err := Restore(snapPath, dbPath, ""); err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Fatalf("Restore with the DB in use returned %v, want a locking error", err)
+	}
+
+	lifts, err := db.RecentLifts(context.Background())
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if len(lifts) != 2 {
+		t.Errorf("got %d lifts after a refused restore, want 2", len(lifts))
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	tests := []struct {
+		desc string
+		// modify breaks a good snapshot at path.
+		modify  func(t *testing.T, path string)
+		wantErr string
+	}{
+		{
+			desc: "unknown version",
+			modify: func(t *testing.T, path string) {
+				execSnapshot(t, path, `UPDATE schema_migrations SET version = 99991231235959`)
+			},
+			wantErr: "isn't in the migration set",
+		},
+		{
+			desc: "dirty",
+			modify: func(t *testing.T, path string) {
+				execSnapshot(t, path, `UPDATE schema_migrations SET dirty = TRUE`)
+			},
+			wantErr: "marked dirty",
+		},
+		{
+			desc: "no migrations",
+			modify: func(t *testing.T, path string) {
+				execSnapshot(t, path, `DELETE FROM schema_migrations`)
+			},
+			wantErr: "no migrations applied",
+		},
+		{
+			desc: "corrupt file",
+			modify: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, []byte(strings.Repeat("not a database ", 1000)), 0600); err != nil {
+					t.Fatalf("failed to corrupt snapshot: %v", err)
+				}
+			},
+			wantErr: "integrity",
+		},
+		{
+			desc: "missing file",
+			modify: func(t *testing.T, path string) {
+				if err := os.Remove(path); err != nil {
+					t.Fatalf("failed to remove snapshot: %v", err)
+				}
+			},
+			wantErr: "failed to stat snapshot",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath, snapPath := filepath.Join(dir, "stronk.db"), filepath.Join(dir, "snapshot.db")
+			db, err := New(dbPath, "")
+			if err != nil {
+				t.Fatalf("failed to create DB: %v", err)
+			}
+			recordSquat(t, db, 1000)
+			if err := db.Backup(snapPath); err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+			recordSquat(t, db, 1100)
+			if err := db.Close(); err != nil {
+				t.Fatalf("failed to close DB: %v", err)
+			}
+
+			test.modify(t, snapPath)
+			if _, err := Restore(snapPath, dbPath, ""); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("Restore returned %v, want an error containing %q", err, test.wantErr)
+			}
+
+			// The database should be left alone.
+			db = newTestDBAt(t, dbPath)
+			lifts, err := db.RecentLifts(context.Background())
+			if err != nil {
+				t.Fatalf("RecentLifts: %v", err)
+			}
+			if len(lifts) != 2 {
+				t.Errorf("got %d lifts after a failed restore, want 2", len(lifts))
+			}
+		})
+	}
+}
+
+func recordSquat(t *testing.T, db *DB, weight int) {
+	t.Helper()
+	wt := stronk.Weight{Value: weight, Unit: stronk.DeciPounds}
+	if _, err := db.RecordLift(context.Background(), stronk.Squat, stronk.Main, wt, 1, 5, "", 1, 1, 1, false, "", 0, nil); err != nil {
+		t.Fatalf("RecordLift: %v", err)
+	}
+}
+
+func execSnapshot(t *testing.T, path, stmt string) {
+	t.Helper()
+	snap, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %v", err)
+	}
+	defer snap.Close()
+	if _, err := snap.Exec(stmt); err != nil {
+		t.Fatalf("failed to modify snapshot: %v", err)
+	}
+}
+
+func latestVersion(t *testing.T) uint {
+	t.Helper()
+	src, err := migrationSource("")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	defer src.Close()
+	versions, err := sourceVersions(src)
+	if err != nil {
+		t.Fatalf("failed to load versions: %v", err)
+	}
+	return versions[len(versions)-1]
+}
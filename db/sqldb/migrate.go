@@ -0,0 +1,347 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	migratesqlite3 "github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+// Migrator manages the schema version of a database directly, for recovering
+// from a bad release or a migration that failed halfway through. Unlike New,
+// it doesn't migrate anything on its own.
+type Migrator struct {
+	sql *sql.DB
+	m   *migrate.Migrate
+	src source.Driver
+}
+
+// MigrationStatus describes the schema version of a database, relative to the
+// migration set.
+type MigrationStatus struct {
+	// Version is the current schema version, zero if no migrations have been
+	// applied.
+	Version uint
+	// Dirty is true if a migration failed partway through, in which case the
+	// schema needs to be fixed by hand and the version forced.
+	Dirty bool
+	// Latest is the newest version in the migration set.
+	Latest uint
+	// Pending are the versions that haven't been applied yet, oldest first.
+	Pending []uint
+}
+
+// MigrationStep is a single migration file, as it would be run by the
+// Migrator.
+type MigrationStep struct {
+	Version    uint
+	Identifier string
+	Up         bool
+	SQL        string
+}
+
+// NewMigrator opens the SQLite database at dbPath for migration management.
+// See New for how migrationsPath is interpreted. Unlike New, the database must
+// already exist, so that a mistyped path doesn't quietly create an empty one.
+func NewMigrator(dbPath, migrationsPath string) (*Migrator, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to find SQLite DB: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_loc=UTC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite DB: %w", err)
+	}
+
+	m, src, err := newMigrate(db, migrationsPath)
+	if err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			return nil, fmt.Errorf("error closing DB (%v) while handling original error: %w", closeErr, err)
+		}
+		return nil, err
+	}
+
+	return &Migrator{sql: db, m: m, src: src}, nil
+}
+
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	if srcErr != nil {
+		return fmt.Errorf("failed to close migration source: %w", srcErr)
+	}
+	if dbErr != nil {
+		return fmt.Errorf("failed to close database: %w", dbErr)
+	}
+	return nil
+}
+
+func (m *Migrator) Status() (*MigrationStatus, error) {
+	cur, dirty, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{
+		Version: cur,
+		Dirty:   dirty,
+	}
+	for _, v := range versions {
+		if v > cur {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	if len(versions) > 0 {
+		status.Latest = versions[len(versions)-1]
+	}
+	return status, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate up: %w", err)
+	}
+	return nil
+}
+
+// Down rolls back the n most recently applied migrations.
+func (m *Migrator) Down(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+	if err := m.m.Steps(-n); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate down %d: %w", n, err)
+	}
+	return nil
+}
+
+// Goto migrates up or down to the given version.
+func (m *Migrator) Goto(version uint) error {
+	if err := m.m.Migrate(version); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate to version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Force sets the schema version and clears the dirty flag, without running
+// any migrations. A version of zero marks the database as having no
+// migrations applied.
+func (m *Migrator) Force(version uint) error {
+	v := int(version)
+	if version == 0 {
+		v = database.NilVersion
+	}
+	if err := m.m.Force(v); err != nil {
+		return fmt.Errorf("failed to force version %d: %w", version, err)
+	}
+	return nil
+}
+
+// PlanUp returns the migrations that Up would run, in order.
+func (m *Migrator) PlanUp() ([]*MigrationStep, error) {
+	cur, _, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+	var vs []uint
+	for _, v := range versions {
+		if v > cur {
+			vs = append(vs, v)
+		}
+	}
+	return m.steps(vs, true)
+}
+
+// PlanDown returns the migrations that Down(n) would run, in order.
+func (m *Migrator) PlanDown(n int) ([]*MigrationStep, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+	cur, _, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+	var vs []uint
+	for i := len(versions) - 1; i >= 0 && len(vs) < n; i-- {
+		if versions[i] <= cur {
+			vs = append(vs, versions[i])
+		}
+	}
+	if len(vs) < n {
+		return nil, fmt.Errorf("can't roll back %d migrations, only %d are applied", n, len(vs))
+	}
+	return m.steps(vs, false)
+}
+
+// PlanGoto returns the migrations that Goto(version) would run, in order.
+func (m *Migrator) PlanGoto(version uint) ([]*MigrationStep, error) {
+	cur, _, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, v := range versions {
+		if v == version {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("version %d isn't in the migration set", version)
+	}
+
+	var vs []uint
+	if version >= cur {
+		for _, v := range versions {
+			if v > cur && v <= version {
+				vs = append(vs, v)
+			}
+		}
+		return m.steps(vs, true)
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if v := versions[i]; v <= cur && v > version {
+			vs = append(vs, v)
+		}
+	}
+	return m.steps(vs, false)
+}
+
+func (m *Migrator) version() (uint, bool, error) {
+	v, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to load current DB version: %w", err)
+	}
+	return v, dirty, nil
+}
+
+// versions returns every version in the migration set, oldest first.
+func (m *Migrator) versions() ([]uint, error) {
+	return sourceVersions(m.src)
+}
+
+func sourceVersions(src source.Driver) ([]uint, error) {
+	v, err := src.First()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read first migration: %w", err)
+	}
+
+	vs := []uint{v}
+	for {
+		next, err := src.Next(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			return vs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration after %d: %w", v, err)
+		}
+		vs = append(vs, next)
+		v = next
+	}
+}
+
+func (m *Migrator) steps(versions []uint, up bool) ([]*MigrationStep, error) {
+	var steps []*MigrationStep
+	for _, v := range versions {
+		read := m.src.ReadDown
+		if up {
+			read = m.src.ReadUp
+		}
+		r, ident, err := read(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Migrations without a file for this direction are no-ops.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %d: %w", v, err)
+		}
+		dat, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %d: %w", v, err)
+		}
+		steps = append(steps, &MigrationStep{
+			Version:    v,
+			Identifier: ident,
+			Up:         up,
+			SQL:        string(dat),
+		})
+	}
+	return steps, nil
+}
+
+// newMigrate returns a migrate instance for the given database, along with the
+// source of migrations it reads from.
+func newMigrate(db *sql.DB, migrationsPath string) (*migrate.Migrate, source.Driver, error) {
+	driver, err := migratesqlite3.WithInstance(db, &migratesqlite3.Config{
+		MigrationsTable: migratesqlite3.DefaultMigrationsTable,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init go-migrate driver: %w", err)
+	}
+
+	src, err := migrationSource(migrationsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := migrate.NewWithInstance("migrations", src, "sqlite3", driver)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return m, src, nil
+}
+
+func migrationSource(migrationsPath string) (source.Driver, error) {
+	if migrationsPath == "" {
+		src, err := iofs.New(migrations, "migrations")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load embedded migrations: %w", err)
+		}
+		return src, nil
+	}
+
+	rootedMigrationsPath, err := filepath.Abs(migrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a rooted migrations file path: %w", err)
+	}
+
+	src, err := (&file.File{}).Open("file://" + rootedMigrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations from %q: %w", migrationsPath, err)
+	}
+	return src, nil
+}
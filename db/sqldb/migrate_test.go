@@ -0,0 +1,334 @@
+package sqldb
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bcspragu/stronk"
+)
+
+const (
+	deciKilograms = stronk.WeightUnit("DECI_KILOGRAMS")
+
+	// achievementsVersion is the last version that stored weights as text.
+	achievementsVersion = 20261018162530
+	// numericWeightsVersion split weights into a value and a unit.
+	numericWeightsVersion = 20261018170214
+)
+
+func TestNumericWeightsMigration(t *testing.T) {
+	path, m := newTestMigrator(t, "")
+
+	if err := m.Goto(achievementsVersion); err != nil {
+		t.Fatalf("Goto(%d): %v", achievementsVersion, err)
+	}
+	stmts := []string{
+		`INSERT INTO exercises (name) VALUES ('SQUAT')`,
+		`INSERT INTO lifts (exercise_id, set_type, set_number, reps, weight, day_number, week_number, iteration_number)
+			VALUES (1, 'MAIN', 1, 5, '1775:DECI_POUNDS', 1, 1, 1), (1, 'MAIN', 2, 3, '805:DECI_KILOGRAMS', 1, 1, 1)`,
+		`INSERT INTO training_maxes (exercise_id, training_max_weight) VALUES (1, '2250:DECI_POUNDS')`,
+		`INSERT INTO smallest_denom (smallest_denom) VALUES ('50:DECI_POUNDS')`,
+		`INSERT INTO achievements (achievement_type, lift_id, weight, reps, previous_lift_id, previous_weight, previous_reps)
+			VALUES ('WEIGHT_PR', 1, '1775:DECI_POUNDS', 5, 2, '805:DECI_KILOGRAMS', 3)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := m.sql.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert text weights: %v", err)
+		}
+	}
+
+	if err := m.Goto(numericWeightsVersion); err != nil {
+		t.Fatalf("Goto(%d): %v", numericWeightsVersion, err)
+	}
+	numeric := []struct {
+		query string
+		want  []stronk.Weight
+	}{
+		{`SELECT weight_value, weight_unit FROM lifts ORDER BY id`, []stronk.Weight{{Value: 1775, Unit: stronk.DeciPounds}, {Value: 805, Unit: deciKilograms}}},
+		{`SELECT training_max_value, training_max_unit FROM training_maxes`, []stronk.Weight{{Value: 2250, Unit: stronk.DeciPounds}}},
+		{`SELECT smallest_denom_value, smallest_denom_unit FROM smallest_denom`, []stronk.Weight{{Value: 50, Unit: stronk.DeciPounds}}},
+		{`SELECT weight_value, weight_unit FROM achievements`, []stronk.Weight{{Value: 1775, Unit: stronk.DeciPounds}}},
+		{`SELECT previous_weight_value, previous_weight_unit FROM achievements`, []stronk.Weight{{Value: 805, Unit: deciKilograms}}},
+	}
+	for _, tc := range numeric {
+		rows, err := m.sql.Query(tc.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		var got []stronk.Weight
+		for rows.Next() {
+			var w stronk.Weight
+			if err := rows.Scan(&w.Value, &w.Unit); err != nil {
+				t.Fatalf("%q: failed to scan: %v", tc.query, err)
+			}
+			got = append(got, w)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("%q returned %v, want %v", tc.query, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%q returned %v, want %v", tc.query, got, tc.want)
+				break
+			}
+		}
+	}
+
+	// And back again, which should give us the text we started with.
+	if err := m.Goto(achievementsVersion); err != nil {
+		t.Fatalf("Goto(%d): %v", achievementsVersion, err)
+	}
+	text := []struct {
+		query string
+		want  []string
+	}{
+		{`SELECT weight FROM lifts ORDER BY id`, []string{"1775:DECI_POUNDS", "805:DECI_KILOGRAMS"}},
+		{`SELECT training_max_weight FROM training_maxes`, []string{"2250:DECI_POUNDS"}},
+		{`SELECT smallest_denom FROM smallest_denom`, []string{"50:DECI_POUNDS"}},
+		{`SELECT weight || ',' || previous_weight FROM achievements`, []string{"1775:DECI_POUNDS,805:DECI_KILOGRAMS"}},
+	}
+	for _, tc := range text {
+		rows, err := m.sql.Query(tc.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		var got []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatalf("%q: failed to scan: %v", tc.query, err)
+			}
+			got = append(got, s)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("%q returned %q, want %q", tc.query, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%q returned %q, want %q", tc.query, got, tc.want)
+				break
+			}
+		}
+	}
+
+	// Finally, the migrated data should be readable by the app.
+	if err := m.Goto(numericWeightsVersion); err != nil {
+		t.Fatalf("Goto(%d): %v", numericWeightsVersion, err)
+	}
+	db, err := New(path, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	denom, err := db.SmallestDenom(ctx)
+	if err != nil {
+		t.Fatalf("SmallestDenom: %v", err)
+	}
+	if want := (stronk.Weight{Value: 50, Unit: stronk.DeciPounds}); denom != want {
+		t.Errorf("smallest denom was %v, want %v", denom, want)
+	}
+	lifts, err := db.RecentLifts(ctx)
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if len(lifts) != 2 || lifts[0].Weight != (stronk.Weight{Value: 805, Unit: deciKilograms}) {
+		t.Errorf("unexpected lifts after migrating: %+v", lifts)
+	}
+}
+
+func TestNewMigratorMissingDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stornk.db")
+	if _, err := NewMigrator(path, ""); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("NewMigrator on a missing DB returned %v, want fs.ErrNotExist", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("NewMigrator created a DB at the missing path, stat returned %v", err)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	_, m := newTestMigrator(t, "")
+	versions, err := m.versions()
+	if err != nil {
+		t.Fatalf("failed to load versions: %v", err)
+	}
+	if len(versions) < 3 {
+		t.Fatalf("got %d migrations, want at least 3 for this test", len(versions))
+	}
+	latest := versions[len(versions)-1]
+
+	wantStatus := func(want *MigrationStatus) {
+		t.Helper()
+		got, err := m.Status()
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Status() = %+v, want %+v", got, want)
+		}
+	}
+	wantSteps := func(steps []*MigrationStep, up bool, want ...uint) {
+		t.Helper()
+		var got []uint
+		for _, s := range steps {
+			got = append(got, s.Version)
+			if s.Up != up {
+				t.Errorf("step %d had Up = %t, want %t", s.Version, s.Up, up)
+			}
+			if s.SQL == "" || s.Identifier == "" {
+				t.Errorf("step %d was missing its SQL or identifier: %+v", s.Version, s)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got steps %v, want %v", got, want)
+		}
+	}
+
+	wantStatus(&MigrationStatus{Latest: latest, Pending: versions})
+	steps, err := m.PlanUp()
+	if err != nil {
+		t.Fatalf("PlanUp: %v", err)
+	}
+	wantSteps(steps, true, versions...)
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	wantStatus(&MigrationStatus{Version: latest, Latest: latest})
+	if steps, err = m.PlanUp(); err != nil {
+		t.Fatalf("PlanUp: %v", err)
+	}
+	wantSteps(steps, true)
+
+	// Rolling back goes newest first.
+	if steps, err = m.PlanDown(2); err != nil {
+		t.Fatalf("PlanDown: %v", err)
+	}
+	wantSteps(steps, false, latest, versions[len(versions)-2])
+	if _, err := m.PlanDown(0); err == nil {
+		t.Error("PlanDown(0) succeeded, want an error")
+	}
+	if _, err := m.PlanDown(len(versions) + 1); err == nil {
+		t.Error("PlanDown with more migrations than were applied succeeded, want an error")
+	}
+	if err := m.Down(2); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	prev := versions[len(versions)-3]
+	wantStatus(&MigrationStatus{Version: prev, Latest: latest, Pending: versions[len(versions)-2:]})
+
+	if steps, err = m.PlanGoto(latest); err != nil {
+		t.Fatalf("PlanGoto: %v", err)
+	}
+	wantSteps(steps, true, versions[len(versions)-2:]...)
+	if steps, err = m.PlanGoto(versions[0]); err != nil {
+		t.Fatalf("PlanGoto: %v", err)
+	}
+	var down []uint
+	for i := len(versions) - 3; i > 0; i-- {
+		down = append(down, versions[i])
+	}
+	wantSteps(steps, false, down...)
+	if _, err := m.PlanGoto(prev + 1); err == nil {
+		t.Error("PlanGoto to a version not in the migration set succeeded, want an error")
+	}
+
+	if err := m.Goto(latest); err != nil {
+		t.Fatalf("Goto: %v", err)
+	}
+	wantStatus(&MigrationStatus{Version: latest, Latest: latest})
+
+	// Forcing doesn't run anything, it just changes the recorded version.
+	if err := m.Force(prev); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	wantStatus(&MigrationStatus{Version: prev, Latest: latest, Pending: versions[len(versions)-2:]})
+	if err := m.Force(0); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	wantStatus(&MigrationStatus{Latest: latest, Pending: versions})
+}
+
+func TestMigratorDirty(t *testing.T) {
+	dir := t.TempDir()
+	writeMigration := func(name, sql string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	writeMigration("1_first.up.sql", "CREATE TABLE first (id INTEGER);")
+	writeMigration("1_first.down.sql", "DROP TABLE first;")
+	writeMigration("2_second.up.sql", "CREATE TABLE second (id INTEGER); NOT SQL;")
+	writeMigration("2_second.down.sql", "DROP TABLE second;")
+
+	_, m := newTestMigrator(t, dir)
+	if err := m.Up(); err == nil {
+		t.Fatal("Up with a broken migration succeeded, want an error")
+	}
+	got, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if want := (&MigrationStatus{Version: 2, Dirty: true, Latest: 2}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Status() after failed migration = %+v, want %+v", got, want)
+	}
+
+	// Nothing runs against a dirty database until it's been fixed by hand.
+	if err := m.Up(); err == nil || !strings.Contains(err.Error(), "Dirty") {
+		t.Errorf("Up on a dirty DB returned %v, want a dirty error", err)
+	}
+	if err := m.Goto(1); err == nil {
+		t.Error("Goto on a dirty DB succeeded, want an error")
+	}
+
+	writeMigration("2_second.up.sql", "CREATE TABLE IF NOT EXISTS second (id INTEGER);")
+	if err := m.Force(1); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	if got, err = m.Status(); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if want := (&MigrationStatus{Version: 1, Latest: 2, Pending: []uint{2}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Status() after forcing = %+v, want %+v", got, want)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up after fixing the migration: %v", err)
+	}
+	if _, err := m.sql.Exec("INSERT INTO second (id) VALUES (1)"); err != nil {
+		t.Errorf("failed to use table from fixed migration: %v", err)
+	}
+}
+
+// newTestMigrator creates an empty database, and returns its path and a
+// Migrator for it.
+func newTestMigrator(t *testing.T, migrationsPath string) (string, *Migrator) {
+	path := filepath.Join(t.TempDir(), "stronk.db")
+	// An empty file is an empty SQLite database.
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("failed to create DB: %v", err)
+	}
+	m, err := NewMigrator(path, migrationsPath)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := m.Close(); err != nil {
+			t.Errorf("failed to close migrator: %v", err)
+		}
+	})
+	return path, m
+}
@@ -0,0 +1 @@
+ALTER TABLE lifts DROP COLUMN extra_set;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE lifts
+ADD COLUMN extra_set TEXT CHECK( extra_set IN ('JOKER', 'FIRST_SET_LAST') );
\ No newline at end of file
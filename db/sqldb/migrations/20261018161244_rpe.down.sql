@@ -0,0 +1,2 @@
+ALTER TABLE lifts DROP COLUMN reps_in_reserve;
+ALTER TABLE lifts DROP COLUMN rpe;
\ No newline at end of file
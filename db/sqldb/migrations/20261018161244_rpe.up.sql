@@ -0,0 +1,5 @@
+ALTER TABLE lifts
+ADD COLUMN rpe REAL;
+
+ALTER TABLE lifts
+ADD COLUMN reps_in_reserve INTEGER;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE achievements;
\ No newline at end of file
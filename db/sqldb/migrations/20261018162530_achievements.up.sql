@@ -0,0 +1,13 @@
+CREATE TABLE achievements (
+  id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+  achievement_type TEXT CHECK( achievement_type IN ('ONE_REP_MAX_PR', 'REP_PR', 'WEIGHT_PR') ) NOT NULL,
+  lift_id INTEGER NOT NULL,
+  weight TEXT NOT NULL,
+  reps INTEGER NOT NULL,
+  previous_lift_id INTEGER NOT NULL,
+  previous_weight TEXT NOT NULL,
+  previous_reps INTEGER NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (lift_id) REFERENCES lifts (id),
+  FOREIGN KEY (previous_lift_id) REFERENCES lifts (id)
+);
@@ -0,0 +1,26 @@
+DROP INDEX lifts_exercise_weight;
+
+ALTER TABLE achievements ADD COLUMN weight TEXT NOT NULL DEFAULT '';
+ALTER TABLE achievements ADD COLUMN previous_weight TEXT NOT NULL DEFAULT '';
+UPDATE achievements SET
+  weight = weight_value || ':' || weight_unit,
+  previous_weight = previous_weight_value || ':' || previous_weight_unit;
+ALTER TABLE achievements DROP COLUMN weight_value;
+ALTER TABLE achievements DROP COLUMN weight_unit;
+ALTER TABLE achievements DROP COLUMN previous_weight_value;
+ALTER TABLE achievements DROP COLUMN previous_weight_unit;
+
+ALTER TABLE smallest_denom ADD COLUMN smallest_denom TEXT NOT NULL DEFAULT '';
+UPDATE smallest_denom SET smallest_denom = smallest_denom_value || ':' || smallest_denom_unit;
+ALTER TABLE smallest_denom DROP COLUMN smallest_denom_value;
+ALTER TABLE smallest_denom DROP COLUMN smallest_denom_unit;
+
+ALTER TABLE training_maxes ADD COLUMN training_max_weight TEXT NOT NULL DEFAULT '';
+UPDATE training_maxes SET training_max_weight = training_max_value || ':' || training_max_unit;
+ALTER TABLE training_maxes DROP COLUMN training_max_value;
+ALTER TABLE training_maxes DROP COLUMN training_max_unit;
+
+ALTER TABLE lifts ADD COLUMN weight TEXT NOT NULL DEFAULT '';
+UPDATE lifts SET weight = weight_value || ':' || weight_unit;
+ALTER TABLE lifts DROP COLUMN weight_value;
+ALTER TABLE lifts DROP COLUMN weight_unit;
@@ -0,0 +1,36 @@
+-- Weights were stored as text like "1775:DECI_POUNDS", split them into a value
+-- and a unit so that we can do math on them in queries.
+ALTER TABLE lifts ADD COLUMN weight_value INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE lifts ADD COLUMN weight_unit TEXT NOT NULL DEFAULT 'DECI_POUNDS';
+UPDATE lifts SET
+  weight_value = CAST(substr(weight, 1, instr(weight, ':') - 1) AS INTEGER),
+  weight_unit = substr(weight, instr(weight, ':') + 1);
+ALTER TABLE lifts DROP COLUMN weight;
+
+ALTER TABLE training_maxes ADD COLUMN training_max_value INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE training_maxes ADD COLUMN training_max_unit TEXT NOT NULL DEFAULT 'DECI_POUNDS';
+UPDATE training_maxes SET
+  training_max_value = CAST(substr(training_max_weight, 1, instr(training_max_weight, ':') - 1) AS INTEGER),
+  training_max_unit = substr(training_max_weight, instr(training_max_weight, ':') + 1);
+ALTER TABLE training_maxes DROP COLUMN training_max_weight;
+
+ALTER TABLE smallest_denom ADD COLUMN smallest_denom_value INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE smallest_denom ADD COLUMN smallest_denom_unit TEXT NOT NULL DEFAULT 'DECI_POUNDS';
+UPDATE smallest_denom SET
+  smallest_denom_value = CAST(substr(smallest_denom, 1, instr(smallest_denom, ':') - 1) AS INTEGER),
+  smallest_denom_unit = substr(smallest_denom, instr(smallest_denom, ':') + 1);
+ALTER TABLE smallest_denom DROP COLUMN smallest_denom;
+
+ALTER TABLE achievements ADD COLUMN weight_value INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE achievements ADD COLUMN weight_unit TEXT NOT NULL DEFAULT 'DECI_POUNDS';
+ALTER TABLE achievements ADD COLUMN previous_weight_value INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE achievements ADD COLUMN previous_weight_unit TEXT NOT NULL DEFAULT 'DECI_POUNDS';
+UPDATE achievements SET
+  weight_value = CAST(substr(weight, 1, instr(weight, ':') - 1) AS INTEGER),
+  weight_unit = substr(weight, instr(weight, ':') + 1),
+  previous_weight_value = CAST(substr(previous_weight, 1, instr(previous_weight, ':') - 1) AS INTEGER),
+  previous_weight_unit = substr(previous_weight, instr(previous_weight, ':') + 1);
+ALTER TABLE achievements DROP COLUMN weight;
+ALTER TABLE achievements DROP COLUMN previous_weight;
+
+CREATE INDEX lifts_exercise_weight ON lifts (exercise_id, weight_unit, weight_value);
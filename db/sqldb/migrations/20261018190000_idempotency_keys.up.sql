@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+  idempotency_key TEXT PRIMARY KEY NOT NULL,
+  request_path TEXT NOT NULL,
+  request_hash TEXT NOT NULL,
+  response_status INTEGER NOT NULL,
+  response_body BLOB,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -2,59 +2,78 @@
 package sqldb
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"errors"
 	"fmt"
 	"log"
-	"path/filepath"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/bcspragu/stronk"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/mattn/go-sqlite3"
-
-	migratesqlite3 "github.com/golang-migrate/migrate/v4/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 type DB struct {
-	mu          sync.Mutex
-	sql         *sql.DB
+	// rw is limited to a single connection, which serializes writes without
+	// SQLite having to return SQLITE_BUSY.
+	rw *sql.DB
+	// ro is a pool of read-only connections. In WAL mode, readers see the last
+	// committed state and don't block on (or block) the writer.
+	ro          *sql.DB
 	mainLiftIDs map[stronk.Exercise]int
 }
 
 func (db *DB) Close() error {
-	return db.sql.Close()
+	roErr, rwErr := db.ro.Close(), db.rw.Close()
+	if roErr != nil {
+		return fmt.Errorf("failed to close read-only DB: %w", roErr)
+	}
+	if rwErr != nil {
+		return fmt.Errorf("failed to close read-write DB: %w", rwErr)
+	}
+	return nil
 }
 
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-func (db *DB) EditLift(id stronk.LiftID, note string, reps int) error {
-	return db.transact(func(tx *sql.Tx) error {
+func (db *DB) EditLift(ctx context.Context, id stronk.LiftID, note string, reps int, rpe float64, rir *int) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
 		q := `
 UPDATE lifts
-	SET reps = ?, lift_note = ?
+	SET reps = ?, lift_note = ?, rpe = ?, reps_in_reserve = ?
 WHERE id = ?
 `
-		_, err := tx.Exec(q, reps, note, id)
-		return err
+		res, err := tx.ExecContext(ctx, q, reps, note, nullFloat(rpe), nullInt(rir), id)
+		if err != nil {
+			return fmt.Errorf("failed to update lift: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to check updated rows: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("lift %d not found", id)
+		}
+		return nil
 	})
 }
 
-func (db *DB) Lift(id stronk.LiftID) (*stronk.Lift, error) {
+func (db *DB) Lift(ctx context.Context, id stronk.LiftID) (*stronk.Lift, error) {
 	var lift *stronk.Lift
-	err := db.transact(func(tx *sql.Tx) error {
+	err := db.read(ctx, func(tx *sql.Tx) error {
 		q := `
-SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure
+SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at
 FROM lifts
 JOIN exercises
 	ON lifts.exercise_id = exercises.id
 WHERE lifts.id = ?`
 
-		rows, err := tx.Query(q, id)
+		rows, err := tx.QueryContext(ctx, q, id)
 		if err != nil {
 			return fmt.Errorf("failed to query training_maxes: %w", err)
 		}
@@ -74,106 +93,526 @@ WHERE lifts.id = ?`
 	return lift, nil
 }
 
-func (db *DB) RecordLift(ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool) (stronk.LiftID, error) {
+func (db *DB) RecordLift(ctx context.Context, ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool, extra stronk.ExtraSet, rpe float64, rir *int) (stronk.LiftID, error) {
+	l := &stronk.Lift{
+		Exercise:        ex,
+		SetType:         st,
+		Weight:          weight,
+		SetNumber:       set,
+		Reps:            reps,
+		Note:            note,
+		DayNumber:       day,
+		WeekNumber:      week,
+		IterationNumber: iter,
+		ToFailure:       toFailure,
+		Extra:           extra,
+		RPE:             rpe,
+		RIR:             rir,
+	}
 	var id stronk.LiftID
-	err := db.transact(func(tx *sql.Tx) error {
-		q := `INSERT INTO lifts
-(exercise_id, set_type, set_number, reps, weight, day_number, week_number, iteration_number, lift_note, to_failure)
-VALUES ((SELECT id FROM exercises WHERE name = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	err := db.transact(ctx, func(tx *sql.Tx) (err error) {
+		id, err = insertLift(ctx, tx, l)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (db *DB) RecordNextLift(ctx context.Context, l *stronk.Lift, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error, achieve func(stronk.LiftID, []*stronk.Lift) []*stronk.Achievement) (stronk.LiftID, *stronk.WorkoutContext, error) {
+	var (
+		id stronk.LiftID
+		wc *stronk.WorkoutContext
+	)
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		// Write transactions hold the only read-write connection and take the
+		// write lock upfront, so nothing else can change things under us.
+		before, err := queryWorkoutContext(ctx, tx, exs)
+		if err != nil {
+			return err
+		}
+		if err := check(before); err != nil {
+			return err
+		}
+		if id, err = insertLift(ctx, tx, l); err != nil {
+			return err
+		}
+		if achieve != nil {
+			history, err := queryLiftHistory(ctx, tx, stronk.LiftFilter{Exercise: l.Exercise})
+			if err != nil {
+				return err
+			}
+			if err := insertAchievements(ctx, tx, achieve(id, history)); err != nil {
+				return err
+			}
+		}
+		wc, err = queryWorkoutContext(ctx, tx, exs)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, wc, nil
+}
+
+// insertLift records a new lift, creating its exercise if it doesn't exist,
+// since exercises outside of the main lifts (e.g. for assistance work) might
+// not have been seen before.
+func insertLift(ctx context.Context, tx *sql.Tx, l *stronk.Lift) (stronk.LiftID, error) {
+	if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO exercises (name) VALUES (?)`, l.Exercise); err != nil {
+		return 0, fmt.Errorf("failed to insert exercise: %w", err)
+	}
+
+	q := `INSERT INTO lifts
+(exercise_id, set_type, set_number, reps, weight_value, weight_unit, day_number, week_number, iteration_number, lift_note, to_failure, extra_set, rpe, reps_in_reserve, created_at)
+VALUES ((SELECT id FROM exercises WHERE name = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))
 RETURNING lifts.id`
-		if err := tx.QueryRow(q, ex, st, set, reps, &sqlWeight{&weight}, day, week, iter, nullString(note), toFailure).Scan(&id); err != nil {
-			return fmt.Errorf("failed to insert lift: %w", err)
+	var id stronk.LiftID
+	if err := tx.QueryRowContext(ctx, q, l.Exercise, l.SetType, l.SetNumber, l.Reps, l.Weight.Value, l.Weight.Unit, l.DayNumber, l.WeekNumber, l.IterationNumber, nullString(l.Note), l.ToFailure, nullString(string(l.Extra)), nullFloat(l.RPE), nullInt(l.RIR), nullTime(l.CreatedAt)).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert lift: %w", err)
+	}
+	return id, nil
+}
+
+func (db *DB) RecordAchievements(ctx context.Context, achs []*stronk.Achievement) error {
+	if len(achs) == 0 {
+		return nil
+	}
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		return insertAchievements(ctx, tx, achs)
+	})
+}
+
+func insertAchievements(ctx context.Context, tx *sql.Tx, achs []*stronk.Achievement) error {
+	q := `INSERT INTO achievements
+(achievement_type, lift_id, weight_value, weight_unit, reps, previous_lift_id, previous_weight_value, previous_weight_unit, previous_reps)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, a := range achs {
+		if _, err := tx.ExecContext(ctx, q, a.Type, a.LiftID, a.Weight.Value, a.Weight.Unit, a.Reps, a.PreviousLiftID, a.PreviousWeight.Value, a.PreviousWeight.Unit, a.PreviousReps); err != nil {
+			return fmt.Errorf("failed to insert achievement: %w", err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) Achievements(ctx context.Context, ex stronk.Exercise) ([]*stronk.Achievement, error) {
+	var achs []*stronk.Achievement
+	err := db.read(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT achievements.achievement_type, exercises.name, achievements.lift_id, achievements.weight_value, achievements.weight_unit, achievements.reps, achievements.previous_lift_id, achievements.previous_weight_value, achievements.previous_weight_unit, achievements.previous_reps, lifts.created_at
+FROM achievements
+JOIN lifts
+	ON achievements.lift_id = lifts.id
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+WHERE ? = '' OR exercises.name = ?
+ORDER BY lifts.created_at DESC, lifts.id DESC, achievements.id ASC`
+
+		rows, err := tx.QueryContext(ctx, q, ex, ex)
+		if err != nil {
+			return fmt.Errorf("failed to query achievements: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var a stronk.Achievement
+			if err := rows.Scan(
+				&a.Type, &a.Exercise, &a.LiftID, &a.Weight.Value, &a.Weight.Unit, &a.Reps,
+				&a.PreviousLiftID, &a.PreviousWeight.Value, &a.PreviousWeight.Unit, &a.PreviousReps,
+				&a.AchievedAt); err != nil {
+				return fmt.Errorf("failed to scan achievement: %w", err)
+			}
+			achs = append(achs, &a)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to scan achievements: %w", err)
 		}
 		return nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("failed to load achievements: %w", err)
 	}
-	return id, nil
+	return achs, nil
 }
 
-func (db *DB) SkippedWeeks() ([]stronk.SkippedWeek, error) {
+func (db *DB) SkippedWeeks(ctx context.Context) ([]stronk.SkippedWeek, error) {
 	var weeks []stronk.SkippedWeek
-	err := db.transact(func(tx *sql.Tx) error {
-		q := `
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		weeks, err = querySkippedWeeks(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load skipped weeks: %w", err)
+	}
+	return weeks, nil
+}
+
+func querySkippedWeeks(ctx context.Context, tx *sql.Tx) ([]stronk.SkippedWeek, error) {
+	q := `
 SELECT week_number, iteration_number, note
 FROM skipped_weeks
-ORDER BY iteration_number DESC, week_number DESC
+ORDER BY iteration_number DESC, week_number DESC, id DESC
 LIMIT 100`
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query skipped weeks: %w", err)
+	}
+	weeks, err := skippedWeeks(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan skipped weeks: %w", err)
+	}
+	return weeks, nil
+}
+
+func (db *DB) SkipWeek(ctx context.Context, note string, week, iter int) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		return insertSkippedWeek(ctx, tx, note, week, iter)
+	})
+}
 
-		rows, err := tx.Query(q)
+func (db *DB) SkipNextWeek(ctx context.Context, note string, week, iter int, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error) (*stronk.WorkoutContext, error) {
+	var wc *stronk.WorkoutContext
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		// Like RecordNextLift, we hold the write lock for the whole check.
+		before, err := queryWorkoutContext(ctx, tx, exs)
 		if err != nil {
-			return fmt.Errorf("failed to query skipped weeks: %w", err)
+			return err
 		}
-		if weeks, err = skippedWeeks(rows); err != nil {
-			return fmt.Errorf("failed to scan skipped weeks: %w", err)
+		if err := check(before); err != nil {
+			return err
 		}
-		return nil
+		if err := insertSkippedWeek(ctx, tx, note, week, iter); err != nil {
+			return err
+		}
+		wc, err = queryWorkoutContext(ctx, tx, exs)
+		return err
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to load skipped weeks: %w", err)
+		return nil, err
 	}
-	return weeks, nil
+	return wc, nil
 }
 
-func (db *DB) SkipWeek(note string, week, iter int) error {
-	return db.transact(func(tx *sql.Tx) error {
-		q := `INSERT INTO skipped_weeks
+func insertSkippedWeek(ctx context.Context, tx *sql.Tx, note string, week, iter int) error {
+	q := `INSERT INTO skipped_weeks
 (week_number, iteration_number, note)
 VALUES (?, ?, ?)`
-		if _, err := tx.Exec(q, week, iter, note); err != nil {
-			return fmt.Errorf("failed to insert skipped week: %w", err)
-		}
-		return nil
-	})
+	if _, err := tx.ExecContext(ctx, q, week, iter, note); err != nil {
+		return fmt.Errorf("failed to insert skipped week: %w", err)
+	}
+	return nil
 }
 
-func (db *DB) ComparableLifts(ex stronk.Exercise, weight stronk.Weight) (*stronk.ComparableLifts, error) {
-	// We want to find two comparable lifts:
-	//  1. The closest in weight, breaking ties by highest ORM equivalent ("Most Similar")
-	//  2. The highest ORM equivalent reps, period. ("PR")
-	var lfs []*stronk.Lift
-	err := db.transact(func(tx *sql.Tx) error {
+func (db *DB) ExportData(ctx context.Context) (*stronk.UserData, error) {
+	data := &stronk.UserData{}
+	err := db.read(ctx, func(tx *sql.Tx) error {
 		q := `
-SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure
+SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at
 FROM lifts
 JOIN exercises
 	ON lifts.exercise_id = exercises.id
-WHERE exercises.name = ?
-	AND to_failure = TRUE
-ORDER BY iteration_number DESC, week_number DESC, day_number DESC, lifts.created_at DESC
-LIMIT 250`
-
-		rows, err := tx.Query(q, ex)
+ORDER BY lifts.created_at ASC, lifts.id ASC`
+		rows, err := tx.QueryContext(ctx, q)
 		if err != nil {
 			return fmt.Errorf("failed to query lifts: %w", err)
 		}
-		if lfs, err = lifts(rows); err != nil {
+		if data.Lifts, err = lifts(rows); err != nil {
 			return fmt.Errorf("failed to scan lifts: %w", err)
 		}
+
+		q = `
+SELECT exercises.name, training_maxes.training_max_value, training_maxes.training_max_unit, training_maxes.created_at
+FROM training_maxes
+JOIN exercises
+	ON training_maxes.exercise_id = exercises.id
+ORDER BY training_maxes.created_at ASC, training_maxes.id ASC`
+		if rows, err = tx.QueryContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to query training_maxes: %w", err)
+		}
+		if data.TrainingMaxes, err = trainingMaxes(rows); err != nil {
+			return fmt.Errorf("failed to scan training_maxes: %w", err)
+		}
+
+		q = `
+SELECT smallest_denom_value, smallest_denom_unit, created_at
+FROM smallest_denom
+ORDER BY created_at ASC, id ASC`
+		if rows, err = tx.QueryContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to query smallest_denom: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sd stronk.SmallestDenom
+			if err := rows.Scan(&sd.Weight.Value, &sd.Weight.Unit, &sd.SetAt); err != nil {
+				return fmt.Errorf("failed to scan smallest denominator: %w", err)
+			}
+			data.SmallestDenoms = append(data.SmallestDenoms, &sd)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to scan smallest denominators: %w", err)
+		}
+
+		q = `
+SELECT week_number, iteration_number, note
+FROM skipped_weeks
+ORDER BY created_at ASC, id ASC`
+		if rows, err = tx.QueryContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to query skipped weeks: %w", err)
+		}
+		if data.SkippedWeeks, err = skippedWeeks(rows); err != nil {
+			return fmt.Errorf("failed to scan skipped weeks: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+	return data, nil
+}
+
+func (db *DB) ImportData(ctx context.Context, data *stronk.UserData) (*stronk.ImportResult, error) {
+	res := &stronk.ImportResult{}
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		// exists runs a SELECT EXISTS(...) query.
+		exists := func(q string, args ...interface{}) (bool, error) {
+			var found bool
+			if err := tx.QueryRowContext(ctx, q, args...).Scan(&found); err != nil {
+				return false, err
+			}
+			return found, nil
+		}
+		addExercise := func(ex stronk.Exercise) error {
+			if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO exercises (name) VALUES (?)`, ex); err != nil {
+				return fmt.Errorf("failed to insert exercise %q: %w", ex, err)
+			}
+			return nil
+		}
+
+		for _, l := range data.Lifts {
+			if err := addExercise(l.Exercise); err != nil {
+				return err
+			}
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM lifts
+	JOIN exercises
+		ON lifts.exercise_id = exercises.id
+	WHERE exercises.name = ?
+		AND lifts.set_type = ?
+		AND lifts.set_number = ?
+		AND lifts.day_number = ?
+		AND lifts.week_number = ?
+		AND lifts.iteration_number = ?
+		AND COALESCE(lifts.extra_set, '') = ?
+		AND lifts.created_at = ?
+)`, l.Exercise, l.SetType, l.SetNumber, l.DayNumber, l.WeekNumber, l.IterationNumber, l.Extra, sqlTime(l.CreatedAt))
+			if err != nil {
+				return fmt.Errorf("failed to check for existing lift: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO lifts
+(exercise_id, set_type, set_number, reps, weight_value, weight_unit, day_number, week_number, iteration_number, lift_note, to_failure, extra_set, rpe, reps_in_reserve, created_at)
+VALUES ((SELECT id FROM exercises WHERE name = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			if _, err := tx.ExecContext(ctx, q, l.Exercise, l.SetType, l.SetNumber, l.Reps, l.Weight.Value, l.Weight.Unit, l.DayNumber, l.WeekNumber, l.IterationNumber, nullString(l.Note), l.ToFailure, nullString(string(l.Extra)), nullFloat(l.RPE), nullInt(l.RIR), sqlTime(l.CreatedAt)); err != nil {
+				return fmt.Errorf("failed to insert lift: %w", err)
+			}
+			res.Lifts++
+		}
+
+		for _, tm := range data.TrainingMaxes {
+			if err := addExercise(tm.Exercise); err != nil {
+				return err
+			}
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM training_maxes
+	JOIN exercises
+		ON training_maxes.exercise_id = exercises.id
+	WHERE exercises.name = ?
+		AND training_maxes.training_max_value = ?
+		AND training_maxes.training_max_unit = ?
+		AND training_maxes.created_at = ?
+)`, tm.Exercise, tm.Max.Value, tm.Max.Unit, sqlTime(tm.SetAt))
+			if err != nil {
+				return fmt.Errorf("failed to check for existing training max: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO training_maxes
+(exercise_id, training_max_value, training_max_unit, created_at)
+VALUES ((SELECT id FROM exercises WHERE name = ?), ?, ?, ?)`
+			if _, err := tx.ExecContext(ctx, q, tm.Exercise, tm.Max.Value, tm.Max.Unit, sqlTime(tm.SetAt)); err != nil {
+				return fmt.Errorf("failed to insert training max: %w", err)
+			}
+			res.TrainingMaxes++
+		}
+
+		for _, sd := range data.SmallestDenoms {
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM smallest_denom
+	WHERE smallest_denom_value = ?
+		AND smallest_denom_unit = ?
+		AND created_at = ?
+)`, sd.Weight.Value, sd.Weight.Unit, sqlTime(sd.SetAt))
+			if err != nil {
+				return fmt.Errorf("failed to check for existing smallest denominator: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO smallest_denom (smallest_denom_value, smallest_denom_unit, created_at) VALUES (?, ?, ?)`
+			if _, err := tx.ExecContext(ctx, q, sd.Weight.Value, sd.Weight.Unit, sqlTime(sd.SetAt)); err != nil {
+				return fmt.Errorf("failed to insert smallest denominator: %w", err)
+			}
+			res.SmallestDenoms++
+		}
+
+		for _, wk := range data.SkippedWeeks {
+			found, err := exists(`
+SELECT EXISTS(
+	SELECT 1
+	FROM skipped_weeks
+	WHERE week_number = ?
+		AND iteration_number = ?
+)`, wk.Week, wk.Iteration)
+			if err != nil {
+				return fmt.Errorf("failed to check for existing skipped week: %w", err)
+			}
+			if found {
+				res.Duplicates++
+				continue
+			}
+
+			q := `INSERT INTO skipped_weeks (week_number, iteration_number, note) VALUES (?, ?, ?)`
+			if _, err := tx.ExecContext(ctx, q, wk.Week, wk.Iteration, wk.Note); err != nil {
+				return fmt.Errorf("failed to insert skipped week: %w", err)
+			}
+			res.SkippedWeeks++
+		}
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to load comparables: %w", err)
+		return nil, fmt.Errorf("failed to import data: %w", err)
+	}
+	return res, nil
+}
+
+// oneRepMaxExpr mirrors stronk.Lift.AsRPEOneRepMax: Epley on reps plus reps in
+// reserve, falling back to 10 - RPE when only RPE was recorded, capped at
+// stronk.MaxRepsInReserve.
+const oneRepMaxExpr = `CAST(lifts.weight_value + 0.033333333 * lifts.weight_value * (lifts.reps + MIN(COALESCE(lifts.reps_in_reserve, CASE WHEN lifts.rpe IS NULL THEN 0 ELSE 10 - lifts.rpe END), 4)) AS INTEGER)`
+
+func (db *DB) WorkoutContext(ctx context.Context, exs []stronk.Exercise) (*stronk.WorkoutContext, error) {
+	var wc *stronk.WorkoutContext
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		wc, err = queryWorkoutContext(ctx, tx, exs)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return wc, nil
+}
 
-	return stronk.CalcComparables(lfs, weight), nil
+func queryWorkoutContext(ctx context.Context, tx *sql.Tx, exs []stronk.Exercise) (*stronk.WorkoutContext, error) {
+	wc := &stronk.WorkoutContext{}
+	var err error
+	if wc.RecentLifts, err = queryRecentLifts(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.SkippedWeeks, err = querySkippedWeeks(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.TrainingMaxes, err = queryTrainingMaxes(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.SmallestDenom, err = querySmallestDenom(ctx, tx); err != nil {
+		return nil, err
+	}
+	if wc.FailureSets, err = queryFailureSets(ctx, tx, exs); err != nil {
+		return nil, err
+	}
+	return wc, nil
 }
 
-func (db *DB) RecentFailureSets() ([]*stronk.Lift, error) {
+// queryFailureSets loads the best to-failure lift at each weight for the given
+// exercises, most recent first, see stronk.WorkoutContext.FailureSets.
+func queryFailureSets(ctx context.Context, tx *sql.Tx, exs []stronk.Exercise) (map[stronk.Exercise][]*stronk.Lift, error) {
+	out := make(map[stronk.Exercise][]*stronk.Lift)
+	if len(exs) == 0 {
+		return out, nil
+	}
+
+	q := fmt.Sprintf(`
+WITH ranked AS (
+	SELECT lifts.id, ROW_NUMBER() OVER (
+		PARTITION BY lifts.exercise_id, lifts.weight_unit, lifts.weight_value
+		ORDER BY `+oneRepMaxExpr+` DESC, lifts.iteration_number DESC, lifts.week_number DESC, lifts.day_number DESC, lifts.created_at DESC, lifts.id DESC
+	) AS weight_rank
+	FROM lifts
+	JOIN exercises
+		ON lifts.exercise_id = exercises.id
+	WHERE exercises.name IN %s
+		AND lifts.to_failure = TRUE
+)
+SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+JOIN ranked
+	ON lifts.id = ranked.id
+WHERE ranked.weight_rank = 1
+ORDER BY lifts.iteration_number DESC, lifts.week_number DESC, lifts.day_number DESC, lifts.created_at DESC, lifts.id DESC`, repeatedArgs(len(exs)))
+
+	var args []interface{}
+	for _, ex := range exs {
+		args = append(args, ex)
+	}
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failure sets: %w", err)
+	}
+	lfs, err := lifts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan failure sets: %w", err)
+	}
+	for _, l := range lfs {
+		out[l.Exercise] = append(out[l.Exercise], l)
+	}
+	return out, nil
+}
+
+func (db *DB) RecentFailureSets(ctx context.Context) ([]*stronk.Lift, error) {
 	var lfs []*stronk.Lift
-	err := db.transact(func(tx *sql.Tx) error {
+	err := db.read(ctx, func(tx *sql.Tx) error {
 		q := `
-SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure
+SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at
 FROM lifts
 JOIN exercises
 	ON lifts.exercise_id = exercises.id
 WHERE set_type = 'MAIN'
 	AND to_failure = TRUE
-ORDER BY iteration_number DESC, week_number DESC, day_number DESC, lifts.created_at DESC
+	AND extra_set IS NULL
+	AND iteration_number >= 0
+ORDER BY iteration_number DESC, week_number DESC, day_number DESC, lifts.created_at DESC, lifts.id DESC
 LIMIT 250`
 
-		rows, err := tx.Query(q)
+		rows, err := tx.QueryContext(ctx, q)
 		if err != nil {
 			return fmt.Errorf("failed to query training_maxes: %w", err)
 		}
@@ -188,37 +627,190 @@ LIMIT 250`
 	return lfs, nil
 }
 
-func (db *DB) RecentLifts() ([]*stronk.Lift, error) {
+func (db *DB) LiftHistory(ctx context.Context, filter stronk.LiftFilter) ([]*stronk.Lift, error) {
 	var lfs []*stronk.Lift
-	err := db.transact(func(tx *sql.Tx) error {
-		q := `
-SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		lfs, err = queryLiftHistory(ctx, tx, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lfs, nil
+}
+
+func queryLiftHistory(ctx context.Context, tx *sql.Tx, filter stronk.LiftFilter) ([]*stronk.Lift, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.Exercise != "" {
+		where = append(where, "exercises.name = ?")
+		args = append(args, filter.Exercise)
+	}
+	if filter.SetType != "" {
+		where = append(where, "lifts.set_type = ?")
+		args = append(args, filter.SetType)
+	}
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, "\n\tAND ")
+	}
+
+	q := fmt.Sprintf(`
+SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at
 FROM lifts
 JOIN exercises
 	ON lifts.exercise_id = exercises.id
-ORDER BY iteration_number DESC, week_number DESC, day_number DESC, lifts.created_at DESC
+%s
+ORDER BY lifts.created_at ASC, lifts.id ASC`, whereClause)
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lift history: %w", err)
+	}
+	lfs, err := lifts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan lift history: %w", err)
+	}
+	return lfs, nil
+}
+
+func (db *DB) RecentLifts(ctx context.Context) ([]*stronk.Lift, error) {
+	var lfs []*stronk.Lift
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		lfs, err = queryRecentLifts(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set lifts: %w", err)
+	}
+	return lfs, nil
+}
+
+func queryRecentLifts(ctx context.Context, tx *sql.Tx) ([]*stronk.Lift, error) {
+	q := `
+SELECT lifts.id, exercises.name, lifts.set_type, lifts.weight_value, lifts.weight_unit, lifts.set_number, lifts.reps, lifts.lift_note, lifts.day_number, lifts.week_number, lifts.iteration_number, lifts.to_failure, lifts.extra_set, lifts.rpe, lifts.reps_in_reserve, lifts.created_at
+FROM lifts
+JOIN exercises
+	ON lifts.exercise_id = exercises.id
+WHERE iteration_number >= 0
+ORDER BY iteration_number DESC, week_number DESC, day_number DESC, lifts.created_at DESC, lifts.id DESC
 LIMIT 100`
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent lifts: %w", err)
+	}
+	lfs, err := lifts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan recent lifts: %w", err)
+	}
+	return lfs, nil
+}
+
+// SavedResponse returns what's saved for an idempotency key, or nil.
+func (db *DB) SavedResponse(ctx context.Context, key string) (*stronk.SavedResponse, error) {
+	var resp *stronk.SavedResponse
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		resp, err = querySavedResponse(ctx, tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved response: %w", err)
+	}
+	return resp, nil
+}
+
+func querySavedResponse(ctx context.Context, tx *sql.Tx, key string) (*stronk.SavedResponse, error) {
+	q := `
+SELECT idempotency_key, request_path, request_hash, response_status, response_body, created_at
+FROM idempotency_keys
+WHERE idempotency_key = ?`
+	var r stronk.SavedResponse
+	err := tx.QueryRowContext(ctx, q, key).Scan(&r.Key, &r.Path, &r.RequestHash, &r.Status, &r.Body, &r.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan saved response: %w", err)
+	}
+	return &r, nil
+}
 
-		rows, err := tx.Query(q)
+func (db *DB) ReserveResponse(ctx context.Context, resp *stronk.SavedResponse, abandonBefore, expireBefore time.Time) (*stronk.SavedResponse, error) {
+	var saved *stronk.SavedResponse
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `DELETE FROM idempotency_keys WHERE created_at < ? OR (response_status = 0 AND created_at < ?)`
+		if _, err := tx.ExecContext(ctx, q, sqlTime(expireBefore), sqlTime(abandonBefore)); err != nil {
+			return fmt.Errorf("failed to delete expired responses: %w", err)
+		}
+		q = `INSERT OR IGNORE INTO idempotency_keys
+(idempotency_key, request_path, request_hash, response_status)
+VALUES (?, ?, ?, 0)`
+		res, err := tx.ExecContext(ctx, q, resp.Key, resp.Path, resp.RequestHash)
 		if err != nil {
-			return fmt.Errorf("failed to query training_maxes: %w", err)
+			return fmt.Errorf("failed to reserve idempotency key: %w", err)
 		}
-		if lfs, err = lifts(rows); err != nil {
-			return fmt.Errorf("failed to scan training_maxes: %w", err)
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
 		}
-		return nil
+		if n > 0 {
+			return nil
+		}
+		saved, err = querySavedResponse(ctx, tx, resp.Key)
+		return err
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to set lifts: %w", err)
+		return nil, err
 	}
-	return lfs, nil
+	return saved, nil
 }
 
-func (db *DB) transact(dbFn func(tx *sql.Tx) error) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+func (db *DB) SaveResponse(ctx context.Context, resp *stronk.SavedResponse) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		q := `UPDATE idempotency_keys
+SET response_status = ?, response_body = ?
+WHERE idempotency_key = ?
+	AND response_status = 0`
+		res, err := tx.ExecContext(ctx, q, resp.Status, resp.Body, resp.Key)
+		if err != nil {
+			return fmt.Errorf("failed to save response: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("idempotency key %q isn't reserved", resp.Key)
+		}
+		return nil
+	})
+}
+
+func (db *DB) ReleaseResponse(ctx context.Context, key string) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = ? AND response_status = 0`, key); err != nil {
+			return fmt.Errorf("failed to release idempotency key: %w", err)
+		}
+		return nil
+	})
+}
 
-	tx, err := db.sql.Begin()
+// transact runs dbFn in a write transaction. Writes are serialized by the
+// single read-write connection, waiting on it respects ctx.
+func (db *DB) transact(ctx context.Context, dbFn func(tx *sql.Tx) error) error {
+	return runTx(ctx, db.rw, dbFn)
+}
+
+// read runs dbFn in a transaction on one of the read-only connections, so it
+// can run in parallel with other reads and with a write.
+func (db *DB) read(ctx context.Context, dbFn func(tx *sql.Tx) error) error {
+	return runTx(ctx, db.ro, dbFn)
+}
+
+func runTx(ctx context.Context, sdb *sql.DB, dbFn func(tx *sql.Tx) error) error {
+	tx, err := sdb.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
@@ -235,18 +827,18 @@ func (db *DB) transact(dbFn func(tx *sql.Tx) error) error {
 	return nil
 }
 
-func (db *DB) SetTrainingMaxes(press, squat, bench, deadlift stronk.Weight) error {
-	err := db.transact(func(tx *sql.Tx) error {
+func (db *DB) SetTrainingMaxes(ctx context.Context, press, squat, bench, deadlift stronk.Weight) error {
+	err := db.transact(ctx, func(tx *sql.Tx) error {
 		q := `INSERT INTO training_maxes
-(exercise_id, training_max_weight) VALUES
-(?, ?), (?, ?), (?, ?), (?, ?)`
+(exercise_id, training_max_value, training_max_unit) VALUES
+(?, ?, ?), (?, ?, ?), (?, ?, ?), (?, ?, ?)`
 		args := []interface{}{
-			db.mainLiftIDs[stronk.OverheadPress], &sqlWeight{&press},
-			db.mainLiftIDs[stronk.Squat], &sqlWeight{&squat},
-			db.mainLiftIDs[stronk.BenchPress], &sqlWeight{&bench},
-			db.mainLiftIDs[stronk.Deadlift], &sqlWeight{&deadlift},
+			db.mainLiftIDs[stronk.OverheadPress], press.Value, press.Unit,
+			db.mainLiftIDs[stronk.Squat], squat.Value, squat.Unit,
+			db.mainLiftIDs[stronk.BenchPress], bench.Value, bench.Unit,
+			db.mainLiftIDs[stronk.Deadlift], deadlift.Value, deadlift.Unit,
 		}
-		if _, err := tx.Exec(q, args...); err != nil {
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
 			return fmt.Errorf("failed to insert to training_maxes: %w", err)
 		}
 		return nil
@@ -257,24 +849,55 @@ func (db *DB) SetTrainingMaxes(press, squat, bench, deadlift stronk.Weight) erro
 	return nil
 }
 
-func (db *DB) TrainingMaxes() ([]*stronk.TrainingMax, error) {
+func (db *DB) TrainingMaxes(ctx context.Context) ([]*stronk.TrainingMax, error) {
 	var tms []*stronk.TrainingMax
-	err := db.transact(func(tx *sql.Tx) error {
-		q := `
-SELECT b.exname, a.training_max_weight
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		tms, err = queryTrainingMaxes(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set training maxes: %w", err)
+	}
+	return tms, nil
+}
+
+// queryTrainingMaxes returns the latest training max for each exercise.
+func queryTrainingMaxes(ctx context.Context, tx *sql.Tx) ([]*stronk.TrainingMax, error) {
+	q := `
+SELECT exercises.name, a.training_max_value, a.training_max_unit, a.created_at
 FROM training_maxes a
-INNER JOIN
-(
-	SELECT exercises.id exid, exercises.name exname, MAX(created_at) latest
-	FROM training_maxes
-	JOIN exercises
-		ON training_maxes.exercise_id = exercises.id
-	GROUP BY exercises.id
-) b
-ON a.exercise_id = b.exid
-	AND a.created_at = b.latest`
+JOIN exercises
+	ON a.exercise_id = exercises.id
+WHERE a.id = (
+	SELECT b.id
+	FROM training_maxes b
+	WHERE b.exercise_id = a.exercise_id
+	ORDER BY b.created_at DESC, b.id DESC
+	LIMIT 1
+)
+ORDER BY exercises.id ASC`
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query training_maxes: %w", err)
+	}
+	tms, err := trainingMaxes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan training_maxes: %w", err)
+	}
+	return tms, nil
+}
 
-		rows, err := tx.Query(q)
+func (db *DB) TrainingMaxHistory(ctx context.Context) ([]*stronk.TrainingMax, error) {
+	var tms []*stronk.TrainingMax
+	err := db.read(ctx, func(tx *sql.Tx) error {
+		q := `
+SELECT exercises.name, training_maxes.training_max_value, training_maxes.training_max_unit, training_maxes.created_at
+FROM training_maxes
+JOIN exercises
+	ON training_maxes.exercise_id = exercises.id
+ORDER BY training_maxes.created_at ASC, training_maxes.id ASC`
+
+		rows, err := tx.QueryContext(ctx, q)
 		if err != nil {
 			return fmt.Errorf("failed to query training_maxes: %w", err)
 		}
@@ -284,7 +907,7 @@ ON a.exercise_id = b.exid
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to set training maxes: %w", err)
+		return nil, fmt.Errorf("failed to load training max history: %w", err)
 	}
 	return tms, nil
 }
@@ -295,7 +918,7 @@ func trainingMaxes(rows *sql.Rows) ([]*stronk.TrainingMax, error) {
 	var tms []*stronk.TrainingMax
 	for rows.Next() {
 		var tm stronk.TrainingMax
-		if err := rows.Scan(&tm.Exercise, &sqlWeight{&tm.Max}); err != nil {
+		if err := rows.Scan(&tm.Exercise, &tm.Max.Value, &tm.Max.Unit, &tm.SetAt); err != nil {
 			return nil, fmt.Errorf("failed to scan training max: %w", err)
 		}
 		tms = append(tms, &tm)
@@ -307,10 +930,10 @@ func trainingMaxes(rows *sql.Rows) ([]*stronk.TrainingMax, error) {
 	return tms, nil
 }
 
-func (db *DB) SetSmallestDenom(small stronk.Weight) error {
-	err := db.transact(func(tx *sql.Tx) error {
-		q := `INSERT INTO smallest_denom (smallest_denom) VALUES (?)`
-		if _, err := tx.Exec(q, &sqlWeight{&small}); err != nil {
+func (db *DB) SetSmallestDenom(ctx context.Context, small stronk.Weight) error {
+	err := db.transact(ctx, func(tx *sql.Tx) error {
+		q := `INSERT INTO smallest_denom (smallest_denom_value, smallest_denom_unit) VALUES (?, ?)`
+		if _, err := tx.ExecContext(ctx, q, small.Value, small.Unit); err != nil {
 			return fmt.Errorf("failed to insert to smallest_denom: %w", err)
 		}
 		return nil
@@ -321,22 +944,11 @@ func (db *DB) SetSmallestDenom(small stronk.Weight) error {
 	return nil
 }
 
-func (db *DB) SmallestDenom() (stronk.Weight, error) {
+func (db *DB) SmallestDenom(ctx context.Context) (stronk.Weight, error) {
 	var small stronk.Weight
-	err := db.transact(func(tx *sql.Tx) error {
-		q := `
-SELECT a.smallest_denom
-FROM smallest_denom a
-ORDER BY a.created_at DESC
-LIMIT 1`
-		err := tx.QueryRow(q).Scan(&sqlWeight{&small})
-		if errors.Is(err, sql.ErrNoRows) {
-			return stronk.ErrNoSmallestDenom
-		}
-		if err != nil {
-			return fmt.Errorf("failed to scan smallest denominator: %w", err)
-		}
-		return nil
+	err := db.read(ctx, func(tx *sql.Tx) (err error) {
+		small, err = querySmallestDenom(ctx, tx)
+		return err
 	})
 	if err != nil {
 		return stronk.Weight{}, err
@@ -344,26 +956,56 @@ LIMIT 1`
 	return small, nil
 }
 
+func querySmallestDenom(ctx context.Context, tx *sql.Tx) (stronk.Weight, error) {
+	q := `
+SELECT a.smallest_denom_value, a.smallest_denom_unit
+FROM smallest_denom a
+ORDER BY a.created_at DESC, a.id DESC
+LIMIT 1`
+	var small stronk.Weight
+	err := tx.QueryRowContext(ctx, q).Scan(&small.Value, &small.Unit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stronk.Weight{}, stronk.ErrNoSmallestDenom
+	}
+	if err != nil {
+		return stronk.Weight{}, fmt.Errorf("failed to scan smallest denominator: %w", err)
+	}
+	return small, nil
+}
+
 func lifts(rows *sql.Rows) ([]*stronk.Lift, error) {
 	defer rows.Close()
 
 	var lfs []*stronk.Lift
 	for rows.Next() {
 		var (
-			lf   stronk.Lift
-			note sql.NullString
+			lf    stronk.Lift
+			note  sql.NullString
+			extra sql.NullString
+			rpe   sql.NullFloat64
+			rir   sql.NullInt64
 		)
 		if err := rows.Scan(
 			&lf.ID,
-			&lf.Exercise, &lf.SetType, &sqlWeight{&lf.Weight},
+			&lf.Exercise, &lf.SetType, &lf.Weight.Value, &lf.Weight.Unit,
 			&lf.SetNumber, &lf.Reps, &note,
 			&lf.DayNumber, &lf.WeekNumber, &lf.IterationNumber,
-			&lf.ToFailure); err != nil {
+			&lf.ToFailure, &extra, &rpe, &rir, &lf.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan lift: %w", err)
 		}
 		if note.Valid {
 			lf.Note = note.String
 		}
+		if extra.Valid {
+			lf.Extra = stronk.ExtraSet(extra.String)
+		}
+		if rpe.Valid {
+			lf.RPE = rpe.Float64
+		}
+		if rir.Valid {
+			v := int(rir.Int64)
+			lf.RIR = &v
+		}
 		lfs = append(lfs, &lf)
 	}
 
@@ -391,11 +1033,30 @@ func skippedWeeks(rows *sql.Rows) ([]stronk.SkippedWeek, error) {
 	return wks, nil
 }
 
+// busyTimeout is how long, in milliseconds, a connection waits on a lock held
+// by another connection before giving up with SQLITE_BUSY.
+const busyTimeout = "5000"
+
+// migrations is the migration set, embedded so that the server binary doesn't
+// need a copy of the migrations directory on disk.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// New opens the SQLite database at dbPath and migrates it to the latest
+// version. If migrationsPath is empty, the embedded migration set is used,
+// otherwise migrations are loaded from that directory, which is mostly useful
+// when developing new migrations.
 func New(dbPath, migrationsPath string) (*DB, error) {
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_loc=UTC")
+	// The journal mode is stored in the database file, so setting it on the
+	// read-write connection is enough for the read-only ones too. Write
+	// transactions take the write lock upfront, instead of failing if they
+	// have to upgrade from a read lock while another connection is writing.
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_foreign_keys=on&_loc=UTC&_journal_mode=WAL&_busy_timeout="+busyTimeout+"&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SQLite DB: %w", err)
 	}
+	db.SetMaxOpenConns(1)
 	cleanupOnError := func(origErr error) error {
 		if closeErr := db.Close(); closeErr != nil {
 			return fmt.Errorf("error closing DB (%v) while handling original error: %w", closeErr, origErr)
@@ -403,23 +1064,9 @@ func New(dbPath, migrationsPath string) (*DB, error) {
 		return origErr
 	}
 
-	driver, err := migratesqlite3.WithInstance(db, &migratesqlite3.Config{
-		MigrationsTable: migratesqlite3.DefaultMigrationsTable,
-	})
-	if err != nil {
-		return nil, cleanupOnError(fmt.Errorf("failed to init go-migrate driver: %w", err))
-	}
-
-	rootedMigrationsPath, err := filepath.Abs(migrationsPath)
-	if err != nil {
-		return nil, cleanupOnError(fmt.Errorf("failed to get a rooted migrations file path: %w", err))
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://"+rootedMigrationsPath,
-		"sqlite3", driver)
+	m, _, err := newMigrate(db, migrationsPath)
 	if err != nil {
-		return nil, cleanupOnError(fmt.Errorf("failed to create migrate instance: %w", err))
+		return nil, cleanupOnError(err)
 	}
 
 	prevV, dirty, err := m.Version()
@@ -427,7 +1074,7 @@ func New(dbPath, migrationsPath string) (*DB, error) {
 		return nil, cleanupOnError(fmt.Errorf("failed to load current DB version: %w", err))
 	}
 	if dirty {
-		return nil, cleanupOnError(errors.New("database was marked dirty"))
+		return nil, cleanupOnError(fmt.Errorf("database was marked dirty at version %d, see 'stronk migrate force'", prevV))
 	}
 
 	switch err := m.Up(); {
@@ -451,19 +1098,28 @@ func New(dbPath, migrationsPath string) (*DB, error) {
 		log.Printf("Migrated from version %d to version %d", prevV, curV)
 	}
 
-	sdb := &DB{sql: db}
+	ro, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro&_loc=UTC&_busy_timeout="+busyTimeout)
+	if err != nil {
+		return nil, cleanupOnError(fmt.Errorf("failed to open read-only SQLite DB: %w", err))
+	}
 
-	if err := sdb.initMainLifts(); err != nil {
-		return nil, fmt.Errorf("failed to init main lifts: %w", err)
+	sdb := &DB{rw: db, ro: ro}
+
+	if err := sdb.initMainLifts(context.Background()); err != nil {
+		err = fmt.Errorf("failed to init main lifts: %w", err)
+		if closeErr := ro.Close(); closeErr != nil {
+			err = fmt.Errorf("error closing read-only DB (%v) while handling original error: %w", closeErr, err)
+		}
+		return nil, cleanupOnError(err)
 	}
 
 	return sdb, nil
 }
 
-func (db *DB) CreateExercise(ex stronk.Exercise) error {
-	return db.transact(func(tx *sql.Tx) error {
+func (db *DB) CreateExercise(ctx context.Context, ex stronk.Exercise) error {
+	return db.transact(ctx, func(tx *sql.Tx) error {
 		q := `INSERT INTO exercises (name) VALUES (?)`
-		_, err := tx.Exec(q, ex)
+		_, err := tx.ExecContext(ctx, q, ex)
 		sqlErr := sqlite3.Error{}
 		if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique {
 			// An expected error if we've already inserted this, we don't need to let
@@ -482,9 +1138,9 @@ type exercise struct {
 	Exercise stronk.Exercise
 }
 
-func (db *DB) exercises(exs []stronk.Exercise) ([]exercise, error) {
+func (db *DB) exercises(ctx context.Context, exs []stronk.Exercise) ([]exercise, error) {
 	var out []exercise
-	err := db.transact(func(tx *sql.Tx) error {
+	err := db.read(ctx, func(tx *sql.Tx) error {
 		q := fmt.Sprintf(`
 SELECT id, name
 FROM exercises
@@ -495,7 +1151,7 @@ WHERE name IN %s`, repeatedArgs(len(exs)))
 			args = append(args, ex)
 		}
 
-		rows, err := tx.Query(q, args...)
+		rows, err := tx.QueryContext(ctx, q, args...)
 		if err != nil {
 			return fmt.Errorf("failed to query exercises: %w", err)
 		}
@@ -520,18 +1176,18 @@ WHERE name IN %s`, repeatedArgs(len(exs)))
 	return out, nil
 }
 
-func (db *DB) initMainLifts() error {
+func (db *DB) initMainLifts(ctx context.Context) error {
 	// First, create all the main lifts.
 	exs := stronk.MainExercises()
 	for _, ex := range exs {
-		if err := db.CreateExercise(ex); err != nil {
+		if err := db.CreateExercise(ctx, ex); err != nil {
 			return fmt.Errorf("failed to create exercise %q: %w", ex, err)
 		}
 	}
 
 	// Now, load all of their IDs.
 	mainLiftIDs := make(map[stronk.Exercise]int)
-	exsWithIDs, err := db.exercises(exs)
+	exsWithIDs, err := db.exercises(ctx, exs)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,169 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/server"
+	"github.com/bcspragu/stronk/testing/dbtest"
+)
+
+func TestDB(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) server.DB {
+		return newTestDB(t)
+	})
+}
+
+func TestReadsDuringWrite(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	inTx, release := make(chan struct{}), make(chan struct{})
+	errC := make(chan error, 1)
+	go func() {
+		errC <- db.transact(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO skipped_weeks (week_number, iteration_number, note) VALUES (?, ?, ?)`, 1, 1, ""); err != nil {
+				return err
+			}
+			close(inTx)
+			<-release
+			return nil
+		})
+	}()
+	<-inTx
+
+	// The write transaction is still open, reads shouldn't have to wait for it,
+	// and shouldn't see anything it hasn't committed.
+	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sws, err := db.SkippedWeeks(readCtx)
+			if err != nil {
+				t.Errorf("SkippedWeeks: %v", err)
+				return
+			}
+			if len(sws) != 0 {
+				t.Errorf("read saw %d uncommitted skipped weeks", len(sws))
+			}
+		}()
+	}
+	wg.Wait()
+
+	close(release)
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to write skipped week: %v", err)
+	}
+
+	sws, err := db.SkippedWeeks(ctx)
+	if err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	if len(sws) != 1 {
+		t.Errorf("got %d skipped weeks after commit, want 1", len(sws))
+	}
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	if err := db.SetSmallestDenom(ctx, stronk.Weight{Value: 50, Unit: stronk.DeciPounds}); err != nil {
+		t.Fatalf("SetSmallestDenom: %v", err)
+	}
+
+	const n = 25
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			wt := stronk.Weight{Value: 1000 + i, Unit: stronk.DeciPounds}
+			if _, err := db.RecordLift(ctx, stronk.Squat, stronk.Main, wt, 1, 5, "", 1, 1, 1, false, "", 0, nil); err != nil {
+				t.Errorf("RecordLift: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := db.RecentLifts(ctx); err != nil {
+				t.Errorf("RecentLifts: %v", err)
+			}
+			if _, err := db.WorkoutContext(ctx, []stronk.Exercise{stronk.Squat}); err != nil {
+				t.Errorf("WorkoutContext: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lifts, err := db.RecentLifts(ctx)
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if len(lifts) != n {
+		t.Errorf("got %d lifts, want %d", len(lifts), n)
+	}
+}
+
+func TestConcurrentRecordNextLift(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	if err := db.SetSmallestDenom(ctx, stronk.Weight{Value: 50, Unit: stronk.DeciPounds}); err != nil {
+		t.Fatalf("SetSmallestDenom: %v", err)
+	}
+
+	// Every device thinks it's recording the first set, only one of them
+	// should get to.
+	errTaken := errors.New("first set already recorded")
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			l := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: stronk.Weight{Value: 1000, Unit: stronk.DeciPounds}, Reps: 5}
+			_, _, err := db.RecordNextLift(ctx, l, nil, func(wc *stronk.WorkoutContext) error {
+				if len(wc.RecentLifts) > 0 {
+					return errTaken
+				}
+				return nil
+			}, nil)
+			errs <- err
+		}()
+	}
+
+	var recorded int
+	for i := 0; i < n; i++ {
+		switch err := <-errs; {
+		case err == nil:
+			recorded++
+		case !errors.Is(err, errTaken):
+			t.Errorf("RecordNextLift: %v", err)
+		}
+	}
+	if recorded != 1 {
+		t.Errorf("%d devices recorded the first set, want 1", recorded)
+	}
+}
+
+func newTestDB(t *testing.T) *DB {
+	return newTestDBAt(t, filepath.Join(t.TempDir(), "stronk.db"))
+}
+
+func newTestDBAt(t *testing.T, path string) *DB {
+	db, err := New(path, "")
+	if err != nil {
+		t.Fatalf("failed to create DB: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close DB: %v", err)
+		}
+	})
+	return db
+}
@@ -2,79 +2,41 @@ package sqldb
 
 import (
 	"database/sql"
-	"database/sql/driver"
-	"errors"
-	"fmt"
-	"strconv"
-	"strings"
-
-	"github.com/bcspragu/stronk"
+	"time"
 )
 
-type sqlWeight struct {
-	w *stronk.Weight
-}
-
-func (sw sqlWeight) Value() (driver.Value, error) {
-	return fmt.Sprintf("%d:%s", sw.w.Value, sw.w.Unit), nil
-}
-
-func (sw *sqlWeight) Scan(val interface{}) error {
-	if val == nil {
-		return errors.New("weight should always be set")
-	}
-
-	// We probably don't need both []byte and string, but I swear []byte was
-	// working, but it recently started failing and expected string instead.
-	// :shrug:
-	switch v := val.(type) {
-	case []byte:
-		w, err := parseWeight(string(v))
-		if err != nil {
-			return fmt.Errorf("failed to parse weight: %w", err)
-		}
-		*sw.w = w
-		return nil
-	case string:
-		w, err := parseWeight(v)
-		if err != nil {
-			return fmt.Errorf("failed to parse weight: %w", err)
-		}
-		*sw.w = w
-		return nil
-	default:
-		return fmt.Errorf("unexpected type of val %T", val)
+func nullString(in string) sql.NullString {
+	if in == "" {
+		return sql.NullString{Valid: false}
 	}
+	return sql.NullString{Valid: true, String: in}
 }
 
-func parseWeight(v string) (stronk.Weight, error) {
-	ps := strings.Split(v, ":")
-	if n := len(ps); n != 2 {
-		return stronk.Weight{}, fmt.Errorf("malformed weight had %d parts", n)
-	}
-
-	val, err := strconv.Atoi(ps[0])
-	if err != nil {
-		return stronk.Weight{}, fmt.Errorf("failed to parse weight %q: %w", ps[0], err)
+func nullFloat(in float64) sql.NullFloat64 {
+	if in == 0 {
+		return sql.NullFloat64{Valid: false}
 	}
+	return sql.NullFloat64{Valid: true, Float64: in}
+}
 
-	var unit stronk.WeightUnit
-	switch ps[1] {
-	case "DECI_POUNDS":
-		unit = stronk.DeciPounds
-	default:
-		return stronk.Weight{}, fmt.Errorf("unknown unit %q", ps[1])
+func nullInt(in *int) sql.NullInt64 {
+	if in == nil {
+		return sql.NullInt64{Valid: false}
 	}
+	return sql.NullInt64{Valid: true, Int64: int64(*in)}
+}
 
-	return stronk.Weight{
-		Unit:  unit,
-		Value: val,
-	}, nil
+// sqlTime formats a time the same way as SQLite's CURRENT_TIMESTAMP, which
+// is how our created_at columns are populated, so that they can be compared
+// for equality.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
 }
 
-func nullString(in string) sql.NullString {
-	if in == "" {
+// nullTime is like sqlTime, but maps the zero time to NULL.
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
 		return sql.NullString{Valid: false}
 	}
-	return sql.NullString{Valid: true, String: in}
+	return sql.NullString{Valid: true, String: sqlTime(t)}
 }
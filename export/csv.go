@@ -0,0 +1,151 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bcspragu/stronk"
+)
+
+// Unit is the unit weights are written in for CSV exports.
+type Unit string
+
+const (
+	Pounds    = Unit("LB")
+	Kilograms = Unit("KG")
+)
+
+// KilogramsPerPound converts pounds to kilograms.
+const KilogramsPerPound = 0.45359237
+
+var ErrInvalidUnit = errors.New("unit must be LB or KG")
+
+// ParseUnit parses a CSV export unit, case-insensitively. An empty string
+// means pounds.
+func ParseUnit(in string) (Unit, error) {
+	switch strings.ToUpper(in) {
+	case "", "LB", "LBS":
+		return Pounds, nil
+	case "KG", "KGS":
+		return Kilograms, nil
+	default:
+		return "", ErrInvalidUnit
+	}
+}
+
+func (u Unit) format(w stronk.Weight) (string, error) {
+	if w.Unit != stronk.DeciPounds {
+		return "", fmt.Errorf("unexpected weight unit %q", w.Unit)
+	}
+	lbs := float64(w.Value) / 10
+	switch u {
+	case Pounds:
+		return strconv.FormatFloat(lbs, 'f', -1, 64), nil
+	case Kilograms:
+		return strconv.FormatFloat(math.Round(lbs*KilogramsPerPound*100)/100, 'f', -1, 64), nil
+	default:
+		return "", ErrInvalidUnit
+	}
+}
+
+var liftsCSVHeader = []string{
+	"timestamp",
+	"exercise",
+	"set_type",
+	"set_number",
+	"extra_set",
+	"weight",
+	"unit",
+	"reps",
+	"to_failure",
+	"rpe",
+	"rir",
+	"e1rm",
+	"iteration",
+	"week",
+	"day",
+	"note",
+}
+
+// WriteLiftsCSV writes one row per lift, with weights in the given unit and
+// week and day names taken from the routine. Iterations are numbered from one,
+// and are left blank for historical lifts.
+func WriteLiftsCSV(w io.Writer, lifts []*stronk.Lift, routine *stronk.Routine, unit Unit) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(liftsCSVHeader); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for _, l := range lifts {
+		weight, err := unit.format(l.Weight)
+		if err != nil {
+			return fmt.Errorf("failed to format weight of lift %d: %w", l.ID, err)
+		}
+		e1rm, err := unit.format(l.AsRPEOneRepMax())
+		if err != nil {
+			return fmt.Errorf("failed to format e1RM of lift %d: %w", l.ID, err)
+		}
+
+		var rpe, rir string
+		if l.RPE > 0 {
+			rpe = strconv.FormatFloat(l.RPE, 'f', -1, 64)
+		}
+		if l.RIR != nil {
+			rir = strconv.Itoa(*l.RIR)
+		}
+
+		// Historical lifts aren't part of the routine, so they don't have an
+		// iteration, week or day.
+		var iter, week, day string
+		if !l.IsHistorical() {
+			iter = strconv.Itoa(l.IterationNumber + 1)
+			week, day = routineNames(routine, l.WeekNumber, l.DayNumber)
+		}
+
+		row := []string{
+			l.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+			string(l.Exercise),
+			string(l.SetType),
+			strconv.Itoa(l.SetNumber),
+			string(l.Extra),
+			weight,
+			string(unit),
+			strconv.Itoa(l.Reps),
+			strconv.FormatBool(l.ToFailure),
+			rpe,
+			rir,
+			e1rm,
+			iter,
+			week,
+			day,
+			l.Note,
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write lift %d: %w", l.ID, err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to flush CSV: %w", err)
+	}
+	return nil
+}
+
+// routineNames returns the names of the given week and day in the routine, or
+// empty strings if they aren't in it.
+func routineNames(routine *stronk.Routine, week, day int) (string, string) {
+	if week < 0 || week >= len(routine.Weeks) {
+		return "", ""
+	}
+	wk := routine.Weeks[week]
+	if day < 0 || day >= len(wk.Days) {
+		return wk.WeekName, ""
+	}
+	return wk.WeekName, wk.Days[day].DayName
+}
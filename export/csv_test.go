@@ -0,0 +1,78 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteLiftsCSV(t *testing.T) {
+	routine := &stronk.Routine{
+		Weeks: []*stronk.WorkoutWeek{
+			{WeekName: "Week 1", Days: []*stronk.WorkoutDay{{DayName: "Press Day"}}},
+		},
+	}
+	rir := 2
+	lifts := []*stronk.Lift{
+		{
+			ID:        1,
+			Exercise:  stronk.OverheadPress,
+			SetType:   stronk.Main,
+			Weight:    stronk.Weight{Unit: stronk.DeciPounds, Value: 1000},
+			Reps:      5,
+			ToFailure: true,
+			RIR:       &rir,
+			Note:      "felt good, \"fast\"",
+			CreatedAt: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:              2,
+			Exercise:        stronk.OverheadPress,
+			SetType:         stronk.Main,
+			Weight:          stronk.Weight{Unit: stronk.DeciPounds, Value: 1100},
+			SetNumber:       1,
+			Reps:            1,
+			RPE:             9.5,
+			Extra:           stronk.JokerSet,
+			IterationNumber: 1,
+			// Not in the routine
+			WeekNumber: 3,
+			CreatedAt:  time.Date(2026, 10, 18, 12, 5, 0, 0, time.UTC),
+		},
+	}
+
+	tests := []struct {
+		unit Unit
+		want string
+	}{
+		{
+			unit: Pounds,
+			want: `timestamp,exercise,set_type,set_number,extra_set,weight,unit,reps,to_failure,rpe,rir,e1rm,iteration,week,day,note
+2026-10-18T12:00:00Z,OVERHEAD_PRESS,MAIN,0,,100,LB,5,true,,2,123.3,1,Week 1,Press Day,"felt good, ""fast"""
+2026-10-18T12:05:00Z,OVERHEAD_PRESS,MAIN,1,JOKER,110,LB,1,false,9.5,,115.4,2,,,
+`,
+		},
+		{
+			unit: Kilograms,
+			want: `timestamp,exercise,set_type,set_number,extra_set,weight,unit,reps,to_failure,rpe,rir,e1rm,iteration,week,day,note
+2026-10-18T12:00:00Z,OVERHEAD_PRESS,MAIN,0,,45.36,KG,5,true,,2,55.93,1,Week 1,Press Day,"felt good, ""fast"""
+2026-10-18T12:05:00Z,OVERHEAD_PRESS,MAIN,1,JOKER,49.9,KG,1,false,9.5,,52.34,2,,,
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.unit), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteLiftsCSV(&buf, lifts, routine, test.unit); err != nil {
+				t.Fatalf("WriteLiftsCSV: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Errorf("unexpected CSV (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Package export converts a user's data to and from a versioned JSON document,
+// for moving it between deployments.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bcspragu/stronk"
+)
+
+// Version is the current version of the export document format. It should be
+// bumped whenever the format changes in a way that older importers can't
+// handle.
+const Version = 1
+
+var (
+	// ErrUnsupportedVersion is returned when decoding a document from a newer
+	// version of the format than this one.
+	ErrUnsupportedVersion = errors.New("unsupported export version")
+	// ErrInvalid is returned when importing a document that fails validation.
+	ErrInvalid = errors.New("invalid export")
+)
+
+type Document struct {
+	Version    int
+	ExportedAt time.Time
+	// Routine is the routine that was active when the data was exported, for
+	// reference. Imports are validated against the importing server's routine,
+	// not this one.
+	Routine *stronk.Routine
+
+	Lifts          []*stronk.Lift
+	TrainingMaxes  []*stronk.TrainingMax
+	SmallestDenoms []*stronk.SmallestDenom
+	SkippedWeeks   []stronk.SkippedWeek
+}
+
+// Store is the subset of server.DB needed for exporting and importing.
+type Store interface {
+	ExportData(ctx context.Context) (*stronk.UserData, error)
+	ImportData(ctx context.Context, data *stronk.UserData) (*stronk.ImportResult, error)
+}
+
+// Export loads all data from the store into a new document.
+func Export(ctx context.Context, store Store, routine *stronk.Routine, now time.Time) (*Document, error) {
+	data, err := store.ExportData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data: %w", err)
+	}
+
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: now.UTC().Truncate(time.Second),
+		Routine:    routine,
+
+		Lifts:          data.Lifts,
+		TrainingMaxes:  data.TrainingMaxes,
+		SmallestDenoms: data.SmallestDenoms,
+		SkippedWeeks:   data.SkippedWeeks,
+	}
+	// For JSON serialization
+	if doc.Lifts == nil {
+		doc.Lifts = []*stronk.Lift{}
+	}
+	if doc.TrainingMaxes == nil {
+		doc.TrainingMaxes = []*stronk.TrainingMax{}
+	}
+	if doc.SmallestDenoms == nil {
+		doc.SmallestDenoms = []*stronk.SmallestDenom{}
+	}
+	if doc.SkippedWeeks == nil {
+		doc.SkippedWeeks = []stronk.SkippedWeek{}
+	}
+	return doc, nil
+}
+
+// Decode reads a document, rejecting versions of the format we don't know
+// about.
+func Decode(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse export: %w", err)
+	}
+	if doc.Version < 1 || doc.Version > Version {
+		return nil, fmt.Errorf("%w %d, expected at most %d", ErrUnsupportedVersion, doc.Version, Version)
+	}
+	return &doc, nil
+}
+
+// Validate checks that everything in the document is well-formed and fits the
+// given routine, returning all problems found.
+func Validate(doc *Document, routine *stronk.Routine) error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	exercises := make(map[stronk.Exercise]bool)
+	for _, ex := range stronk.MainExercises() {
+		exercises[ex] = true
+	}
+	for _, wk := range routine.Weeks {
+		for _, day := range wk.Days {
+			for _, mvmt := range day.Movements {
+				exercises[mvmt.Exercise] = true
+			}
+		}
+	}
+
+	validWeight := func(w stronk.Weight) bool {
+		return w.Unit == stronk.DeciPounds && w.Value >= 0
+	}
+
+	for i, l := range doc.Lifts {
+		// Historical lifts are from before the routine, so they can be of any
+		// exercise.
+		if !exercises[l.Exercise] && !l.IsHistorical() {
+			addErr("lift %d: exercise %q isn't in the routine", i, l.Exercise)
+		}
+		switch l.SetType {
+		case stronk.Warmup, stronk.Main, stronk.Assistance:
+		default:
+			addErr("lift %d: invalid set type %q", i, l.SetType)
+		}
+		switch l.Extra {
+		case "", stronk.JokerSet, stronk.FirstSetLastSet:
+		default:
+			addErr("lift %d: invalid extra set type %q", i, l.Extra)
+		}
+		if !validWeight(l.Weight) {
+			addErr("lift %d: invalid weight %+v", i, l.Weight)
+		}
+		if l.Reps < 0 || l.SetNumber < 0 {
+			addErr("lift %d: reps and set number can't be negative", i)
+		}
+		if err := stronk.ValidateEffort(l.RPE, l.RIR); err != nil {
+			addErr("lift %d: %w", i, err)
+		}
+		if l.CreatedAt.IsZero() {
+			addErr("lift %d: missing timestamp", i)
+		}
+		if l.IsHistorical() {
+			continue
+		}
+		if l.IterationNumber < 0 || l.WeekNumber < 0 || l.WeekNumber >= len(routine.Weeks) {
+			addErr("lift %d: week %d of iteration %d isn't in the routine", i, l.WeekNumber, l.IterationNumber)
+			continue
+		}
+		if wk := routine.Weeks[l.WeekNumber]; l.DayNumber < 0 || l.DayNumber >= len(wk.Days) {
+			addErr("lift %d: day %d isn't in week %d of the routine", i, l.DayNumber, l.WeekNumber)
+		}
+	}
+
+	for i, tm := range doc.TrainingMaxes {
+		if !exercises[tm.Exercise] {
+			addErr("training max %d: exercise %q isn't in the routine", i, tm.Exercise)
+		}
+		if !validWeight(tm.Max) {
+			addErr("training max %d: invalid weight %+v", i, tm.Max)
+		}
+		if tm.SetAt.IsZero() {
+			addErr("training max %d: missing timestamp", i)
+		}
+	}
+
+	for i, sd := range doc.SmallestDenoms {
+		if !validWeight(sd.Weight) || sd.Weight.Value == 0 {
+			addErr("smallest denomination %d: invalid weight %+v", i, sd.Weight)
+		}
+		if sd.SetAt.IsZero() {
+			addErr("smallest denomination %d: missing timestamp", i)
+		}
+	}
+
+	for i, wk := range doc.SkippedWeeks {
+		if wk.Iteration < 0 || wk.Week < 0 || wk.Week >= len(routine.Weeks) {
+			addErr("skipped week %d: week %d isn't in the routine", i, wk.Week)
+			continue
+		}
+		if !routine.Weeks[wk.Week].Optional {
+			addErr("skipped week %d: week %d isn't optional", i, wk.Week)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Import validates the document against the routine, then inserts its data
+// into the store. Importing the same document more than once only inserts it
+// the first time.
+func Import(ctx context.Context, store Store, doc *Document, routine *stronk.Routine) (*stronk.ImportResult, error) {
+	if err := Validate(doc, routine); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	res, err := store.ImportData(ctx, &stronk.UserData{
+		Lifts:          doc.Lifts,
+		TrainingMaxes:  doc.TrainingMaxes,
+		SmallestDenoms: doc.SmallestDenoms,
+		SkippedWeeks:   doc.SkippedWeeks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import data: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcspragu/stronk"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		desc    string
+		in      string
+		wantErr error
+	}{
+		{
+			desc: "current version",
+			in:   `{"Version": 1}`,
+		},
+		{
+			desc:    "newer version",
+			in:      `{"Version": 2}`,
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			desc:    "missing version",
+			in:      `{}`,
+			wantErr: ErrUnsupportedVersion,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(test.in))
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Decode returned error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	routine := &stronk.Routine{
+		Weeks: []*stronk.WorkoutWeek{
+			{Days: []*stronk.WorkoutDay{{Movements: []*stronk.Movement{{Exercise: "CURL", SetType: stronk.Assistance}}}}},
+			{Optional: true, Days: []*stronk.WorkoutDay{{}}},
+		},
+	}
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	lift := func(fn func(l *stronk.Lift)) *stronk.Lift {
+		l := &stronk.Lift{
+			Exercise:  "CURL",
+			SetType:   stronk.Assistance,
+			Weight:    stronk.Weight{Unit: stronk.DeciPounds, Value: 300},
+			Reps:      10,
+			CreatedAt: at,
+		}
+		if fn != nil {
+			fn(l)
+		}
+		return l
+	}
+
+	tests := []struct {
+		desc    string
+		doc     *Document
+		wantErr string
+	}{
+		{
+			desc: "valid",
+			doc: &Document{
+				Lifts:          []*stronk.Lift{lift(nil), lift(func(l *stronk.Lift) { l.Exercise = stronk.Squat })},
+				TrainingMaxes:  []*stronk.TrainingMax{{Exercise: stronk.Squat, Max: stronk.Weight{Unit: stronk.DeciPounds, Value: 2000}, SetAt: at}},
+				SmallestDenoms: []*stronk.SmallestDenom{{Weight: stronk.Weight{Unit: stronk.DeciPounds, Value: 50}, SetAt: at}},
+				SkippedWeeks:   []stronk.SkippedWeek{{Week: 1}},
+			},
+		},
+		{
+			desc:    "unknown exercise",
+			doc:     &Document{Lifts: []*stronk.Lift{lift(func(l *stronk.Lift) { l.Exercise = "HIP_THRUST" })}},
+			wantErr: `lift 0: exercise "HIP_THRUST" isn't in the routine`,
+		},
+		{
+			desc:    "day out of range",
+			doc:     &Document{Lifts: []*stronk.Lift{lift(func(l *stronk.Lift) { l.DayNumber = 1 })}},
+			wantErr: "lift 0: day 1 isn't in week 0 of the routine",
+		},
+		{
+			desc:    "invalid RPE",
+			doc:     &Document{Lifts: []*stronk.Lift{lift(func(l *stronk.Lift) { l.RPE = 11 })}},
+			wantErr: "lift 0: " + stronk.ErrInvalidRPE.Error(),
+		},
+		{
+			desc:    "missing timestamp",
+			doc:     &Document{Lifts: []*stronk.Lift{lift(func(l *stronk.Lift) { l.CreatedAt = time.Time{} })}},
+			wantErr: "lift 0: missing timestamp",
+		},
+		{
+			desc:    "skipping a required week",
+			doc:     &Document{SkippedWeeks: []stronk.SkippedWeek{{Week: 0}}},
+			wantErr: "skipped week 0: week 0 isn't optional",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := Validate(test.doc, routine)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate returned no error, want %q", test.wantErr)
+			}
+			if got := err.Error(); got != test.wantErr {
+				t.Errorf("Validate returned error %q, want %q", got, test.wantErr)
+			}
+		})
+	}
+}
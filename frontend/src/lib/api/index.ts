@@ -10,6 +10,9 @@ export interface Set {
 	RepTarget: number;
 	ToFailure: boolean;
 	TrainingMaxPercentage: number;
+	TargetRPE?: number;
+	BackOffPercentage?: number;
+	RestSeconds?: number;
 	WeightTarget: Weight;
 	FailureComparables?: ComparableLifts;
 	AssociatedLiftID?: number;
@@ -18,9 +21,14 @@ export interface Set {
 export interface Movement {
 	Exercise: Exercise;
 	SetType: SetType;
+	Group?: string;
 	Sets: Set[];
+	JokerSets?: Set[];
+	FirstSetLastSets?: Set[];
 }
 
+export type ExtraSet = '' | 'JOKER' | 'FIRST_SET_LAST';
+
 export interface Lift {
 	ID: number;
 	Exercise: Exercise;
@@ -34,6 +42,10 @@ export interface Lift {
 	WeekNumber: number;
 	IterationNumber: number;
 	ToFailure: boolean;
+	RPE?: number;
+	RIR?: number;
+	Extra?: ExtraSet;
+	CreatedAt: string;
 }
 
 export interface ComparableLifts {
@@ -44,7 +56,43 @@ export interface ComparableLifts {
 
 export interface RecordLiftResponse {
 	LiftID: number;
-	NextLift: NextLiftResponse;
+	// NextLift is null if the lift was recorded but the server couldn't work
+	// out what's next.
+	NextLift: NextLiftResponse | null;
+	NewRepRecord: boolean;
+	Achievements: Achievement[];
+}
+
+export type AchievementType = 'ONE_REP_MAX_PR' | 'REP_PR' | 'WEIGHT_PR';
+
+export interface Achievement {
+	Type: AchievementType;
+	Exercise: Exercise;
+	LiftID: number;
+	Weight: Weight;
+	Reps: number;
+	PreviousLiftID: number;
+	PreviousWeight: Weight;
+	PreviousReps: number;
+	AchievedAt: string;
+}
+
+export interface RepRecord {
+	Reps: number;
+	Lift: Lift;
+	Previous?: Lift;
+}
+
+export interface WeightRecord {
+	Weight: Weight;
+	Lift: Lift;
+	Previous?: Lift;
+}
+
+export interface RepRecordsResponse {
+	Exercise: Exercise;
+	ByReps: RepRecord[];
+	ByWeight: WeightRecord[];
 }
 
 export interface NextLiftResponse {
@@ -57,11 +105,38 @@ export interface NextLiftResponse {
 	NextMovementIndex: number;
 	NextSetIndex: number;
 	OptionalWeek: boolean;
+	Rest?: RestStatus;
+	SessionRest?: RestStats;
+	FinishedDay?: FinishedDay;
+}
+
+export interface FinishedDay {
+	DayNumber: number;
+	WeekNumber: number;
+	IterationNumber: number;
+	DayName: string;
+	WeekName: string;
+	Workout: Movement[];
+}
+
+export interface RestStatus {
+	LastSetCompletedAt: string;
+	RecommendedRestSeconds: number;
+	RemainingSeconds: number;
+}
+
+export interface RestStats {
+	Intervals: number;
+	TotalSeconds: number;
+	AverageSeconds: number;
+	ShortestSeconds: number;
+	LongestSeconds: number;
 }
 
 export interface TrainingMax {
 	Max: Weight;
 	Exercise: Exercise;
+	SetAt: string;
 }
 
 export interface TrainingMaxesResponse {
@@ -89,6 +164,9 @@ export interface RecordLiftRequest {
 	Week: number;
 	Iteration: number;
 	ToFailure: boolean;
+	RPE?: number;
+	RIR?: number;
+	Extra?: ExtraSet;
 }
 
 export interface SkipOptionalWeekRequest {
@@ -96,3 +174,97 @@ export interface SkipOptionalWeekRequest {
 	Iteration: number;
 	Note: string;
 }
+
+export interface EditLiftRequest {
+	id: number;
+	note: string;
+	reps: number;
+	rpe?: number;
+	rir?: number;
+}
+
+export type SyncOpType = 'RECORD' | 'EDIT' | 'SKIP';
+
+export interface SyncOp {
+	ID: string;
+	Type: SyncOpType;
+	At: string;
+	Record?: RecordLiftRequest;
+	Edit?: EditLiftRequest;
+	Skip?: SkipOptionalWeekRequest;
+	// The ID of the operation that recorded the lift to edit, for lifts
+	// recorded offline.
+	EditOp?: string;
+}
+
+export interface SyncRequest {
+	Operations: SyncOp[];
+}
+
+export type SyncStatus = 'APPLIED' | 'CONFLICT' | 'INVALID' | 'NOT_APPLIED';
+
+export interface SyncResult {
+	ID: string;
+	Status: SyncStatus;
+	Error?: string;
+	Replayed: boolean;
+	Lift?: Lift;
+	NewRepRecord?: boolean;
+	Achievements?: Achievement[];
+}
+
+export interface SyncResponse {
+	Results: SyncResult[];
+	NextLift: NextLiftResponse;
+}
+
+export type TrendPeriod = 'SESSION' | 'WEEK' | 'ITERATION';
+
+export interface TrendPoint {
+	IterationNumber: number;
+	WeekNumber: number;
+	DayNumber: number;
+	LiftID: number;
+	Date: string;
+	OneRepMax: Weight;
+	RollingAverage: Weight;
+}
+
+export interface OneRepMaxTrendResponse {
+	Exercise: Exercise;
+	Period: TrendPeriod;
+	Window: number;
+	Points: TrendPoint[];
+	SlopePerPeriod: number;
+}
+
+export type VolumeGroup = 'EXERCISE' | 'SET_TYPE' | 'DAY' | 'WEEK' | 'ITERATION';
+
+export interface VolumeStats {
+	Exercise?: Exercise;
+	SetType?: SetType;
+	IterationNumber: number;
+	WeekNumber: number;
+	DayNumber: number;
+	Sets: number;
+	HardSets: number;
+	TotalReps: number;
+	Tonnage: Weight;
+	AverageIntensity: number;
+}
+
+export type EventType =
+	| 'LIFT_RECORDED'
+	| 'LIFT_EDITED'
+	| 'TRAINING_MAXES_CHANGED'
+	| 'WEEK_SKIPPED'
+	| 'RESET';
+
+export interface EventData {
+	Lift?: Lift;
+	// Week and Iteration are only meaningful for WEEK_SKIPPED events, and are
+	// zero otherwise.
+	Week: number;
+	Iteration: number;
+	NextLift?: NextLiftResponse;
+}
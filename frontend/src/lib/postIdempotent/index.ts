@@ -0,0 +1,40 @@
+import apipath from '$lib/apipath';
+
+// newKey returns a random idempotency key. crypto.randomUUID would be nicer,
+// but it's only available over HTTPS.
+const newKey = (): string =>
+	Array.from(crypto.getRandomValues(new Uint8Array(16)), (b) =>
+		b.toString(16).padStart(2, '0')
+	).join('');
+
+// postIdempotent POSTs body as JSON with a fresh idempotency key, retrying
+// with the same key if the request fails, the server has trouble, or the
+// server is still handling an earlier attempt (a 409 with Retry-After). The
+// server reserves a key before handling a request and replays the response
+// once it's saved, so a retry doesn't redo a request that succeeded. The
+// exception is a successful response the server failed to save, which it
+// only logs, so a retry could still be handled again, and would most likely
+// conflict.
+const postIdempotent = async (path: string, body: unknown, attempts = 5): Promise<Response> => {
+	const key = newKey();
+	for (let i = 1; ; i++) {
+		try {
+			const resp = await fetch(apipath(path), {
+				method: 'POST',
+				headers: { 'Idempotency-Key': key },
+				body: JSON.stringify(body)
+			});
+			const inProgress = resp.status === 409 && resp.headers.has('Retry-After');
+			if ((resp.status < 500 && !inProgress) || i >= attempts) {
+				return resp;
+			}
+		} catch (err) {
+			if (i >= attempts) {
+				throw err;
+			}
+		}
+		await new Promise((resolve) => setTimeout(resolve, 500 * 2 ** i));
+	}
+};
+
+export default postIdempotent;
@@ -3,14 +3,19 @@ module github.com/bcspragu/stronk
 go 1.21
 
 require (
-	github.com/golang-migrate/migrate/v4 v4.14.1
+	github.com/fergusstrange/embedded-postgres v1.25.0
+	github.com/golang-migrate/migrate/v4 v4.15.2
 	github.com/google/go-cmp v0.5.6
-	github.com/mattn/go-sqlite3 v1.14.7
+	github.com/lib/pq v1.10.4
+	github.com/mattn/go-sqlite3 v1.14.10
 	github.com/namsral/flag v1.7.4-pre
 	github.com/rs/cors v1.9.0
 )
 
 require (
-	github.com/hashicorp/errwrap v1.0.0 // indirect
-	github.com/hashicorp/go-multierror v1.1.0 // indirect
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
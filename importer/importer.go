@@ -0,0 +1,421 @@
+// Package importer loads training history from other apps' CSV exports, so
+// that records and comparables account for training from before stronk.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/export"
+)
+
+type Format string
+
+const (
+	Strong   = Format("STRONG")
+	Hevy     = Format("HEVY")
+	FitNotes = Format("FITNOTES")
+)
+
+var ErrInvalidFormat = errors.New("format must be STRONG, HEVY or FITNOTES")
+
+// ParseFormat parses an export format, case-insensitively.
+func ParseFormat(in string) (Format, error) {
+	switch f := Format(strings.ToUpper(in)); f {
+	case Strong, Hevy, FitNotes:
+		return f, nil
+	default:
+		return "", ErrInvalidFormat
+	}
+}
+
+// Mapping maps exercise names, as they appear in another app's export, to
+// stronk exercises. Names are matched case-insensitively, and sets of
+// exercises that aren't in the mapping are skipped.
+type Mapping map[string]stronk.Exercise
+
+// DefaultMapping maps the names the supported apps use for the main lifts.
+func DefaultMapping() Mapping {
+	return Mapping{
+		// Strong and Hevy
+		"Overhead Press (Barbell)": stronk.OverheadPress,
+		"Squat (Barbell)":          stronk.Squat,
+		"Bench Press (Barbell)":    stronk.BenchPress,
+		"Deadlift (Barbell)":       stronk.Deadlift,
+		// FitNotes
+		"Overhead Press":           stronk.OverheadPress,
+		"Barbell Squat":            stronk.Squat,
+		"Flat Barbell Bench Press": stronk.BenchPress,
+		"Deadlift":                 stronk.Deadlift,
+	}
+}
+
+// LoadMapping reads a mapping from a JSON object of names to exercises, e.g.
+// {"Squat (Barbell)": "SQUAT"}.
+func LoadMapping(r io.Reader) (Mapping, error) {
+	var m Mapping
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping: %w", err)
+	}
+	return m, nil
+}
+
+func (m Mapping) lookup(name string) (stronk.Exercise, bool) {
+	name = strings.TrimSpace(name)
+	for k, ex := range m {
+		if strings.EqualFold(k, name) {
+			return ex, true
+		}
+	}
+	return "", false
+}
+
+type Options struct {
+	Format  Format
+	Mapping Mapping
+	// Unit is the unit weights are in, for formats that don't say. Defaults to
+	// pounds.
+	Unit export.Unit
+	// Location is the time zone that timestamps in the export are in. Defaults
+	// to UTC.
+	Location *time.Location
+}
+
+type Result struct {
+	// Lifts are the parsed sets, as historical lifts.
+	Lifts []*stronk.Lift
+	// Unmapped counts the sets that were skipped because their exercise wasn't
+	// in the mapping, keyed by exercise name.
+	Unmapped map[string]int
+}
+
+// Store is the subset of server.DB needed for importing.
+type Store interface {
+	ImportData(ctx context.Context, data *stronk.UserData) (*stronk.ImportResult, error)
+}
+
+// Import parses the export and inserts its sets as historical lifts. Sets
+// that were already imported are skipped.
+func Import(ctx context.Context, store Store, r io.Reader, opts Options) (*Result, *stronk.ImportResult, error) {
+	res, err := Parse(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	imported, err := store.ImportData(ctx, &stronk.UserData{Lifts: res.Lifts})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to import lifts: %w", err)
+	}
+	return res, imported, nil
+}
+
+// row is a single set, in a format-independent way.
+type row struct {
+	exercise string
+	at       time.Time
+	weight   float64
+	unit     export.Unit
+	reps     int
+	warmup   bool
+	rpe      float64
+	note     string
+}
+
+// Parse reads sets from an export. Other apps don't distinguish rep-max sets
+// from the rest, so no set is treated as being to failure, which keeps
+// ordinary working sets out of the comparisons made against to-failure sets.
+func Parse(r io.Reader, opts Options) (*Result, error) {
+	if opts.Unit == "" {
+		opts.Unit = export.Pounds
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	recs, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, errors.New("export is empty")
+	}
+	cols, recs := newHeader(recs[0]), recs[1:]
+
+	var parse func(h header, rec []string, opts Options) (*row, error)
+	switch opts.Format {
+	case Strong:
+		parse = parseStrong
+	case Hevy:
+		parse = parseHevy
+	case FitNotes:
+		parse = parseFitNotes
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	res := &Result{Unmapped: make(map[string]int)}
+	// Sets are numbered per exercise within each workout.
+	type workoutKey struct {
+		at time.Time
+		ex stronk.Exercise
+	}
+	setNums := make(map[workoutKey]int)
+	for i, rec := range recs {
+		rw, err := parse(cols, rec, opts)
+		if err != nil {
+			// +2 for the header and one-indexing.
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		if rw == nil {
+			continue
+		}
+		ex, ok := opts.Mapping.lookup(rw.exercise)
+		if !ok {
+			res.Unmapped[rw.exercise]++
+			continue
+		}
+		weight, err := toWeight(rw.weight, rw.unit)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+
+		st := stronk.Main
+		if rw.warmup {
+			st = stronk.Warmup
+		} else if !isMainExercise(ex) {
+			st = stronk.Assistance
+		}
+		if stronk.ValidateEffort(rw.rpe, nil) != nil {
+			rw.rpe = 0
+		}
+
+		key := workoutKey{at: rw.at, ex: ex}
+		res.Lifts = append(res.Lifts, &stronk.Lift{
+			Exercise:        ex,
+			SetType:         st,
+			Weight:          weight,
+			SetNumber:       setNums[key],
+			Reps:            rw.reps,
+			Note:            rw.note,
+			IterationNumber: stronk.HistoricalIteration,
+			RPE:             rw.rpe,
+			CreatedAt:       rw.at.UTC(),
+		})
+		setNums[key]++
+	}
+
+	sort.SliceStable(res.Lifts, func(i, j int) bool {
+		return res.Lifts[i].CreatedAt.Before(res.Lifts[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func parseStrong(h header, rec []string, opts Options) (*row, error) {
+	reps, err := h.int(rec, "Reps")
+	if err != nil || reps <= 0 {
+		// Cardio and timed sets don't have reps, we skip those.
+		return nil, err
+	}
+	at, err := h.time(rec, "Date", opts.Location, "2006-01-02 15:04:05")
+	if err != nil {
+		return nil, err
+	}
+	weight, err := h.float(rec, "Weight")
+	if err != nil {
+		return nil, err
+	}
+	rpe, err := h.float(rec, "RPE")
+	if err != nil {
+		return nil, err
+	}
+	return &row{
+		exercise: h.get(rec, "Exercise Name"),
+		at:       at,
+		weight:   weight,
+		unit:     opts.Unit,
+		reps:     reps,
+		warmup:   strings.EqualFold(h.get(rec, "Set Order"), "W"),
+		rpe:      rpe,
+		note:     h.get(rec, "Notes"),
+	}, nil
+}
+
+func parseHevy(h header, rec []string, opts Options) (*row, error) {
+	reps, err := h.int(rec, "reps")
+	if err != nil || reps <= 0 {
+		return nil, err
+	}
+	at, err := h.time(rec, "start_time", opts.Location, "2 Jan 2006, 15:04", "2006-01-02 15:04:05")
+	if err != nil {
+		return nil, err
+	}
+	// Hevy says which unit it uses in the column name.
+	unit, weightCol := export.Pounds, "weight_lbs"
+	if h.has("weight_kg") {
+		unit, weightCol = export.Kilograms, "weight_kg"
+	}
+	weight, err := h.float(rec, weightCol)
+	if err != nil {
+		return nil, err
+	}
+	rpe, err := h.float(rec, "rpe")
+	if err != nil {
+		return nil, err
+	}
+	return &row{
+		exercise: h.get(rec, "exercise_title"),
+		at:       at,
+		weight:   weight,
+		unit:     unit,
+		reps:     reps,
+		warmup:   strings.EqualFold(h.get(rec, "set_type"), "warmup"),
+		rpe:      rpe,
+		note:     h.get(rec, "exercise_notes"),
+	}, nil
+}
+
+func parseFitNotes(h header, rec []string, opts Options) (*row, error) {
+	reps, err := h.int(rec, "Reps")
+	if err != nil || reps <= 0 {
+		return nil, err
+	}
+	// FitNotes only records the day.
+	at, err := h.time(rec, "Date", opts.Location, "2006-01-02")
+	if err != nil {
+		return nil, err
+	}
+	unit, weightCol := opts.Unit, ""
+	switch {
+	case h.has("Weight (lbs)"):
+		unit, weightCol = export.Pounds, "Weight (lbs)"
+	case h.has("Weight (kgs)"):
+		unit, weightCol = export.Kilograms, "Weight (kgs)"
+	case h.has("Weight (kg)"):
+		unit, weightCol = export.Kilograms, "Weight (kg)"
+	default:
+		weightCol = "Weight"
+	}
+	weight, err := h.float(rec, weightCol)
+	if err != nil {
+		return nil, err
+	}
+	return &row{
+		exercise: h.get(rec, "Exercise"),
+		at:       at,
+		weight:   weight,
+		unit:     unit,
+		reps:     reps,
+		note:     h.get(rec, "Comment"),
+	}, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	dat, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	content := strings.TrimPrefix(string(dat), "\ufeff")
+
+	cr := csv.NewReader(strings.NewReader(content))
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	// Strong uses semicolons in locales where commas are decimal separators.
+	firstLine, _, _ := strings.Cut(content, "\n")
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		cr.Comma = ';'
+	}
+
+	recs, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return recs, nil
+}
+
+// header maps column names, case-insensitively, to their index.
+type header map[string]int
+
+func newHeader(cols []string) header {
+	h := make(header)
+	for i, c := range cols {
+		h[strings.ToLower(strings.TrimSpace(c))] = i
+	}
+	return h
+}
+
+func (h header) has(col string) bool {
+	_, ok := h[strings.ToLower(col)]
+	return ok
+}
+
+func (h header) get(rec []string, col string) string {
+	i, ok := h[strings.ToLower(col)]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+// float parses a numeric column, treating empty values as zero.
+func (h header) float(rec []string, col string) (float64, error) {
+	v := h.get(rec, col)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", col, v, err)
+	}
+	return f, nil
+}
+
+func (h header) int(rec []string, col string) (int, error) {
+	f, err := h.float(rec, col)
+	if err != nil {
+		return 0, err
+	}
+	return int(f), nil
+}
+
+func (h header) time(rec []string, col string, loc *time.Location, layouts ...string) (time.Time, error) {
+	v := h.get(rec, col)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %q", col, v)
+}
+
+func toWeight(v float64, unit export.Unit) (stronk.Weight, error) {
+	if v < 0 {
+		return stronk.Weight{}, fmt.Errorf("invalid weight %v", v)
+	}
+	lbs := v
+	switch unit {
+	case export.Pounds:
+	case export.Kilograms:
+		lbs = v / export.KilogramsPerPound
+	default:
+		return stronk.Weight{}, export.ErrInvalidUnit
+	}
+	return stronk.Weight{Unit: stronk.DeciPounds, Value: int(math.Round(lbs * 10))}, nil
+}
+
+func isMainExercise(ex stronk.Exercise) bool {
+	for _, main := range stronk.MainExercises() {
+		if ex == main {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/export"
+	"github.com/bcspragu/stronk/testing/testdb"
+	"github.com/google/go-cmp/cmp"
+)
+
+const strongCSV = `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2022-03-01 07:30:00,"Morning",45m,"Squat (Barbell)",W,135,5,0,0,"","",
+2022-03-01 07:30:00,"Morning",45m,"Squat (Barbell)",1,225,5,0,0,"felt heavy","",8.5
+2022-03-01 07:30:00,"Morning",45m,"Running",1,0,0,3.1,1800,"","",
+2022-03-01 07:30:00,"Morning",45m,"Bicep Curl (Dumbbell)",1,30,10,0,0,"","",
+`
+
+const hevyCSV = `"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes","set_index","set_type","weight_kg","reps","distance_km","duration_seconds","rpe"
+"Push","2 Jan 2023, 18:05","2 Jan 2023, 19:00","","Bench Press (Barbell)",,"",0,"warmup",40,8,,,
+"Push","2 Jan 2023, 18:05","2 Jan 2023, 19:00","","Bench Press (Barbell)",,"",1,"normal",100,3,,,9
+`
+
+const fitNotesCSV = `Date,Exercise,Category,Weight (lbs),Reps,Distance,Distance Unit,Time,Comment
+2019-01-28,Deadlift,Back,315.0,5,,,,
+2019-01-28,Deadlift,Back,335.0,3,,,,"PR!"
+`
+
+func TestParse(t *testing.T) {
+	nyc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+	mapping := DefaultMapping()
+	mapping["bicep curl (dumbbell)"] = "CURL"
+
+	lift := func(ex stronk.Exercise, st stronk.SetType, at time.Time, set, weight, reps int, fn func(l *stronk.Lift)) *stronk.Lift {
+		l := &stronk.Lift{
+			Exercise:        ex,
+			SetType:         st,
+			Weight:          stronk.Weight{Unit: stronk.DeciPounds, Value: weight},
+			SetNumber:       set,
+			Reps:            reps,
+			IterationNumber: stronk.HistoricalIteration,
+			CreatedAt:       at,
+		}
+		if fn != nil {
+			fn(l)
+		}
+		return l
+	}
+
+	strongAt := time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC)
+	hevyAt := time.Date(2023, 1, 2, 18, 5, 0, 0, time.UTC)
+	fitNotesAt := time.Date(2019, 1, 28, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc string
+		in   string
+		opts Options
+		want *Result
+	}{
+		{
+			desc: "Strong",
+			in:   strongCSV,
+			opts: Options{Format: Strong, Mapping: mapping, Location: nyc},
+			want: &Result{
+				Lifts: []*stronk.Lift{
+					lift(stronk.Squat, stronk.Warmup, strongAt, 0, 1350, 5, nil),
+					lift(stronk.Squat, stronk.Main, strongAt, 1, 2250, 5, func(l *stronk.Lift) {
+						l.RPE = 8.5
+						l.Note = "felt heavy"
+					}),
+					lift("CURL", stronk.Assistance, strongAt, 0, 300, 10, nil),
+				},
+				// Running doesn't have reps, so it's skipped before mapping.
+				Unmapped: map[string]int{},
+			},
+		},
+		{
+			desc: "Hevy, in kilograms",
+			in:   hevyCSV,
+			// Hevy gives the unit in the header, which takes precedence.
+			opts: Options{Format: Hevy, Mapping: mapping, Unit: export.Pounds},
+			want: &Result{
+				Lifts: []*stronk.Lift{
+					lift(stronk.BenchPress, stronk.Warmup, hevyAt, 0, 882, 8, nil),
+					lift(stronk.BenchPress, stronk.Main, hevyAt, 1, 2205, 3, func(l *stronk.Lift) { l.RPE = 9 }),
+				},
+				Unmapped: map[string]int{},
+			},
+		},
+		{
+			desc: "FitNotes",
+			in:   fitNotesCSV,
+			opts: Options{Format: FitNotes, Mapping: mapping},
+			want: &Result{
+				Lifts: []*stronk.Lift{
+					lift(stronk.Deadlift, stronk.Main, fitNotesAt, 0, 3150, 5, nil),
+					lift(stronk.Deadlift, stronk.Main, fitNotesAt, 1, 3350, 3, func(l *stronk.Lift) { l.Note = "PR!" }),
+				},
+				Unmapped: map[string]int{},
+			},
+		},
+		{
+			desc: "unmapped exercises",
+			in:   strongCSV,
+			opts: Options{Format: Strong, Mapping: Mapping{"squat (barbell)": stronk.Squat}},
+			want: &Result{
+				Lifts: []*stronk.Lift{
+					lift(stronk.Squat, stronk.Warmup, time.Date(2022, 3, 1, 7, 30, 0, 0, time.UTC), 0, 1350, 5, nil),
+					lift(stronk.Squat, stronk.Main, time.Date(2022, 3, 1, 7, 30, 0, 0, time.UTC), 1, 2250, 5, func(l *stronk.Lift) {
+						l.RPE = 8.5
+						l.Note = "felt heavy"
+					}),
+				},
+				Unmapped: map[string]int{"Bicep Curl (Dumbbell)": 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(test.in), test.opts)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected result (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	in := `Date,Exercise Name,Set Order,Weight,Reps
+not a date,Squat (Barbell),1,225,5
+`
+	_, err := Parse(strings.NewReader(in), Options{Format: Strong, Mapping: DefaultMapping()})
+	if err == nil {
+		t.Fatal("Parse succeeded, want an error")
+	}
+	if got, want := err.Error(), `line 2: invalid Date "not a date"`; got != want {
+		t.Errorf("Parse returned error %q, want %q", got, want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	db := testdb.New()
+	opts := Options{Format: FitNotes, Mapping: DefaultMapping()}
+
+	_, imported, err := Import(context.Background(), db, strings.NewReader(fitNotesCSV), opts)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if diff := cmp.Diff(&stronk.ImportResult{Lifts: 2}, imported); diff != "" {
+		t.Errorf("unexpected first import (-want +got)\n%s", diff)
+	}
+
+	_, imported, err = Import(context.Background(), db, strings.NewReader(fitNotesCSV), opts)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if diff := cmp.Diff(&stronk.ImportResult{Duplicates: 2}, imported); diff != "" {
+		t.Errorf("unexpected second import (-want +got)\n%s", diff)
+	}
+
+	// Historical lifts don't count towards the routine.
+	recent, err := db.RecentLifts(context.Background())
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if n := len(recent); n != 0 {
+		t.Errorf("got %d recent lifts, want none", n)
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcspragu/stronk"
+)
+
+type eventType string
+
+const (
+	eventLiftRecorded         eventType = "LIFT_RECORDED"
+	eventLiftEdited           eventType = "LIFT_EDITED"
+	eventTrainingMaxesChanged eventType = "TRAINING_MAXES_CHANGED"
+	eventWeekSkipped          eventType = "WEEK_SKIPPED"
+	// eventReset tells a reconnecting client that we don't have the events it
+	// missed, so it needs to reload everything.
+	eventReset eventType = "RESET"
+)
+
+type eventData struct {
+	// Lift is set for lift events.
+	Lift *stronk.Lift `json:",omitempty"`
+	// Week and Iteration are set when a week is skipped. They're always sent,
+	// since the first week and iteration are both zero.
+	Week      int
+	Iteration int
+	// NextLift is what's up next after the change, since that's what other
+	// devices are looking at. It's missing if we failed to load it, in which
+	// case clients should load it themselves.
+	NextLift *nextLiftResp `json:",omitempty"`
+}
+
+type event struct {
+	ID   string
+	Type eventType
+	Data []byte
+}
+
+const (
+	// eventHistory is how many events are kept for clients that reconnect,
+	// which covers a phone being locked for a few workouts' worth of sets.
+	eventHistory = 256
+	// subscriberBuffer is how far a client can fall behind before it's
+	// disconnected, after which it can reconnect and catch up from history.
+	subscriberBuffer = 16
+	// keepAliveInterval is how often idle streams get a comment, so that proxies
+	// don't close them.
+	keepAliveInterval = 15 * time.Second
+)
+
+// eventBus fans events out to subscribers, keeping recent ones so clients
+// that reconnect with the last event ID they saw don't miss anything.
+type eventBus struct {
+	// boot prefixes event IDs, so that IDs from before a restart aren't
+	// mistaken for ones from this process.
+	boot string
+
+	// changing is held from making a change until its event is published, so
+	// that events go out in the order their changes were made, and an older
+	// change's event can't overwrite a newer one's on clients. It's a channel
+	// rather than a mutex so that waiting on it respects the request's
+	// context.
+	changing chan struct{}
+
+	mu      sync.Mutex
+	seq     uint64
+	history []*event
+	subs    map[chan *event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		boot:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		changing: make(chan struct{}, 1),
+		subs:     make(map[chan *event]struct{}),
+	}
+}
+
+// lock waits for any other change to be published, or for ctx to be done.
+// unlock must be called once the caller's change is published, if it
+// succeeds.
+func (b *eventBus) lock(ctx context.Context) error {
+	select {
+	case b.changing <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *eventBus) unlock() {
+	<-b.changing
+}
+
+func (b *eventBus) publish(typ eventType, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := &event{ID: b.eventID(b.seq), Type: typ, Data: data}
+	b.history = append(b.history, e)
+	if len(b.history) > eventHistory {
+		b.history = b.history[len(b.history)-eventHistory:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// Too slow, drop it rather than holding up everyone else.
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the events after lastID, and a channel of events after
+// those, which is closed if the subscriber falls too far behind. unsubscribe
+// must be called once the caller is done.
+func (b *eventBus) subscribe(lastID string) (missed []*event, ch <-chan *event, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	missed = b.since(lastID)
+
+	c := make(chan *event, subscriberBuffer)
+	b.subs[c] = struct{}{}
+	return missed, c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
+
+// since returns the events after lastID, or a reset if we don't have them.
+func (b *eventBus) since(lastID string) []*event {
+	if lastID == "" {
+		return nil
+	}
+	if boot, seqStr, found := strings.Cut(lastID, "-"); found && boot == b.boot {
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err == nil && seq <= b.seq && b.seq-seq <= uint64(len(b.history)) {
+			return append([]*event(nil), b.history[uint64(len(b.history))-(b.seq-seq):]...)
+		}
+	}
+	// The reset carries the latest ID, so that the next reconnect picks up from
+	// here.
+	return []*event{{ID: b.eventID(b.seq), Type: eventReset, Data: []byte("{}")}}
+}
+
+func (b *eventBus) eventID(seq uint64) string {
+	if seq == 0 {
+		return ""
+	}
+	return b.boot + "-" + strconv.FormatUint(seq, 10)
+}
+
+// change makes a change with fn, and tells connected clients about it with
+// the event data fn returns, unless fn fails. Only one change is made at a
+// time, so everything the event says about the state after the change, like
+// what's up next, should be loaded in fn, so that it's exactly as of that
+// change. Nothing else should be done in fn, since other changes wait on it.
+func (s *Server) change(ctx context.Context, typ eventType, fn func() (*eventData, error)) error {
+	if err := s.events.lock(ctx); err != nil {
+		return err
+	}
+	defer s.events.unlock()
+
+	data, err := fn()
+	if err != nil {
+		return err
+	}
+	dat, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("failed to marshal %s event: %v", typ, err)
+		return nil
+	}
+	s.events.publish(typ, dat)
+	return nil
+}
+
+// serveEvents streams changes as Server-Sent Events. Browsers reconnect with
+// the Last-Event-ID header set, and get the events they missed, or a RESET
+// event if they've been gone too long.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+
+	missed, ch, unsubscribe := s.events.subscribe(r.Header.Get("Last-Event-ID"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range missed {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes an event in the text/event-stream format. An empty ID is
+// still written, since that clears a stale one the client had.
+func writeEvent(w http.ResponseWriter, e *event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+}
@@ -1,16 +1,26 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"slices"
 
 	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/analytics"
+	"github.com/bcspragu/stronk/backup"
+	"github.com/bcspragu/stronk/export"
 )
 
 // SecureCookie represents anything that knows how to encode and decode cookies
@@ -21,23 +31,81 @@ type SecureCookie interface {
 	UseSecure() bool
 }
 
+// DB is the storage used by the server. Every method takes the context of the
+// request it's serving, and should give up once it's done.
 type DB interface {
-	SkippedWeeks() ([]stronk.SkippedWeek, error)
-	SkipWeek(note string, week, iter int) error
-
-	SetTrainingMaxes(press, squat, bench, deadlift stronk.Weight) error
-	TrainingMaxes() ([]*stronk.TrainingMax, error)
-
-	SetSmallestDenom(small stronk.Weight) error
-	SmallestDenom() (stronk.Weight, error)
-
-	RecordLift(ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool) (stronk.LiftID, error)
+	SkippedWeeks(ctx context.Context) ([]stronk.SkippedWeek, error)
+	SkipWeek(ctx context.Context, note string, week, iter int) error
+	// SkipNextWeek skips a week in the same transaction as loading the workout
+	// context it follows on from, like RecordNextLift. check is called with
+	// that context first, and nothing is skipped if it returns an error. The
+	// returned context includes the skipped week.
+	SkipNextWeek(ctx context.Context, note string, week, iter int, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error) (*stronk.WorkoutContext, error)
+
+	SetTrainingMaxes(ctx context.Context, press, squat, bench, deadlift stronk.Weight) error
+	TrainingMaxes(ctx context.Context) ([]*stronk.TrainingMax, error)
+	// TrainingMaxHistory returns every training max ever set, oldest first.
+	TrainingMaxHistory(ctx context.Context) ([]*stronk.TrainingMax, error)
+
+	SetSmallestDenom(ctx context.Context, small stronk.Weight) error
+	SmallestDenom(ctx context.Context) (stronk.Weight, error)
+
+	RecordLift(ctx context.Context, ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool, extra stronk.ExtraSet, rpe float64, rir *int) (stronk.LiftID, error)
+
+	Lift(ctx context.Context, id stronk.LiftID) (*stronk.Lift, error)
+	EditLift(ctx context.Context, id stronk.LiftID, note string, reps int, rpe float64, rir *int) error
+	// RecentLifts returns the most recent lifts in the routine, newest first.
+	// Historical lifts aren't included.
+	RecentLifts(ctx context.Context) ([]*stronk.Lift, error)
+	// LiftHistory returns all lifts matching the filter, oldest first.
+	LiftHistory(ctx context.Context, filter stronk.LiftFilter) ([]*stronk.Lift, error)
+
+	RecordAchievements(ctx context.Context, achs []*stronk.Achievement) error
+	// Achievements returns achievements for the given exercise, or all
+	// exercises if empty, newest first.
+	Achievements(ctx context.Context, ex stronk.Exercise) ([]*stronk.Achievement, error)
+	// WorkoutContext loads everything needed to figure out the next lift in one
+	// consistent read, with failure sets for the given exercises.
+	WorkoutContext(ctx context.Context, exs []stronk.Exercise) (*stronk.WorkoutContext, error)
+	// RecordNextLift records a lift in the same transaction as loading the
+	// workout context it follows on from. check is called with that context
+	// first, and nothing is recorded if it returns an error. The lift is
+	// recorded as done at l.CreatedAt if set, otherwise now. If achieve isn't
+	// nil, it's called with the new lift's ID and its exercise's history, as
+	// LiftHistory would return it, and the achievements it returns are
+	// recorded in the same transaction. The returned context includes the new
+	// lift.
+	RecordNextLift(ctx context.Context, l *stronk.Lift, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error, achieve func(stronk.LiftID, []*stronk.Lift) []*stronk.Achievement) (stronk.LiftID, *stronk.WorkoutContext, error)
+	RecentFailureSets(ctx context.Context) ([]*stronk.Lift, error)
+
+	// SavedResponse returns what's saved for an idempotency key, or nil if
+	// there isn't anything.
+	SavedResponse(ctx context.Context, key string) (*stronk.SavedResponse, error)
+	// ReserveResponse reserves resp.Key for a request that's about to be
+	// handled, saving it with no status or body. If the key was already taken,
+	// what's saved for it is returned instead, which has no status if that
+	// request is still being handled. Responses saved before expireBefore are
+	// deleted first, as are reservations made before abandonBefore, so that a
+	// request that never finished doesn't hold up retries.
+	ReserveResponse(ctx context.Context, resp *stronk.SavedResponse, abandonBefore, expireBefore time.Time) (*stronk.SavedResponse, error)
+	// SaveResponse saves the response for a key reserved with ReserveResponse.
+	SaveResponse(ctx context.Context, resp *stronk.SavedResponse) error
+	// ReleaseResponse deletes the reservation for a key if no response was
+	// saved for it, so that a failed request can be retried.
+	ReleaseResponse(ctx context.Context, key string) error
+
+	// ExportData returns everything the user has recorded.
+	ExportData(ctx context.Context) (*stronk.UserData, error)
+	// ImportData inserts the given data in a single transaction, skipping any
+	// records that already exist. Lift IDs in the data are ignored.
+	ImportData(ctx context.Context, data *stronk.UserData) (*stronk.ImportResult, error)
+}
 
-	Lift(id stronk.LiftID) (*stronk.Lift, error)
-	EditLift(id stronk.LiftID, note string, reps int) error
-	RecentLifts() ([]*stronk.Lift, error)
-	ComparableLifts(ex stronk.Exercise, weight stronk.Weight) (*stronk.ComparableLifts, error)
-	RecentFailureSets() ([]*stronk.Lift, error)
+// Backups takes and lists snapshots of the database, see backup.Manager.
+type Backups interface {
+	Snapshot() (*backup.Snapshot, error)
+	// Snapshots returns existing snapshots, newest first.
+	Snapshots() ([]*backup.Snapshot, error)
 }
 
 type Server struct {
@@ -46,18 +114,41 @@ type Server struct {
 	routine *stronk.Routine
 	cookies SecureCookie
 	db      DB
+	backups Backups
+	now     func() time.Time
+	timeout time.Duration
+	events  *eventBus
 }
 
 func New(routine *stronk.Routine, db DB) *Server {
 	s := &Server{
 		routine: routine,
 		db:      db,
+		now:     time.Now,
+		events:  newEventBus(),
 	}
 	s.initMux()
 	return s
 }
 
+// SetBackups enables the backup admin endpoints, which otherwise return a 404.
+func (s *Server) SetBackups(b Backups) {
+	s.backups = b
+}
+
+// SetRequestTimeout limits how long each request can take, after which its
+// context is canceled and any database calls give up. Zero means no limit.
+func (s *Server) SetRequestTimeout(d time.Duration) {
+	s.timeout = d
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The event stream stays open for as long as the client is listening.
+	if s.timeout > 0 && r.URL.Path != "/api/events" {
+		ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
 	s.mux.ServeHTTP(w, r)
 }
 
@@ -67,24 +158,153 @@ func (s *Server) initMux() {
 	mux.HandleFunc("/api/setTrainingMaxes", s.serveSetTrainingMaxes)
 
 	mux.HandleFunc("/api/nextLift", s.serveNextLift)
-	mux.HandleFunc("/api/recordLift", s.serveRecordLift)
+	mux.HandleFunc("/api/recordLift", s.idempotent(s.serveRecordLift))
 	mux.HandleFunc("/api/lift", s.serveLoadLift)
-	mux.HandleFunc("/api/editLift", s.serveEditLift)
+	mux.HandleFunc("/api/editLift", s.idempotent(s.serveEditLift))
+
+	mux.HandleFunc("/api/skipOptionalWeek", s.idempotent(s.skipOptionalWeek))
+	mux.HandleFunc("/api/sync", s.idempotent(s.serveSync))
+	mux.HandleFunc("/api/events", s.serveEvents)
+
+	mux.HandleFunc("/api/records", s.serveRecords)
+	mux.HandleFunc("/api/achievements", s.serveAchievements)
+
+	mux.HandleFunc("/api/analytics/e1rm", s.serveOneRepMaxTrend)
+	mux.HandleFunc("/api/stats", s.serveVolumeStats)
 
-	mux.HandleFunc("/api/skipOptionalWeek", s.skipOptionalWeek)
+	mux.HandleFunc("/api/export", s.serveExport)
+	mux.HandleFunc("/api/export/lifts.csv", s.serveExportLiftsCSV)
+	mux.HandleFunc("/api/import", s.serveImport)
+
+	mux.HandleFunc("/api/admin/backups", s.serveBackups)
 
 	s.mux = mux
 }
 
+// idempotencyKeyTTL is how long responses to requests with an idempotency key
+// are kept for retries, which is long enough to cover lifts queued up by a
+// client that was offline for the whole workout.
+const idempotencyKeyTTL = 7 * 24 * time.Hour
+
+// idempotencyAbandonAfter is how long a key stays reserved for a request that
+// never finished, e.g. because the server went down while handling it.
+const idempotencyAbandonAfter = 5 * time.Minute
+
+// idempotent wraps a handler so that a request with an Idempotency-Key header
+// is only handled once. The key is reserved before the request is handled, so
+// a duplicate that arrives in the meantime gets a 409 with a Retry-After
+// header rather than being handled again. Successful responses are saved, and
+// retries with the same key get the saved response back. Failed requests
+// release the key, so retrying them actually retries, which means wrapped
+// handlers must not fail once they've written anything.
+func (s *Server) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			h(w, r)
+			return
+		}
+
+		// A dropped connection shouldn't stop us from finishing and saving the
+		// response, since that's exactly when the client is going to retry.
+		ctx := context.WithoutCancel(r.Context())
+		if s.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+		}
+		r = r.WithContext(ctx)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+
+		resp := &stronk.SavedResponse{
+			Key:         key,
+			Path:        r.URL.Path,
+			RequestHash: hash,
+		}
+		now := s.now()
+		saved, err := s.db.ReserveResponse(ctx, resp, now.Add(-idempotencyAbandonAfter), now.Add(-idempotencyKeyTTL))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to reserve idempotency key: %v", err), errStatus(err))
+			return
+		}
+		if saved != nil {
+			if saved.Path != r.URL.Path || saved.RequestHash != hash {
+				http.Error(w, "idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+				return
+			}
+			if saved.Status == 0 {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "a request with this idempotency key is still being handled", http.StatusConflict)
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.Status)
+			w.Write(saved.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		handled := false
+		defer func() {
+			if handled && rec.status >= 200 && rec.status < 300 {
+				return
+			}
+			// Either the request failed or the handler panicked, and either way
+			// nothing was recorded, so a retry should be handled again.
+			if err := s.db.ReleaseResponse(ctx, key); err != nil {
+				log.Printf("failed to release idempotency key %q: %v", key, err)
+			}
+		}()
+		h(rec, r)
+		handled = true
+		if rec.status < 200 || rec.status >= 300 {
+			return
+		}
+		resp.Status = rec.status
+		resp.Body = rec.body.Bytes()
+		if err := s.db.SaveResponse(ctx, resp); err != nil {
+			// The client already has its response, the worst case is that a retry
+			// gets handled again once the reservation is abandoned.
+			log.Printf("failed to save response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// responseRecorder passes a response through, keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
 func (s *Server) serveTrainingMaxes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	tms, err := s.db.TrainingMaxes()
+	tms, err := s.db.TrainingMaxes(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 	// For JSON serialization
@@ -93,13 +313,13 @@ func (s *Server) serveTrainingMaxes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var sd *stronk.Weight
-	tmpSD, err := s.db.SmallestDenom()
+	tmpSD, err := s.db.SmallestDenom(ctx)
 	if err == nil {
 		sd = &tmpSD
 	} else if errors.Is(err, stronk.ErrNoSmallestDenom) {
 		// This is fine, just means we don't have one yet.
 	} else {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 
@@ -124,9 +344,9 @@ func (s *Server) serveTrainingMaxes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load the most recent full cycle of failure sets.
-	failureSets, err := s.db.RecentFailureSets()
+	failureSets, err := s.db.RecentFailureSets(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 	if len(failureSets) == 0 {
@@ -259,6 +479,7 @@ type trainingMaxResp struct {
 }
 
 func (s *Server) serveLoadLift(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
@@ -268,43 +489,98 @@ func (s *Server) serveLoadLift(w http.ResponseWriter, r *http.Request) {
 
 	id, err := strconv.Atoi(q.Get("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 
-	lift, err := s.db.Lift(stronk.LiftID(id))
+	lift, err := s.db.Lift(ctx, stronk.LiftID(id))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 	jsonResp(w, lift)
 }
 
 func (s *Server) serveEditLift(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	type editReq struct {
-		ID   stronk.LiftID `json:"id"`
-		Note string        `json:"note"`
-		Reps int           `json:"reps"`
-	}
-
 	var req editReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	err := s.db.EditLift(req.ID, req.Note, req.Reps)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := s.editLift(ctx, &req); err != nil {
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 }
 
+type editReq struct {
+	ID   stronk.LiftID `json:"id"`
+	Note string        `json:"note"`
+	Reps int           `json:"reps"`
+	RPE  float64       `json:"rpe"`
+	RIR  *int          `json:"rir"`
+}
+
+func (s *Server) editLift(ctx context.Context, req *editReq) error {
+	if err := stronk.ValidateEffort(req.RPE, req.RIR); err != nil {
+		return badRequest{err}
+	}
+	return s.change(ctx, eventLiftEdited, func() (*eventData, error) {
+		if err := s.db.EditLift(ctx, req.ID, req.Note, req.Reps, req.RPE, req.RIR); err != nil {
+			return nil, err
+		}
+		// The edit is saved, so failing now would have a retry edit it again.
+		data := &eventData{}
+		var err error
+		if data.Lift, err = s.db.Lift(ctx, req.ID); err != nil {
+			log.Printf("failed to load edited lift %d: %v", req.ID, err)
+		}
+		if data.NextLift, err = s.nextLift(ctx); err != nil {
+			log.Printf("failed to load next lift after editing lift %d: %v", req.ID, err)
+		}
+		return data, nil
+	})
+}
+
+// errConflict is returned when a request doesn't line up with the current
+// state of the routine, usually because another device got there first.
+var errConflict = errors.New("conflict")
+
+// badRequest wraps errors caused by an invalid request, as opposed to
+// something going wrong on our end.
+type badRequest struct {
+	err error
+}
+
+func (e badRequest) Error() string { return e.err.Error() }
+func (e badRequest) Unwrap() error { return e.err }
+
+func invalidf(format string, args ...interface{}) error {
+	return badRequest{fmt.Errorf(format, args...)}
+}
+
+// errStatus returns the status code for an error, which is a 500 unless the
+// request was invalid, ran out of time, or conflicted with another one.
+func errStatus(err error) int {
+	var br badRequest
+	switch {
+	case errors.As(err, &br):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 func jsonResp(w http.ResponseWriter, resp interface{}) {
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -313,6 +589,7 @@ func jsonResp(w http.ResponseWriter, resp interface{}) {
 }
 
 func (s *Server) serveSetTrainingMaxes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
@@ -371,13 +648,21 @@ func (s *Server) serveSetTrainingMaxes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.db.SetTrainingMaxes(press, squat, bench, deadlift); err != nil {
-		http.Error(w, fmt.Sprintf("failed to set training maxes: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	if err := s.db.SetSmallestDenom(smallestDenom); err != nil {
-		http.Error(w, fmt.Sprintf("failed to set smallest denom: %v", err), http.StatusInternalServerError)
+	err = s.change(ctx, eventTrainingMaxesChanged, func() (*eventData, error) {
+		if err := s.db.SetTrainingMaxes(ctx, press, squat, bench, deadlift); err != nil {
+			return nil, fmt.Errorf("failed to set training maxes: %w", err)
+		}
+		if err := s.db.SetSmallestDenom(ctx, smallestDenom); err != nil {
+			return nil, fmt.Errorf("failed to set smallest denom: %w", err)
+		}
+		nextLift, err := s.nextLift(ctx)
+		if err != nil {
+			log.Printf("failed to load next lift after setting training maxes: %v", err)
+		}
+		return &eventData{NextLift: nextLift}, nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 }
@@ -425,12 +710,13 @@ func parsePounds(in string) (stronk.Weight, error) {
 }
 
 func (s *Server) serveNextLift(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	s.nextLiftResponse(w)
+	s.nextLiftResponse(ctx, w)
 }
 
 type nextLiftResp struct {
@@ -443,64 +729,76 @@ type nextLiftResp struct {
 	NextMovementIndex int
 	NextSetIndex      int
 	OptionalWeek      bool
+
+	// Rest is only set if the user is partway through the day's workout.
+	Rest *stronk.RestStatus
+	// FinishedDay is only set if the next lift is on a new day, and the day
+	// before it still has extra sets on offer.
+	FinishedDay *finishedDay `json:",omitempty"`
+	// SessionRest is only set if the user has done at least two sets in the
+	// current session, or in the one they just finished if the next lift is on
+	// a new day.
+	SessionRest *stronk.RestStats
 }
 
-func (s *Server) nextLiftResponse(w http.ResponseWriter) {
-	nextLift, err := s.nextLift()
+// finishedDay is a day that's been finished, but still has extra sets that
+// can be done.
+type finishedDay struct {
+	DayNumber       int
+	WeekNumber      int
+	IterationNumber int
+	DayName         string
+	WeekName        string
+	// Workout is just the movements with extra sets on offer.
+	Workout []*stronk.Movement
+}
+
+func (s *Server) nextLiftResponse(ctx context.Context, w http.ResponseWriter) {
+	nextLift, err := s.nextLift(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
 	jsonResp(w, nextLift)
 }
 
-func (s *Server) nextLift() (*nextLiftResp, error) {
+func (s *Server) nextLift(ctx context.Context) (*nextLiftResp, error) {
+	wc, err := s.db.WorkoutContext(ctx, s.routine.FailureExercises())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workout context: %w", err)
+	}
+	return s.nextLiftFrom(wc)
+}
+
+// nextLiftFrom works out the next lift from a snapshot of the database.
+func (s *Server) nextLiftFrom(wc *stronk.WorkoutContext) (*nextLiftResp, error) {
 	// Now the tricky part - we need to figure out the last one that a user
 	// actually completed. Here's our strategy for doing so
 	//  1. Load the users 20 latest lifts, ordered by iteration, then week, then day.
 	//  2. Correlate that with the routine, using ~~magic~~ (read: bad and hacky heuristics)
-	lifts, err := s.db.RecentLifts()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load recent lifts: %w", err)
-	}
-
-	// Map iteration -> week -> day -> set type -> lifts
-	m := make(map[int]map[int]map[int]map[stronk.SetType][]*stronk.Lift)
-	for _, l := range lifts {
-		wm, ok := m[l.IterationNumber]
-		if !ok {
-			wm = make(map[int]map[int]map[stronk.SetType][]*stronk.Lift)
-		}
-		dm, ok := wm[l.WeekNumber]
-		if !ok {
-			dm = make(map[int]map[stronk.SetType][]*stronk.Lift)
-		}
-		stm, ok := dm[l.DayNumber]
-		if !ok {
-			stm = make(map[stronk.SetType][]*stronk.Lift)
+	recent := wc.RecentLifts
+
+	// Extra sets (jokers, etc) aren't part of the routine, so we keep them out of
+	// the matching below and handle them separately.
+	var lifts, extras []*stronk.Lift
+	for _, l := range recent {
+		if l.Extra != "" {
+			extras = append(extras, l)
+		} else {
+			lifts = append(lifts, l)
 		}
-		lfs := stm[l.SetType]
-		lfs = append(lfs, l)
-		stm[l.SetType] = lfs
-		dm[l.DayNumber] = stm
-		wm[l.WeekNumber] = dm
-		m[l.IterationNumber] = wm
 	}
 
-	skipWeeks, err := s.db.SkippedWeeks()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load skipped weeks: %w", err)
-	}
 	type weekIter struct{ week, iteration int }
 	swm := make(map[weekIter]bool)
-	for _, sw := range skipWeeks {
+	for _, sw := range wc.SkippedWeeks {
 		swm[weekIter{week: sw.Week, iteration: sw.Iteration}] = true
 	}
 
 	// Load the latest day
 	var day, week, iter int
-	if len(lifts) > 0 {
-		latest := lifts[0]
+	if len(recent) > 0 {
+		latest := recent[0]
 		day, week, iter = latest.DayNumber, latest.WeekNumber, latest.IterationNumber
 	}
 
@@ -521,18 +819,29 @@ func (s *Server) nextLift() (*nextLiftResp, error) {
 	dayLifts := filterLifts(lifts, day, week, iter)
 	set := lastSetDone(day, week, iter, dayLifts, dayRoutine)
 
-	// Go to the next set in the movement if we have one.
-	// If not, go to the next movement in the routine if we have one.
+	// Figure out how long to rest after the set we just did, which only matters
+	// if the next set is on the same day.
+	var rest *stronk.RestStatus
+	if !set.NoneDone {
+		mvmt := dayRoutine.Movements[set.MovementIndex]
+		target := routine.RestTarget(mvmt, mvmt.Sets[set.SetIndex])
+		// The latest lift might be an extra set, which still counts for resting.
+		latest := filterLifts(recent, day, week, iter)[0]
+		rest = stronk.CalcRestStatus(latest.CreatedAt, target, s.now())
+	}
+	lastDay, lastWeek, lastIter := day, week, iter
+
+	// Go to the next set in the day's order if we have one, which is usually
+	// the next set in the movement, or the first set of the next movement.
 	// If not, go to the next day in the week if we have one.
 	// If not, go to the next week in the iteration if we have one.
 	// If not, go to the next iteration, which we can always do.
-	if set.SetIndex < len(dayRoutine.Movements[set.MovementIndex].Sets)-1 {
-		if !set.NoneDone {
-			set.SetIndex++
-		}
-	} else if set.MovementIndex < len(dayRoutine.Movements)-1 {
-		set.SetIndex = 0
-		set.MovementIndex++
+	order := dayRoutine.SetOrder()
+	if set.NoneDone {
+		// Nothing done yet today, start from the top.
+	} else if set.OrderIndex < len(order)-1 {
+		next := order[set.OrderIndex+1]
+		set.MovementIndex, set.SetIndex = next.MovementIndex, next.SetIndex
 	} else if day < len(routine.Weeks[week].Days)-1 {
 		set.SetIndex = 0
 		set.MovementIndex = 0
@@ -569,14 +878,69 @@ func (s *Server) nextLift() (*nextLiftResp, error) {
 	// Update our day routine, which may very well have changed.
 	dayRoutine = routine.Weeks[week].Days[day]
 
-	// Now, load the smallest denom and training maxes, to set the target weights.
-	tms, err := s.db.TrainingMaxes()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load training maxes: %w", err)
+	// Once we've moved on to the next day, the session that was just finished
+	// is the one worth summarizing.
+	session := filterLifts(recent, day, week, iter)
+	if day != lastDay || week != lastWeek || iter != lastIter {
+		rest = nil
+		session = filterLifts(recent, lastDay, lastWeek, lastIter)
+	}
+
+	mvmts := s.workout(wc, lifts, extras, day, week, iter)
+
+	// If the day we just finished still has extra sets on offer, e.g. because it
+	// ended with a to-failure set, we keep those around so they can be done
+	// before moving on.
+	var finished *finishedDay
+	if day != lastDay || week != lastWeek || iter != lastIter {
+		var open []*stronk.Movement
+		for _, mvmt := range s.workout(wc, lifts, extras, lastDay, lastWeek, lastIter) {
+			if hasOpenSet(mvmt.JokerSets) || hasOpenSet(mvmt.FirstSetLastSets) {
+				open = append(open, mvmt)
+			}
+		}
+		if len(open) > 0 {
+			finished = &finishedDay{
+				DayNumber:       lastDay,
+				WeekNumber:      lastWeek,
+				IterationNumber: lastIter,
+				DayName:         routine.Weeks[lastWeek].Days[lastDay].DayName,
+				WeekName:        routine.Weeks[lastWeek].WeekName,
+				Workout:         open,
+			}
+		}
+	}
+
+	// For JSON serialization
+	if mvmts == nil {
+		mvmts = []*stronk.Movement{}
 	}
 
+	return &nextLiftResp{
+		DayNumber:         day,
+		WeekNumber:        week,
+		IterationNumber:   iter,
+		DayName:           dayRoutine.DayName,
+		WeekName:          routine.Weeks[week].WeekName,
+		Workout:           mvmts,
+		NextMovementIndex: set.MovementIndex,
+		NextSetIndex:      set.SetIndex,
+		OptionalWeek:      day == 0 && set.MovementIndex == 0 && set.SetIndex == 0 && routine.Weeks[week].Optional,
+		Rest:              rest,
+		SessionRest:       stronk.CalcRestStats(session),
+		FinishedDay:       finished,
+	}, nil
+}
+
+// workout returns the movements for a day of the routine, with weight targets
+// and extra sets filled in based on the given lifts.
+func (s *Server) workout(wc *stronk.WorkoutContext, lifts, extras []*stronk.Lift, day, week, iter int) []*stronk.Movement {
+	dayRoutine := s.routine.Weeks[week].Days[day]
+	dayLifts := filterLifts(lifts, day, week, iter)
+
+	// Now, use the smallest denom and training maxes to set the target weights.
 	getTM := func(ex stronk.Exercise) (stronk.Weight, bool) {
-		for _, tm := range tms {
+		for _, tm := range wc.TrainingMaxes {
 			if tm.Exercise == ex {
 				return tm.Max, true
 			}
@@ -584,40 +948,18 @@ func (s *Server) nextLift() (*nextLiftResp, error) {
 		return stronk.Weight{}, false
 	}
 
-	smallest, err := s.db.SmallestDenom()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load smallest denom: %w", err)
-	}
+	smallest := wc.SmallestDenom
 
-	associatedLift := func(st stronk.SetType, ex stronk.Exercise, setNum int) (stronk.LiftID, bool) {
-		wm, ok := m[iter]
-		if !ok {
-			return 0, false
-		}
-		dm, ok := wm[week]
-		if !ok {
-			return 0, false
-		}
-		stm, ok := dm[day]
-		if !ok {
-			return 0, false
-		}
-		lfs, ok := stm[st]
-		if !ok {
-			return 0, false
-		}
-		for _, l := range lfs {
-			if l.Exercise != ex {
-				continue
-			}
-			if l.SetNumber != setNum {
-				continue
+	associatedLift := func(st stronk.SetType, ex stronk.Exercise, setNum int) (*stronk.Lift, bool) {
+		for _, l := range dayLifts {
+			if l.SetType == st && l.Exercise == ex && l.SetNumber == setNum {
+				return l, true
 			}
-			return l.ID, true
 		}
-		return 0, false
+		return nil, false
 	}
 
+	todaysExtras := filterLifts(extras, day, week, iter)
 	mvmts := dayRoutine.Clone().Movements
 	for _, mvmt := range mvmts {
 		tm, ok := getTM(mvmt.Exercise)
@@ -625,40 +967,137 @@ func (s *Server) nextLift() (*nextLiftResp, error) {
 			// Just skip this one if we didn't set it.
 			continue
 		}
+		var failureLift *stronk.Lift
 		for i, set := range mvmt.Sets {
 			set.WeightTarget = roundWeight(tm, set.TrainingMaxPercentage, smallest)
-			id, ok := associatedLift(mvmt.SetType, mvmt.Exercise, i)
+			l, ok := associatedLift(mvmt.SetType, mvmt.Exercise, i)
 			if ok {
-				set.AssociatedLiftID = id
+				set.AssociatedLiftID = l.ID
 			}
 
 			if !set.ToFailure {
 				continue
 			}
-			comparables, err := s.db.ComparableLifts(mvmt.Exercise, set.WeightTarget)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load comparables: %w", err)
+			if ok {
+				failureLift = l
 			}
-			set.FailureComparables = comparables
+			set.FailureComparables = wc.Comparables(mvmt.Exercise, set.WeightTarget)
+		}
+		addExtraSets(mvmt, failureLift, todaysExtras, smallest)
+	}
+
+	// Back-off sets are based on the top set before them, which we don't know
+	// the weight of until it's been done.
+	tops := make(map[stronk.Exercise]stronk.Weight)
+	for _, pos := range dayRoutine.SetOrder() {
+		mvmt := mvmts[pos.MovementIndex]
+		set := mvmt.Sets[pos.SetIndex]
+		switch {
+		case set.TargetRPE > 0:
+			top := set.WeightTarget
+			if l, ok := associatedLift(mvmt.SetType, mvmt.Exercise, pos.SetIndex); ok {
+				top = l.Weight
+			}
+			tops[mvmt.Exercise] = top
+		case set.BackOffPercentage > 0:
+			top, ok := tops[mvmt.Exercise]
+			if !ok || top.Value == 0 {
+				// No top set, or no idea what weight it'll be.
+				continue
+			}
+			set.WeightTarget = roundWeight(top, 100-set.BackOffPercentage, smallest)
 		}
 	}
 
-	// For JSON serialization
-	if mvmts == nil {
-		mvmts = []*stronk.Movement{}
+	return mvmts
+}
+
+// hasOpenSet returns true if any of the sets haven't been done yet.
+func hasOpenSet(sets []*stronk.Set) bool {
+	for _, set := range sets {
+		if set.AssociatedLiftID == 0 {
+			return true
+		}
 	}
+	return false
+}
 
-	return &nextLiftResp{
-		DayNumber:         day,
-		WeekNumber:        week,
-		IterationNumber:   iter,
-		DayName:           dayRoutine.DayName,
-		WeekName:          routine.Weeks[week].WeekName,
-		Workout:           mvmts,
-		NextMovementIndex: set.MovementIndex,
-		NextSetIndex:      set.SetIndex,
-		OptionalWeek:      day == 0 && set.MovementIndex == 0 && set.SetIndex == 0 && routine.Weeks[week].Optional,
-	}, nil
+// addExtraSets fills in the joker and first-set-last sets for a movement based
+// on how its to-failure set went, which is nil if it hasn't been done yet. The
+// movement's sets should already have their weight targets filled in.
+func addExtraSets(mvmt *stronk.Movement, failureLift *stronk.Lift, extras []*stronk.Lift, smallest stronk.Weight) {
+	if failureLift == nil {
+		return
+	}
+	var failureSet *stronk.Set
+	for _, set := range mvmt.Sets {
+		if set.ToFailure {
+			failureSet = set
+		}
+	}
+	if failureSet == nil {
+		return
+	}
+
+	done := func(kind stronk.ExtraSet) []*stronk.Lift {
+		var out []*stronk.Lift
+		for _, l := range extras {
+			if l.Extra == kind && l.Exercise == mvmt.Exercise && l.SetType == mvmt.SetType {
+				out = append(out, l)
+			}
+		}
+		slices.SortFunc(out, func(a, b *stronk.Lift) int { return a.SetNumber - b.SetNumber })
+		return out
+	}
+	asSets := func(lfs []*stronk.Lift, repTarget, tmPercent int) []*stronk.Set {
+		out := []*stronk.Set{}
+		for _, l := range lfs {
+			out = append(out, &stronk.Set{
+				RepTarget:             repTarget,
+				TrainingMaxPercentage: tmPercent,
+				WeightTarget:          l.Weight,
+				AssociatedLiftID:      l.ID,
+			})
+		}
+		return out
+	}
+
+	if cfg := mvmt.Jokers; cfg != nil && failureLift.Reps >= failureSet.RepTarget+cfg.MinExtraReps {
+		jokers := done(stronk.JokerSet)
+		sets := asSets(jokers, failureSet.RepTarget, 0)
+
+		// Keep suggesting heavier sets until we hit the cap or miss a rep target.
+		last := failureLift
+		if n := len(jokers); n > 0 {
+			last = jokers[n-1]
+		}
+		if len(jokers) < cfg.MaxSets && last.Reps >= failureSet.RepTarget {
+			sets = append(sets, &stronk.Set{
+				RepTarget:    failureSet.RepTarget,
+				WeightTarget: roundWeight(last.Weight, 100+cfg.IncrementPercentage, smallest),
+			})
+		}
+		mvmt.JokerSets = sets
+	}
+
+	if cfg := mvmt.FirstSetLast; cfg != nil && failureLift.Reps >= failureSet.RepTarget {
+		first := mvmt.Sets[0]
+		reps := cfg.RepTarget
+		if reps == 0 {
+			reps = first.RepTarget
+		}
+
+		fsl := done(stronk.FirstSetLastSet)
+		sets := asSets(fsl, reps, first.TrainingMaxPercentage)
+		if len(fsl) < cfg.Sets {
+			sets = append(sets, &stronk.Set{
+				RepTarget:             reps,
+				TrainingMaxPercentage: first.TrainingMaxPercentage,
+				WeightTarget:          first.WeightTarget,
+			})
+		}
+		mvmt.FirstSetLastSets = sets
+	}
 }
 
 // roundWeight returns the percentage of the training max rounded to the
@@ -695,9 +1134,15 @@ type recordReq struct {
 	Week      int             `json:"Week"`
 	Iteration int             `json:"Iteration"`
 	ToFailure bool            `json:"ToFailure"`
+	// RPE and RIR are both optional.
+	RPE float64 `json:"RPE"`
+	RIR *int    `json:"RIR"`
+	// Extra is empty for sets that are part of the routine.
+	Extra stronk.ExtraSet `json:"Extra"`
 }
 
 func (s *Server) serveRecordLift(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
 		return
@@ -710,67 +1155,732 @@ func (s *Server) serveRecordLift(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	weight, err := parsePounds(req.Weight)
+	resp, err := s.recordLift(ctx, &req, time.Time{})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse weights: %v", err), http.StatusBadRequest)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
+	jsonResp(w, resp)
+}
 
-	id, err := s.db.RecordLift(req.Exercise, req.SetType, weight, req.Set, req.Reps, req.Note, req.Day, req.Week, req.Iteration, req.ToFailure)
+// recordLift records the next lift, as done at the given time, or now if it's
+// zero. Once the lift is recorded it doesn't fail, so the response's NextLift
+// is nil if it couldn't be determined.
+func (s *Server) recordLift(ctx context.Context, req *recordReq, at time.Time) (*recordLiftResp, error) {
+	weight, err := parsePounds(req.Weight)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to record lift: %v", err), http.StatusInternalServerError)
-		return
+		return nil, invalidf("failed to parse weights: %v", err)
 	}
 
-	nextLift, err := s.nextLift()
+	switch req.Extra {
+	case "", stronk.JokerSet, stronk.FirstSetLastSet:
+		// Valid.
+	default:
+		return nil, invalidf("invalid extra set type %q", req.Extra)
+	}
+
+	if err := stronk.ValidateEffort(req.RPE, req.RIR); err != nil {
+		return nil, badRequest{err}
+	}
+
+	lift := &stronk.Lift{
+		Exercise:        req.Exercise,
+		SetType:         req.SetType,
+		Weight:          weight,
+		SetNumber:       req.Set,
+		Reps:            req.Reps,
+		Note:            req.Note,
+		DayNumber:       req.Day,
+		WeekNumber:      req.Week,
+		IterationNumber: req.Iteration,
+		ToFailure:       req.ToFailure,
+		Extra:           req.Extra,
+		RPE:             req.RPE,
+		RIR:             req.RIR,
+		CreatedAt:       at,
+	}
+	var (
+		records      *stronk.RepRecords
+		recorded     *stronk.Lift
+		achievements []*stronk.Achievement
+	)
+	var (
+		id       stronk.LiftID
+		nextLift *nextLiftResp
+	)
+	err = s.change(ctx, eventLiftRecorded, func() (*eventData, error) {
+		var (
+			wc  *stronk.WorkoutContext
+			err error
+		)
+		id, wc, err = s.db.RecordNextLift(ctx, lift, s.routine.FailureExercises(), func(wc *stronk.WorkoutContext) error {
+			// Lifts are ordered by when they were done within a day, so a lift
+			// recorded with a client's clock can't go before the one it follows.
+			if len(wc.RecentLifts) > 0 && !lift.CreatedAt.IsZero() && lift.CreatedAt.Before(wc.RecentLifts[0].CreatedAt) {
+				lift.CreatedAt = wc.RecentLifts[0].CreatedAt
+			}
+			return s.checkPosition(wc, lift)
+		}, func(id stronk.LiftID, history []*stronk.Lift) []*stronk.Achievement {
+			// This runs in the same transaction as recording the lift, so the
+			// achievements are saved if and only if the lift is.
+			records = stronk.CalcRepRecords(req.Exercise, history)
+			idx := slices.IndexFunc(history, func(l *stronk.Lift) bool { return l.ID == id })
+			if idx < 0 {
+				return nil
+			}
+			recorded = history[idx]
+			achievements = stronk.CalcAchievements(recorded, history[:idx])
+			return achievements
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The lift is recorded, so failing now would have a retry record it
+		// again. Clients load the next lift themselves if it isn't in the
+		// response.
+		if nextLift, err = s.nextLiftFrom(wc); err != nil {
+			log.Printf("failed to determine next lift after recording lift %d: %v", id, err)
+		}
+		return &eventData{Lift: recorded, NextLift: nextLift}, nil
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to record lift: %w", err)
+	}
+	// For JSON serialization
+	if achievements == nil {
+		achievements = []*stronk.Achievement{}
 	}
 
-	jsonResp(w, recordLiftResp{id, nextLift})
+	return &recordLiftResp{
+		LiftID:       id,
+		NextLift:     nextLift,
+		NewRepRecord: records.IsNewRecord(id),
+		Achievements: achievements,
+	}, nil
+}
+
+// checkPosition returns an errConflict if the lift isn't the one the routine
+// expects next, e.g. because another device recorded it first.
+func (s *Server) checkPosition(wc *stronk.WorkoutContext, l *stronk.Lift) error {
+	if l.Extra != "" {
+		// Extra sets aren't part of the routine's order, they just need to be for
+		// the same day as the latest lift.
+		var day, week, iter int
+		if len(wc.RecentLifts) > 0 {
+			latest := wc.RecentLifts[0]
+			day, week, iter = latest.DayNumber, latest.WeekNumber, latest.IterationNumber
+		}
+		if l.DayNumber != day || l.WeekNumber != week || l.IterationNumber != iter {
+			return fmt.Errorf("%w: extra set was for day %d, week %d, iteration %d, but the latest lift was for day %d, week %d, iteration %d", errConflict, l.DayNumber, l.WeekNumber, l.IterationNumber, day, week, iter)
+		}
+		return nil
+	}
+
+	next, err := s.nextLiftFrom(wc)
+	if err != nil {
+		return err
+	}
+	if next.NextMovementIndex >= len(next.Workout) {
+		return fmt.Errorf("next movement %d doesn't exist in the day's workout", next.NextMovementIndex)
+	}
+	mvmt := next.Workout[next.NextMovementIndex]
+	if l.DayNumber != next.DayNumber || l.WeekNumber != next.WeekNumber || l.IterationNumber != next.IterationNumber ||
+		l.Exercise != mvmt.Exercise || l.SetType != mvmt.SetType || l.SetNumber != next.NextSetIndex {
+		return fmt.Errorf("%w: got %s %s set %d for day %d, week %d, iteration %d, but next up is %s %s set %d for day %d, week %d, iteration %d", errConflict,
+			l.SetType, l.Exercise, l.SetNumber, l.DayNumber, l.WeekNumber, l.IterationNumber,
+			mvmt.SetType, mvmt.Exercise, next.NextSetIndex, next.DayNumber, next.WeekNumber, next.IterationNumber)
+	}
+	return nil
 }
 
 type recordLiftResp struct {
 	LiftID   stronk.LiftID
 	NextLift *nextLiftResp
+	// NewRepRecord is true if this beat the heaviest lift for its number of
+	// reps, or the most reps done at its weight.
+	NewRepRecord bool
+	// Achievements are the personal records this lift set, if any.
+	Achievements []*stronk.Achievement
 }
 
-func (s *Server) skipOptionalWeek(w http.ResponseWriter, r *http.Request) {
-	nextLift, err := s.nextLift()
+func (s *Server) serveAchievements(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	achs, err := s.db.Achievements(ctx, stronk.Exercise(r.URL.Query().Get("exercise")))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
+	// For JSON serialization
+	if achs == nil {
+		achs = []*stronk.Achievement{}
+	}
 
-	type skipReq struct {
-		Week      int    `json:"Week"`
-		Iteration int    `json:"Iteration"`
-		Note      string `json:"Note"`
+	jsonResp(w, achs)
+}
+
+func (s *Server) serveOneRepMaxTrend(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	ex := stronk.Exercise(q.Get("exercise"))
+	if ex == "" {
+		http.Error(w, "no exercise was given", http.StatusBadRequest)
+		return
+	}
+
+	period, err := analytics.ParsePeriod(q.Get("period"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	window := analytics.DefaultWindow
+	if ws := q.Get("window"); ws != "" {
+		if window, err = strconv.Atoi(ws); err != nil || window < 1 {
+			http.Error(w, fmt.Sprintf("invalid window %q", ws), http.StatusBadRequest)
+			return
+		}
+	}
+
+	lifts, err := s.db.LiftHistory(ctx, stronk.LiftFilter{Exercise: ex})
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	jsonResp(w, analytics.OneRepMaxTrend(ex, lifts, period, window))
+}
+
+func (s *Server) serveVolumeStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	groupBy := []stronk.VolumeGroup{stronk.ByIteration}
+	if gb := q.Get("groupBy"); gb != "" {
+		groupBy = nil
+		for _, g := range strings.Split(gb, ",") {
+			switch vg := stronk.VolumeGroup(g); vg {
+			case stronk.ByExercise, stronk.BySetType, stronk.ByDay, stronk.ByWeek, stronk.ByIteration:
+				groupBy = append(groupBy, vg)
+			default:
+				http.Error(w, fmt.Sprintf("invalid groupBy %q", g), http.StatusBadRequest)
+				return
+			}
+		}
 	}
+
+	filter := stronk.LiftFilter{
+		Exercise: stronk.Exercise(q.Get("exercise")),
+		SetType:  stronk.SetType(q.Get("setType")),
+	}
+	lifts, err := s.db.LiftHistory(ctx, filter)
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	tms, err := s.db.TrainingMaxHistory(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	jsonResp(w, stronk.CalcVolumeStats(lifts, tms, groupBy))
+}
+
+func (s *Server) serveRecords(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ex := stronk.Exercise(r.URL.Query().Get("exercise"))
+	if ex == "" {
+		http.Error(w, "no exercise was given", http.StatusBadRequest)
+		return
+	}
+
+	lifts, err := s.db.LiftHistory(ctx, stronk.LiftFilter{Exercise: ex})
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	jsonResp(w, stronk.CalcRepRecords(ex, lifts))
+}
+
+func (s *Server) serveExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := export.Export(ctx, s.db, s.routine, s.now())
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "stronk-export-"+doc.ExportedAt.Format("20060102")+".json"))
+	jsonResp(w, doc)
+}
+
+func (s *Server) serveExportLiftsCSV(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	unit, err := export.ParseUnit(q.Get("unit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := stronk.LiftFilter{
+		Exercise: stronk.Exercise(q.Get("exercise")),
+		SetType:  stronk.SetType(q.Get("setType")),
+	}
+	lifts, err := s.db.LiftHistory(ctx, filter)
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="lifts.csv"`)
+	if err := export.WriteLiftsCSV(w, lifts, s.routine, unit); err != nil {
+		// We've likely already sent a 200 and part of the CSV, so cutting the
+		// connection off is the only way to tell the client it's incomplete.
+		log.Printf("failed to write lifts CSV: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (s *Server) serveImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := export.Decode(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := export.Import(ctx, s.db, doc, s.routine)
+	if errors.Is(err, export.ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+
+	jsonResp(w, res)
+}
+
+func (s *Server) serveBackups(w http.ResponseWriter, r *http.Request) {
+	if s.backups == nil {
+		http.Error(w, "backups aren't configured", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		snaps, err := s.backups.Snapshots()
+		if err != nil {
+			http.Error(w, err.Error(), errStatus(err))
+			return
+		}
+		// For JSON serialization
+		if snaps == nil {
+			snaps = []*backup.Snapshot{}
+		}
+		jsonResp(w, snaps)
+	case http.MethodPost:
+		snap, err := s.backups.Snapshot()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to take backup: %v", err), errStatus(err))
+			return
+		}
+		jsonResp(w, snap)
+	default:
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) skipOptionalWeek(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var req skipReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	if !nextLift.OptionalWeek {
-		http.Error(w, "next lift isn't the start of an optional week", http.StatusBadRequest)
+	nextLift, err := s.skipWeek(ctx, &req)
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
+		return
+	}
+	jsonResp(w, nextLift)
+}
+
+type skipReq struct {
+	Week      int    `json:"Week"`
+	Iteration int    `json:"Iteration"`
+	Note      string `json:"Note"`
+}
+
+// skipWeek skips the optional week that's up next, and returns what's next
+// after it, which is nil if that couldn't be determined.
+func (s *Server) skipWeek(ctx context.Context, req *skipReq) (*nextLiftResp, error) {
+	var nextLift *nextLiftResp
+	err := s.change(ctx, eventWeekSkipped, func() (*eventData, error) {
+		wc, err := s.db.SkipNextWeek(ctx, req.Note, req.Week, req.Iteration, s.routine.FailureExercises(), func(wc *stronk.WorkoutContext) error {
+			next, err := s.nextLiftFrom(wc)
+			if err != nil {
+				return err
+			}
+			if !next.OptionalWeek {
+				return invalidf("next lift isn't the start of an optional week")
+			}
+			if next.WeekNumber != req.Week || next.IterationNumber != req.Iteration {
+				return fmt.Errorf("%w: asked to skip week %d, iteration %d, but next up is week %d, iteration %d", errConflict, req.Week, req.Iteration, next.WeekNumber, next.IterationNumber)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The week is skipped, so failing now would have a retry skip it again.
+		// Clients load the next lift themselves if it isn't in the response.
+		if nextLift, err = s.nextLiftFrom(wc); err != nil {
+			log.Printf("failed to determine next lift after skipping week %d, iteration %d: %v", req.Week, req.Iteration, err)
+		}
+		return &eventData{Week: req.Week, Iteration: req.Iteration, NextLift: nextLift}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to skip week: %w", err)
+	}
+	return nextLift, nil
+}
+
+// maxSyncOps is the most operations a single sync can apply, which is far
+// more than a few offline workouts' worth.
+const maxSyncOps = 1000
+
+// maxClockSkew is how far into the future a client's timestamps can be before
+// we assume its clock is wrong.
+const maxClockSkew = time.Minute
+
+// syncOpPath is what results of synced operations are saved under, keyed by
+// operation ID, so they can't be mistaken for whole responses saved for an
+// Idempotency-Key.
+const syncOpPath = "/api/sync#op"
+
+type syncOpType string
+
+const (
+	syncRecord syncOpType = "RECORD"
+	syncEdit   syncOpType = "EDIT"
+	syncSkip   syncOpType = "SKIP"
+)
+
+type syncOp struct {
+	// ID is generated by the client, and identifies the operation across
+	// retries, so that it's only ever applied once.
+	ID   string
+	Type syncOpType
+	// At is when the client did the operation. Lifts are recorded as done then,
+	// or now if it isn't set.
+	At time.Time
+
+	// Exactly one of these is set, based on the type.
+	Record *recordReq `json:",omitempty"`
+	Edit   *editReq   `json:",omitempty"`
+	Skip   *skipReq   `json:",omitempty"`
+
+	// EditOp is set instead of Edit.ID to edit a lift that was recorded offline,
+	// and is the ID of the operation that recorded it.
+	EditOp string `json:",omitempty"`
+}
+
+type syncReq struct {
+	// Operations are applied in order.
+	Operations []*syncOp
+}
+
+type syncStatus string
+
+const (
+	syncApplied  syncStatus = "APPLIED"
+	syncConflict syncStatus = "CONFLICT"
+	syncInvalid  syncStatus = "INVALID"
+	// syncNotApplied is for operations after one that wasn't applied, since
+	// they most likely depended on it.
+	syncNotApplied syncStatus = "NOT_APPLIED"
+)
+
+type syncResult struct {
+	ID     string
+	Status syncStatus
+	// Error says why the operation wasn't applied.
+	Error string `json:",omitempty"`
+	// Replayed is true if the operation was applied by an earlier sync.
+	Replayed bool
+	// Lift is the lift as the server has it after the whole sync, for record
+	// and edit operations.
+	Lift *stronk.Lift `json:",omitempty"`
+	// NewRepRecord and Achievements are set for record operations, like in
+	// recordLiftResp.
+	NewRepRecord bool                  `json:",omitempty"`
+	Achievements []*stronk.Achievement `json:",omitempty"`
+}
+
+type syncResp struct {
+	Results  []*syncResult
+	NextLift *nextLiftResp
+}
+
+// serveSync applies a batch of operations a client queued up while offline.
+// Operations are applied one at a time, with the same checks as if they'd been
+// sent individually, and we stop at the first one that conflicts with what's
+// already been recorded or is invalid. Applied operations are remembered by
+// ID, so a client can safely resend the whole batch, e.g. after fixing up the
+// operations that didn't apply.
+func (s *Server) serveSync(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req syncReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) > maxSyncOps {
+		http.Error(w, fmt.Sprintf("too many operations, at most %d can be synced at once", maxSyncOps), http.StatusBadRequest)
 		return
 	}
 
-	if err := s.db.SkipWeek(req.Note, req.Week, req.Iteration); err != nil {
-		http.Error(w, fmt.Sprintf("failed to skip week: %v", err), http.StatusInternalServerError)
+	// recorded maps record operations in this batch to the lifts they recorded.
+	recorded := make(map[string]stronk.LiftID)
+	results := make([]*syncResult, 0, len(req.Operations))
+	stopped := false
+	for _, op := range req.Operations {
+		if stopped {
+			results = append(results, &syncResult{ID: op.ID, Status: syncNotApplied, Error: "an earlier operation wasn't applied"})
+			continue
+		}
+		res, err := s.syncOp(ctx, op, recorded)
+		var br badRequest
+		switch {
+		case err == nil:
+		case errors.As(err, &br):
+			res = &syncResult{ID: op.ID, Status: syncInvalid, Error: err.Error()}
+		case errors.Is(err, errConflict):
+			res = &syncResult{ID: op.ID, Status: syncConflict, Error: err.Error()}
+		default:
+			// Everything applied so far has been saved, so the client can retry.
+			http.Error(w, fmt.Sprintf("failed to apply operation %q: %v", op.ID, err), errStatus(err))
+			return
+		}
+		if res.Status != syncApplied {
+			stopped = true
+		} else if op.Type == syncRecord && res.Lift != nil {
+			recorded[op.ID] = res.Lift.ID
+		}
+		results = append(results, res)
+	}
+
+	// Later operations can edit lifts recorded by earlier ones, so we reload
+	// them all to return what the server ended up with.
+	for _, res := range results {
+		if res.Lift == nil {
+			continue
+		}
+		lift, err := s.db.Lift(ctx, res.Lift.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to load lift: %v", err), errStatus(err))
+			return
+		}
+		res.Lift = lift
+	}
+
+	nextLift, err := s.nextLift(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), errStatus(err))
 		return
 	}
+	jsonResp(w, syncResp{Results: results, NextLift: nextLift})
+}
+
+// syncOp applies a single operation, or replays its result if it was applied
+// before.
+func (s *Server) syncOp(ctx context.Context, op *syncOp, recorded map[string]stronk.LiftID) (*syncResult, error) {
+	if op.ID == "" {
+		return nil, invalidf("operation has no ID")
+	}
+	body, err := json.Marshal(op)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash operation: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	saved := &stronk.SavedResponse{
+		Key:         op.ID,
+		Path:        syncOpPath,
+		RequestHash: hash,
+	}
+	now := s.now()
+	prev, err := s.db.ReserveResponse(ctx, saved, now.Add(-idempotencyAbandonAfter), now.Add(-idempotencyKeyTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve operation ID: %w", err)
+	}
+	if prev != nil {
+		if prev.Path != syncOpPath || prev.RequestHash != hash {
+			return nil, invalidf("operation ID %q was already used for a different operation", op.ID)
+		}
+		if prev.Status == 0 {
+			return nil, fmt.Errorf("operation %q is still being applied by another sync: %w", op.ID, errConflict)
+		}
+		var res syncResult
+		if err := json.Unmarshal(prev.Body, &res); err != nil {
+			return nil, fmt.Errorf("failed to parse saved result: %w", err)
+		}
+		res.Replayed = true
+		return &res, nil
+	}
+
+	res, err := s.applySyncOp(ctx, op, recorded)
+	if err != nil {
+		// Nothing was applied, so the operation can be retried.
+		if rerr := s.db.ReleaseResponse(ctx, op.ID); rerr != nil {
+			log.Printf("failed to release sync operation %q: %v", op.ID, rerr)
+		}
+		return nil, err
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	saved.Status = http.StatusOK
+	saved.Body = out
+	if err := s.db.SaveResponse(ctx, saved); err != nil {
+		// Like with idempotency keys, the worst case is that a retry gets
+		// applied again once the reservation is abandoned, which will most
+		// likely conflict.
+		log.Printf("failed to save result of sync operation %q: %v", op.ID, err)
+	}
+	return res, nil
+}
+
+// applySyncOp applies an operation that hasn't been applied before. Once the
+// operation is recorded it doesn't fail, so that its result can be saved.
+// Lifts in the result only have their ID set, serveSync loads the rest.
+func (s *Server) applySyncOp(ctx context.Context, op *syncOp, recorded map[string]stronk.LiftID) (*syncResult, error) {
+	if op.At.After(s.now().Add(maxClockSkew)) {
+		return nil, invalidf("operation is from the future (%s)", op.At.Format(time.RFC3339))
+	}
 
-	s.nextLiftResponse(w)
+	var err error
+	res := &syncResult{ID: op.ID, Status: syncApplied}
+	switch op.Type {
+	case syncRecord:
+		if op.Record == nil {
+			return nil, invalidf("record operation has no record")
+		}
+		resp, err := s.recordLift(ctx, op.Record, op.At)
+		if err != nil {
+			return nil, err
+		}
+		res.Lift = &stronk.Lift{ID: resp.LiftID}
+		res.NewRepRecord = resp.NewRepRecord
+		res.Achievements = resp.Achievements
+	case syncEdit:
+		if op.Edit == nil {
+			return nil, invalidf("edit operation has no edit")
+		}
+		edit := *op.Edit
+		if op.EditOp != "" {
+			if edit.ID, err = s.syncedLiftID(ctx, op.EditOp, recorded); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.editLift(ctx, &edit); err != nil {
+			return nil, err
+		}
+		res.Lift = &stronk.Lift{ID: edit.ID}
+	case syncSkip:
+		if op.Skip == nil {
+			return nil, invalidf("skip operation has no skip")
+		}
+		if _, err := s.skipWeek(ctx, op.Skip); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalidf("unknown operation type %q", op.Type)
+	}
+	return res, nil
+}
+
+// syncedLiftID returns the ID of the lift recorded by the given operation,
+// either earlier in this sync or in a previous one.
+func (s *Server) syncedLiftID(ctx context.Context, opID string, recorded map[string]stronk.LiftID) (stronk.LiftID, error) {
+	if id, ok := recorded[opID]; ok {
+		return id, nil
+	}
+	saved, err := s.db.SavedResponse(ctx, opID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load saved result: %w", err)
+	}
+	if saved == nil || saved.Path != syncOpPath {
+		return 0, invalidf("no lift was recorded by operation %q", opID)
+	}
+	if saved.Status == 0 {
+		return 0, fmt.Errorf("operation %q is still being applied by another sync: %w", opID, errConflict)
+	}
+	var res syncResult
+	if err := json.Unmarshal(saved.Body, &res); err != nil {
+		return 0, fmt.Errorf("failed to parse saved result: %w", err)
+	}
+	if res.Lift == nil {
+		return 0, invalidf("no lift was recorded by operation %q", opID)
+	}
+	return res.Lift.ID, nil
 }
 
 type lastSet struct {
 	MovementIndex int
 	SetIndex      int
-	NoneDone      bool
+	// OrderIndex is the index of the set in the day's stronk.WorkoutDay.SetOrder
+	OrderIndex int
+	NoneDone   bool
 }
 
 func lastSetDone(day, week, iter int, lifts []*stronk.Lift, dayRoutine *stronk.WorkoutDay) lastSet {
@@ -780,35 +1890,40 @@ func lastSetDone(day, week, iter int, lifts []*stronk.Lift, dayRoutine *stronk.W
 		return lastSet{NoneDone: true}
 	}
 
-	// We want to match up lifts with our workout to see where we are.
+	// We want to match up lifts with our workout to see where we are. We walk
+	// the sets in the order they're meant to be done, which is only different
+	// from the order in the routine for supersets.
+	order := dayRoutine.SetOrder()
+	skipped := make(map[int]bool)
 	idx := len(lifts) - 1
-	for i, mvmt := range dayRoutine.Movements {
+	for i, pos := range order {
 		// Note that we don't actually look at the set info (reps, failure, etc),
 		// moreso just the number of sets because there are lots of practical
 		// reasons that those things might not match up.
-		for j := range mvmt.Sets {
-			lift := lifts[idx]
+		if skipped[pos.MovementIndex] {
+			continue
+		}
+		mvmt := dayRoutine.Movements[pos.MovementIndex]
+		lift := lifts[idx]
 
-			// See if the recorded lift matches this.
-			// If it doesn't, we just skip forward to the next exercise of the day.
-			if lift.Exercise != mvmt.Exercise {
-				break
-			}
-			if lift.SetType != mvmt.SetType {
-				break
-			}
+		// See if the recorded lift matches this.
+		// If it doesn't, we just skip the rest of this movement's sets.
+		if lift.Exercise != mvmt.Exercise || lift.SetType != mvmt.SetType {
+			skipped[pos.MovementIndex] = true
+			continue
+		}
 
-			// If the set type and exercise match, there's a good chance that this
-			// lift corresponds to a set of this routine.
-			idx--
-			if idx < 0 {
-				// We've gone through all recorded lifts, meaning that this is the last
-				// set we did.
-				return lastSet{
-					MovementIndex: i,
-					SetIndex:      j,
-					NoneDone:      false,
-				}
+		// If the set type and exercise match, there's a good chance that this
+		// lift corresponds to a set of this routine.
+		idx--
+		if idx < 0 {
+			// We've gone through all recorded lifts, meaning that this is the last
+			// set we did.
+			return lastSet{
+				MovementIndex: pos.MovementIndex,
+				SetIndex:      pos.SetIndex,
+				OrderIndex:    i,
+				NoneDone:      false,
 			}
 		}
 	}
@@ -816,10 +1931,11 @@ func lastSetDone(day, week, iter int, lifts []*stronk.Lift, dayRoutine *stronk.W
 	// If we're here, we had lifts that we hadn't looked at, but we went through
 	// all the movements. I don't think this should happen, but I guess it means
 	// we're done with the day?
-	lastMvmt := dayRoutine.Movements[len(dayRoutine.Movements)-1]
+	last := order[len(order)-1]
 	return lastSet{
-		MovementIndex: len(dayRoutine.Movements) - 1,
-		SetIndex:      len(lastMvmt.Sets) - 1,
+		MovementIndex: last.MovementIndex,
+		SetIndex:      last.SetIndex,
+		OrderIndex:    len(order) - 1,
 		NoneDone:      false,
 	}
 }
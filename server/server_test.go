@@ -1,8 +1,13 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,12 +15,16 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/backup"
 	"github.com/bcspragu/stronk/testing/testdb"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestNextLift(t *testing.T) {
@@ -41,7 +50,12 @@ func TestNextLift(t *testing.T) {
 
 	checkLift := func(got, want nextLiftResp) {
 		t.Helper()
-		if diff := cmp.Diff(want, got); diff != "" {
+		// Rest info depends on the clock, it's covered in TestRestStatus.
+		ignoreRest := cmpopts.IgnoreFields(nextLiftResp{}, "Rest", "SessionRest")
+		// Comparables depend on everything recorded so far, they're covered in
+		// TestFailureComparables.
+		ignoreComparables := cmpopts.IgnoreFields(stronk.Set{}, "FailureComparables")
+		if diff := cmp.Diff(want, got, ignoreRest, ignoreComparables); diff != "" {
 			t.Fatalf("unexpected next lift returned (-want +got)\n%s", diff)
 		}
 	}
@@ -462,6 +476,1345 @@ func TestNextLift(t *testing.T) {
 	}
 }
 
+func TestRestStatus(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+
+	start := time.Date(2023, 6, 10, 8, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+	srv.now = clock
+	env.db.SetClock(clock)
+
+	// Right after the first set, the whole warmup rest is still ahead of us.
+	got := recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "50", Set: 0, Reps: 5})
+	want := &stronk.RestStatus{
+		LastSetCompletedAt:     start,
+		RecommendedRestSeconds: 60,
+		RemainingSeconds:       60,
+	}
+	if diff := cmp.Diff(want, got.NextLift.Rest); diff != "" {
+		t.Errorf("unexpected rest status after first set (-want +got)\n%s", diff)
+	}
+	if got.NextLift.SessionRest != nil {
+		t.Errorf("session rest stats = %+v, want nil after a single set", got.NextLift.SessionRest)
+	}
+
+	now = start.Add(90 * time.Second)
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "65", Set: 1, Reps: 5})
+	now = start.Add(2 * time.Minute)
+
+	nl, err := srv.nextLift(context.Background())
+	if err != nil {
+		t.Fatalf("nextLift: %v", err)
+	}
+	want = &stronk.RestStatus{
+		LastSetCompletedAt:     start.Add(90 * time.Second),
+		RecommendedRestSeconds: 60,
+		RemainingSeconds:       30,
+	}
+	if diff := cmp.Diff(want, nl.Rest); diff != "" {
+		t.Errorf("unexpected rest status (-want +got)\n%s", diff)
+	}
+	wantStats := &stronk.RestStats{
+		Intervals:       1,
+		TotalSeconds:    90,
+		AverageSeconds:  90,
+		ShortestSeconds: 90,
+		LongestSeconds:  90,
+	}
+	if diff := cmp.Diff(wantStats, nl.SessionRest); diff != "" {
+		t.Errorf("unexpected session rest stats (-want +got)\n%s", diff)
+	}
+}
+
+func TestSessionRestAfterDay(t *testing.T) {
+	routine := &stronk.Routine{
+		Name: "Two Days",
+		Weeks: []*stronk.WorkoutWeek{{
+			WeekName: "Week 1",
+			Days: []*stronk.WorkoutDay{
+				{
+					DayName: "Press Day",
+					Movements: []*stronk.Movement{
+						{Exercise: stronk.OverheadPress, SetType: stronk.Main, Sets: []*stronk.Set{
+							{RepTarget: 5, TrainingMaxPercentage: 65},
+							{RepTarget: 5, TrainingMaxPercentage: 75},
+						}},
+					},
+				},
+				{
+					DayName: "Squat Day",
+					Movements: []*stronk.Movement{
+						{Exercise: stronk.Squat, SetType: stronk.Main, Sets: []*stronk.Set{{RepTarget: 5, TrainingMaxPercentage: 65}}},
+					},
+				},
+			},
+		}},
+	}
+	db := testdb.New()
+	srv := New(routine, db)
+	setTrainingMaxes(t, srv)
+
+	start := time.Date(2023, 6, 10, 8, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+	srv.now = clock
+	db.SetClock(clock)
+
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "82.5", Set: 0, Reps: 5})
+	now = start.Add(2 * time.Minute)
+	got := recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "95", Set: 1, Reps: 5})
+
+	// We're on to squat day, but the stats are for the press session we just
+	// finished.
+	if got.NextLift.DayNumber != 1 {
+		t.Fatalf("next lift is for day %d, want 1", got.NextLift.DayNumber)
+	}
+	if got.NextLift.Rest != nil {
+		t.Errorf("rest status = %+v, want nil on a new day", got.NextLift.Rest)
+	}
+	want := &stronk.RestStats{
+		Intervals:       1,
+		TotalSeconds:    120,
+		AverageSeconds:  120,
+		ShortestSeconds: 120,
+		LongestSeconds:  120,
+	}
+	if diff := cmp.Diff(want, got.NextLift.SessionRest); diff != "" {
+		t.Errorf("unexpected session rest stats (-want +got)\n%s", diff)
+	}
+}
+
+func TestSupersets(t *testing.T) {
+	const (
+		dips = stronk.Exercise("DIPS")
+		rows = stronk.Exercise("ROWS")
+	)
+	sets := func(n int) []*stronk.Set {
+		var out []*stronk.Set
+		for i := 0; i < n; i++ {
+			out = append(out, &stronk.Set{RepTarget: 10, TrainingMaxPercentage: 50})
+		}
+		return out
+	}
+	routine := &stronk.Routine{
+		Name: "Superset",
+		Weeks: []*stronk.WorkoutWeek{{
+			WeekName: "Week 1",
+			Days: []*stronk.WorkoutDay{{
+				DayName: "Press Day",
+				Movements: []*stronk.Movement{
+					{Exercise: stronk.OverheadPress, SetType: stronk.Main, Sets: sets(1)},
+					{Exercise: dips, SetType: stronk.Assistance, Group: "A", Sets: sets(2)},
+					{Exercise: rows, SetType: stronk.Assistance, Group: "A", Sets: sets(2)},
+				},
+			}},
+		}},
+	}
+	db := testdb.New()
+	srv := New(routine, db)
+	setTrainingMaxes(t, srv)
+
+	type position struct{ day, iter, mvmt, set int }
+	tests := []struct {
+		ex   stronk.Exercise
+		st   stronk.SetType
+		set  int
+		want position
+	}{
+		{ex: stronk.OverheadPress, st: stronk.Main, set: 0, want: position{mvmt: 1, set: 0}},
+		{ex: dips, st: stronk.Assistance, set: 0, want: position{mvmt: 2, set: 0}},
+		{ex: rows, st: stronk.Assistance, set: 0, want: position{mvmt: 1, set: 1}},
+		{ex: dips, st: stronk.Assistance, set: 1, want: position{mvmt: 2, set: 1}},
+		{ex: rows, st: stronk.Assistance, set: 1, want: position{iter: 1}},
+	}
+
+	for _, test := range tests {
+		got := recordLift(t, srv, recordReq{Exercise: test.ex, SetType: test.st, Weight: "50", Set: test.set, Reps: 10})
+		nl := got.NextLift
+		gotPos := position{day: nl.DayNumber, iter: nl.IterationNumber, mvmt: nl.NextMovementIndex, set: nl.NextSetIndex}
+		if gotPos != test.want {
+			t.Errorf("after %s set %d, next position was %+v, want %+v", test.ex, test.set, gotPos, test.want)
+		}
+	}
+}
+
+func TestExtraSets(t *testing.T) {
+	routine := &stronk.Routine{
+		Name: "Jokers",
+		Weeks: []*stronk.WorkoutWeek{{
+			WeekName: "Week 1",
+			Days: []*stronk.WorkoutDay{{
+				DayName: "Press Day",
+				Movements: []*stronk.Movement{
+					{
+						Exercise: stronk.OverheadPress,
+						SetType:  stronk.Main,
+						Sets: []*stronk.Set{
+							{RepTarget: 5, TrainingMaxPercentage: 65},
+							{RepTarget: 5, TrainingMaxPercentage: 75},
+							{RepTarget: 5, TrainingMaxPercentage: 85, ToFailure: true},
+						},
+						Jokers:       &stronk.JokerConfig{IncrementPercentage: 10, MinExtraReps: 2, MaxSets: 2},
+						FirstSetLast: &stronk.FirstSetLastConfig{Sets: 1},
+					},
+					{
+						Exercise: stronk.OverheadPress,
+						SetType:  stronk.Assistance,
+						Sets:     []*stronk.Set{{RepTarget: 10, TrainingMaxPercentage: 50}},
+					},
+				},
+			}},
+		}},
+	}
+	db := testdb.New()
+	srv := New(routine, db)
+	setTrainingMaxes(t, srv)
+	env := &testEnv{db: db}
+	tm, sd := env.trainingMax(t, stronk.OverheadPress), env.smallestDenom(t)
+
+	main := func(set, reps int, weight string) recordReq {
+		return recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: weight, Set: set, Reps: reps, ToFailure: set == 2}
+	}
+	extra := func(kind stronk.ExtraSet, set, reps int, weight string) recordReq {
+		return recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: weight, Set: set, Reps: reps, Extra: kind}
+	}
+
+	recordLift(t, srv, main(0, 5, "82.5"))
+	got := recordLift(t, srv, main(1, 5, "95"))
+	if sets := got.NextLift.Workout[0].JokerSets; sets != nil {
+		t.Errorf("joker sets were suggested before the to-failure set was done: %+v", sets)
+	}
+
+	got = recordLift(t, srv, main(2, 8, "107.5"))
+	top := roundWeight(tm, 85, sd)
+	firstJoker := roundWeight(top, 110, sd)
+	wantFSL := []*stronk.Set{{RepTarget: 5, TrainingMaxPercentage: 65, WeightTarget: roundWeight(tm, 65, sd)}}
+	if diff := cmp.Diff([]*stronk.Set{{RepTarget: 5, WeightTarget: firstJoker}}, got.NextLift.Workout[0].JokerSets); diff != "" {
+		t.Errorf("unexpected joker sets after to-failure set (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(wantFSL, got.NextLift.Workout[0].FirstSetLastSets); diff != "" {
+		t.Errorf("unexpected first set last sets (-want +got)\n%s", diff)
+	}
+
+	// Doing a joker set shouldn't move us along in the routine.
+	got = recordLift(t, srv, extra(stronk.JokerSet, 0, 5, firstJoker.String()))
+	if mi, si := got.NextLift.NextMovementIndex, got.NextLift.NextSetIndex; mi != 1 || si != 0 {
+		t.Errorf("after joker set, next position was (%d, %d), want (1, 0)", mi, si)
+	}
+	wantJokers := []*stronk.Set{
+		{RepTarget: 5, WeightTarget: firstJoker, AssociatedLiftID: got.LiftID},
+		{RepTarget: 5, WeightTarget: roundWeight(firstJoker, 110, sd)},
+	}
+	if diff := cmp.Diff(wantJokers, got.NextLift.Workout[0].JokerSets); diff != "" {
+		t.Errorf("unexpected joker sets after first joker (-want +got)\n%s", diff)
+	}
+
+	// Missing the rep target means no more jokers.
+	got = recordLift(t, srv, extra(stronk.JokerSet, 1, 3, wantJokers[1].WeightTarget.String()))
+	wantJokers[1].AssociatedLiftID = got.LiftID
+	if diff := cmp.Diff(wantJokers, got.NextLift.Workout[0].JokerSets); diff != "" {
+		t.Errorf("unexpected joker sets after missed joker (-want +got)\n%s", diff)
+	}
+
+	got = recordLift(t, srv, extra(stronk.FirstSetLastSet, 0, 5, "82.5"))
+	wantFSL[0].AssociatedLiftID = got.LiftID
+	if diff := cmp.Diff(wantFSL, got.NextLift.Workout[0].FirstSetLastSets); diff != "" {
+		t.Errorf("unexpected first set last sets after doing them (-want +got)\n%s", diff)
+	}
+	if mi, si := got.NextLift.NextMovementIndex, got.NextLift.NextSetIndex; mi != 1 || si != 0 {
+		t.Errorf("after extra sets, next position was (%d, %d), want (1, 0)", mi, si)
+	}
+}
+
+func TestExtraSetsAtEndOfDay(t *testing.T) {
+	routine := &stronk.Routine{
+		Name: "Jokers Last",
+		Weeks: []*stronk.WorkoutWeek{{
+			WeekName: "Week 1",
+			Days: []*stronk.WorkoutDay{
+				{
+					DayName: "Press Day",
+					Movements: []*stronk.Movement{{
+						Exercise: stronk.OverheadPress,
+						SetType:  stronk.Main,
+						Sets: []*stronk.Set{
+							{RepTarget: 5, TrainingMaxPercentage: 75},
+							{RepTarget: 5, TrainingMaxPercentage: 85, ToFailure: true},
+						},
+						Jokers: &stronk.JokerConfig{IncrementPercentage: 10, MinExtraReps: 2, MaxSets: 1},
+					}},
+				},
+				{
+					DayName: "Squat Day",
+					Movements: []*stronk.Movement{
+						{Exercise: stronk.Squat, SetType: stronk.Main, Sets: []*stronk.Set{{RepTarget: 5, TrainingMaxPercentage: 65}}},
+					},
+				},
+			},
+		}},
+	}
+	db := testdb.New()
+	srv := New(routine, db)
+	setTrainingMaxes(t, srv)
+	env := &testEnv{db: db}
+	tm, sd := env.trainingMax(t, stronk.OverheadPress), env.smallestDenom(t)
+
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "95", Set: 0, Reps: 5})
+	got := recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "107.5", Set: 1, Reps: 8, ToFailure: true})
+
+	// The to-failure set finished the day, but the joker set is still on offer.
+	if got.NextLift.DayNumber != 1 {
+		t.Fatalf("next lift is for day %d, want 1", got.NextLift.DayNumber)
+	}
+	fd := got.NextLift.FinishedDay
+	if fd == nil {
+		t.Fatal("no finished day with extra sets after to-failure set ended the day")
+	}
+	if fd.DayNumber != 0 || len(fd.Workout) != 1 {
+		t.Fatalf("finished day was day %d with %d movements, want day 0 with 1", fd.DayNumber, len(fd.Workout))
+	}
+	joker := roundWeight(roundWeight(tm, 85, sd), 110, sd)
+	if diff := cmp.Diff([]*stronk.Set{{RepTarget: 5, WeightTarget: joker}}, fd.Workout[0].JokerSets); diff != "" {
+		t.Errorf("unexpected joker sets for finished day (-want +got)\n%s", diff)
+	}
+
+	// Doing it is fine, since it's for the day of the latest lift.
+	got = recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: joker.String(), Set: 0, Reps: 5, Day: fd.DayNumber, Extra: stronk.JokerSet})
+	if got.NextLift.DayNumber != 1 {
+		t.Errorf("next lift is for day %d after the joker set, want 1", got.NextLift.DayNumber)
+	}
+	if fd := got.NextLift.FinishedDay; fd != nil {
+		t.Errorf("finished day = %+v, want nil once its extra sets are done", fd)
+	}
+}
+
+func TestBackOffSets(t *testing.T) {
+	backOff := &stronk.Set{RepTarget: 5, BackOffPercentage: 8}
+	routine := &stronk.Routine{
+		Name: "RPE",
+		Weeks: []*stronk.WorkoutWeek{{
+			WeekName: "Week 1",
+			Days: []*stronk.WorkoutDay{{
+				DayName: "Squat Day",
+				Movements: []*stronk.Movement{
+					{
+						Exercise: stronk.Squat,
+						SetType:  stronk.Main,
+						Sets:     []*stronk.Set{{RepTarget: 1, TargetRPE: 8}},
+					},
+					{
+						Exercise: stronk.Squat,
+						SetType:  stronk.Assistance,
+						Sets:     []*stronk.Set{backOff, backOff.Clone(), backOff.Clone()},
+					},
+				},
+			}},
+		}},
+	}
+	srv := New(routine, testdb.New())
+	setTrainingMaxes(t, srv)
+
+	nl, err := srv.nextLift(context.Background())
+	if err != nil {
+		t.Fatalf("nextLift: %v", err)
+	}
+	// We don't know the top set's weight yet, so we can't say much.
+	for i, set := range nl.Workout[1].Sets {
+		if set.WeightTarget.Value != 0 {
+			t.Errorf("back-off set %d had weight target %s before the top set was done", i, &set.WeightTarget)
+		}
+	}
+
+	got := recordLift(t, srv, recordReq{Exercise: stronk.Squat, SetType: stronk.Main, Weight: "300", Set: 0, Reps: 1, RPE: 8})
+	// 92% of 300 is 276, which rounds to 275
+	want := stronk.Weight{Value: 2750, Unit: stronk.DeciPounds}
+	for i, set := range got.NextLift.Workout[1].Sets {
+		if set.WeightTarget != want {
+			t.Errorf("back-off set %d had weight target %s, want %s", i, &set.WeightTarget, &want)
+		}
+	}
+}
+
+func TestFailureComparables(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+
+	nextFailureSet := func() *stronk.Set {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/nextLift", nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if status := resp.StatusCode; status != http.StatusOK {
+			t.Fatalf("unexpected response code from server %d, wanted OK", status)
+		}
+		var got nextLiftResp
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("failed to decode next lift response: %v", err)
+		}
+		for _, mvmt := range got.Workout {
+			if mvmt.SetType != stronk.Main {
+				continue
+			}
+			for _, set := range mvmt.Sets {
+				if set.ToFailure {
+					return set
+				}
+			}
+		}
+		t.Fatal("no failure set in workout")
+		return nil
+	}
+
+	// Nothing to compare against yet.
+	if diff := cmp.Diff(&stronk.ComparableLifts{}, nextFailureSet().FailureComparables); diff != "" {
+		t.Errorf("unexpected comparables before any lifts (-want +got)\n%s", diff)
+	}
+
+	main := func(set, reps int, weight string, toFailure bool) recordReq {
+		return recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: weight, Set: set, Reps: reps, ToFailure: toFailure}
+	}
+	doWarmups(t, srv)
+	recordLift(t, srv, main(0, 5, "82.5", false))
+	recordLift(t, srv, main(1, 5, "95", false))
+	top := recordLift(t, srv, main(2, 9, "107.5", true))
+
+	lift, err := env.db.Lift(context.Background(), top.LiftID)
+	if err != nil {
+		t.Fatalf("failed to load lift: %v", err)
+	}
+	set := nextFailureSet()
+	want := &stronk.ComparableLifts{
+		ClosestWeight:    lift,
+		PersonalRecord:   lift,
+		PREquivalentReps: lift.CalcEquivalentReps(set.WeightTarget),
+	}
+	if diff := cmp.Diff(want, set.FailureComparables); diff != "" {
+		t.Errorf("unexpected comparables (-want +got)\n%s", diff)
+	}
+}
+
+func TestRecordConflict(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+
+	record := func(rr recordReq) int {
+		req, err := json.Marshal(rr)
+		if err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/recordLift", bytes.NewReader(req))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w.Result().StatusCode
+	}
+
+	// Two devices both think the first warmup set is next, only the first one
+	// to record it wins.
+	first := recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "40", Set: 0, Reps: 5}
+	if status := record(first); status != http.StatusOK {
+		t.Fatalf("unexpected response code from first record %d, wanted OK", status)
+	}
+	if status := record(first); status != http.StatusConflict {
+		t.Errorf("unexpected response code from duplicate record %d, wanted Conflict", status)
+	}
+
+	// Skipping ahead is out of order too.
+	skip := recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "65", Set: 0, Reps: 5}
+	if status := record(skip); status != http.StatusConflict {
+		t.Errorf("unexpected response code from skipping ahead %d, wanted Conflict", status)
+	}
+
+	// Extra sets have to be for the day being worked on.
+	joker := recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "100", Set: 0, Reps: 3, Week: 1, Extra: stronk.JokerSet}
+	if status := record(joker); status != http.StatusConflict {
+		t.Errorf("unexpected response code from extra set on another day %d, wanted Conflict", status)
+	}
+
+	lifts, err := env.db.LiftHistory(context.Background(), stronk.LiftFilter{})
+	if err != nil {
+		t.Fatalf("LiftHistory: %v", err)
+	}
+	if n := len(lifts); n != 1 {
+		t.Errorf("got %d lifts after conflicts, want 1", n)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+
+	record := func(key string, rr recordReq) *httptest.ResponseRecorder {
+		req, err := json.Marshal(rr)
+		if err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/recordLift", bytes.NewReader(req))
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	warmup := recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "40", Set: 0, Reps: 5}
+	first := record("key-1", warmup)
+	if status := first.Code; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+
+	// Retrying gets the original response back, instead of a conflict.
+	retry := record("key-1", warmup)
+	if status := retry.Code; status != http.StatusOK {
+		t.Fatalf("unexpected response code from retry %d, wanted OK", status)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry wasn't marked as replayed")
+	}
+	if diff := cmp.Diff(first.Body.String(), retry.Body.String()); diff != "" {
+		t.Errorf("unexpected retry response (-want +got)\n%s", diff)
+	}
+
+	// A key can't be reused for a different request.
+	next := recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "50", Set: 1, Reps: 5}
+	if status := record("key-1", next).Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("unexpected response code from reused key %d, wanted Unprocessable Entity", status)
+	}
+
+	// Failures aren't saved, so retrying them actually retries.
+	bad := next
+	bad.Weight = "not a number"
+	if status := record("key-2", bad).Code; status != http.StatusBadRequest {
+		t.Fatalf("unexpected response code from bad request %d, wanted Bad Request", status)
+	}
+	if status := record("key-2", next).Code; status != http.StatusOK {
+		t.Errorf("unexpected response code from retried bad request %d, wanted OK", status)
+	}
+
+	// A duplicate of a request that's still being handled is told to come back
+	// later, rather than being handled alongside it.
+	third := recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "60", Set: 2, Reps: 5}
+	body, err := json.Marshal(third)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	sum := sha256.Sum256(body)
+	pending := &stronk.SavedResponse{Key: "key-3", Path: "/api/recordLift", RequestHash: hex.EncodeToString(sum[:])}
+	if _, err := env.db.ReserveResponse(context.Background(), pending, time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	dup := record("key-3", third)
+	if status := dup.Code; status != http.StatusConflict {
+		t.Errorf("unexpected response code from duplicate of pending request %d, wanted Conflict", status)
+	}
+	if dup.Header().Get("Retry-After") == "" {
+		t.Error("duplicate of pending request had no Retry-After header")
+	}
+
+	lifts, err := env.db.LiftHistory(context.Background(), stronk.LiftFilter{})
+	if err != nil {
+		t.Fatalf("LiftHistory: %v", err)
+	}
+	if n := len(lifts); n != 2 {
+		t.Errorf("got %d lifts, want 2", n)
+	}
+}
+
+func TestSkipOptionalWeek(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+	ctx := context.Background()
+
+	// Work through the routine up to its optional week.
+	var next *nextLiftResp
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatal("never got to the optional week")
+		}
+		var err error
+		if next, err = srv.nextLift(ctx); err != nil {
+			t.Fatalf("nextLift: %v", err)
+		}
+		if next.OptionalWeek {
+			break
+		}
+		mvmt := next.Workout[next.NextMovementIndex]
+		set := mvmt.Sets[next.NextSetIndex]
+		recordLift(t, srv, recordReq{
+			Exercise:  mvmt.Exercise,
+			SetType:   mvmt.SetType,
+			Weight:    strconv.FormatFloat(float64(set.WeightTarget.Value)/10, 'f', -1, 64),
+			Set:       next.NextSetIndex,
+			Reps:      set.RepTarget,
+			Day:       next.DayNumber,
+			Week:      next.WeekNumber,
+			Iteration: next.IterationNumber,
+			ToFailure: set.ToFailure,
+		})
+	}
+
+	skip := func(req skipReq) *httptest.ResponseRecorder {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/skipOptionalWeek", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	// Skipping a week that isn't next conflicts.
+	if status := skip(skipReq{Week: next.WeekNumber + 1, Iteration: next.IterationNumber}).Code; status != http.StatusConflict {
+		t.Errorf("unexpected response code from skipping the wrong week %d, wanted Conflict", status)
+	}
+
+	_, events, unsubscribe := srv.events.subscribe("")
+	defer unsubscribe()
+
+	req := skipReq{Week: next.WeekNumber, Iteration: next.IterationNumber, Note: "deload"}
+	w := skip(req)
+	if status := w.Code; status != http.StatusOK {
+		t.Fatalf("unexpected response code from skip %d, wanted OK: %s", status, w.Body.String())
+	}
+	var after nextLiftResp
+	if err := json.NewDecoder(w.Body).Decode(&after); err != nil {
+		t.Fatalf("failed to decode skip response: %v", err)
+	}
+	if after.OptionalWeek || (after.WeekNumber == next.WeekNumber && after.IterationNumber == next.IterationNumber) {
+		t.Errorf("next up after skipping is week %d, iteration %d, want the week after week %d, iteration %d", after.WeekNumber, after.IterationNumber, next.WeekNumber, next.IterationNumber)
+	}
+
+	// The event says which week was skipped, even when it's in the first
+	// iteration.
+	e := <-events
+	if e.Type != eventWeekSkipped {
+		t.Fatalf("got %s event, want %s", e.Type, eventWeekSkipped)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(e.Data, &fields); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if got, want := string(fields["Week"]), strconv.Itoa(req.Week); got != want {
+		t.Errorf("skip event has week %q, want %q", got, want)
+	}
+	if got, want := string(fields["Iteration"]), strconv.Itoa(req.Iteration); got != want {
+		t.Errorf("skip event has iteration %q, want %q", got, want)
+	}
+
+	// A second device skipping the same week doesn't skip it twice.
+	if status := skip(req).Code; status != http.StatusBadRequest {
+		t.Errorf("unexpected response code from skipping again %d, wanted Bad Request", status)
+	}
+	weeks, err := env.db.SkippedWeeks(ctx)
+	if err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	if diff := cmp.Diff([]stronk.SkippedWeek{{Week: req.Week, Iteration: req.Iteration, Note: req.Note}}, weeks); diff != "" {
+		t.Errorf("unexpected skipped weeks (-want +got)\n%s", diff)
+	}
+}
+
+func TestSync(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+
+	start := time.Date(2023, 6, 10, 8, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return start }
+	srv.now = clock
+	env.db.SetClock(clock)
+
+	sync := func(ops ...*syncOp) syncResp {
+		t.Helper()
+		req, err := json.Marshal(syncReq{Operations: ops})
+		if err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(req))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if status := w.Code; status != http.StatusOK {
+			t.Fatalf("unexpected response code from server %d, wanted OK: %s", status, w.Body.String())
+		}
+		var resp syncResp
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode sync response: %v", err)
+		}
+		return resp
+	}
+	statuses := func(resp syncResp) []syncStatus {
+		var out []syncStatus
+		for _, res := range resp.Results {
+			out = append(out, res.Status)
+		}
+		return out
+	}
+	warmup := func(id string, set int, weight string, at time.Time) *syncOp {
+		return &syncOp{
+			ID:     id,
+			Type:   syncRecord,
+			At:     at,
+			Record: &recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: weight, Set: set, Reps: 5},
+		}
+	}
+
+	// The warmups were done offline half an hour ago, and the first one was
+	// edited before coming back online.
+	batch := []*syncOp{
+		warmup("op-1", 0, "40", start.Add(-30*time.Minute)),
+		warmup("op-2", 1, "50", start.Add(-28*time.Minute)),
+		{ID: "op-3", Type: syncEdit, At: start.Add(-27 * time.Minute), EditOp: "op-1", Edit: &editReq{Note: "felt easy", Reps: 6}},
+		warmup("op-4", 2, "60", start.Add(-26*time.Minute)),
+	}
+	resp := sync(batch...)
+	if diff := cmp.Diff([]syncStatus{syncApplied, syncApplied, syncApplied, syncApplied}, statuses(resp)); diff != "" {
+		t.Fatalf("unexpected statuses (-want +got)\n%s", diff)
+	}
+	first := resp.Results[0].Lift
+	if got, want := first.CreatedAt, start.Add(-30*time.Minute); !got.Equal(want) {
+		t.Errorf("first lift was recorded at %v, want the client's time %v", got, want)
+	}
+	if first.Note != "felt easy" || first.Reps != 6 {
+		t.Errorf("first lift = %d reps with note %q, want the edit applied", first.Reps, first.Note)
+	}
+	if resp.NextLift.NextMovementIndex != 1 || resp.NextLift.NextSetIndex != 0 {
+		t.Errorf("next up is movement %d set %d, want the first main set", resp.NextLift.NextMovementIndex, resp.NextLift.NextSetIndex)
+	}
+
+	// Resending the batch, e.g. because the response got lost, doesn't record
+	// anything twice.
+	resp = sync(batch...)
+	for _, res := range resp.Results {
+		if res.Status != syncApplied || !res.Replayed {
+			t.Errorf("resent operation %q was %s (replayed %t), want a replayed APPLIED", res.ID, res.Status, res.Replayed)
+		}
+	}
+	if got := resp.Results[0].Lift; got.Note != "felt easy" {
+		t.Errorf("replayed lift has note %q, want the current one", got.Note)
+	}
+
+	// Another device already did the warmups, so the rest of the batch isn't
+	// applied either.
+	resp = sync(
+		warmup("other-1", 0, "40", start.Add(-5*time.Minute)),
+		warmup("other-2", 1, "50", start.Add(-4*time.Minute)),
+	)
+	if diff := cmp.Diff([]syncStatus{syncConflict, syncNotApplied}, statuses(resp)); diff != "" {
+		t.Errorf("unexpected statuses for conflicting batch (-want +got)\n%s", diff)
+	}
+
+	main := &recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "85", Set: 0, Reps: 5}
+	tests := []struct {
+		desc string
+		op   *syncOp
+	}{
+		{"from the future", &syncOp{ID: "future", Type: syncRecord, At: start.Add(time.Hour), Record: main}},
+		{"reused ID", &syncOp{ID: "op-1", Type: syncRecord, Record: main}},
+		{"missing payload", &syncOp{ID: "empty", Type: syncRecord}},
+		{"unknown type", &syncOp{ID: "unknown", Type: "DANCE"}},
+		{"unknown edit op", &syncOp{ID: "edit", Type: syncEdit, EditOp: "nope", Edit: &editReq{Reps: 5}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			resp := sync(test.op)
+			if diff := cmp.Diff([]syncStatus{syncInvalid}, statuses(resp)); diff != "" {
+				t.Errorf("unexpected statuses (-want +got)\n%s", diff)
+			}
+		})
+	}
+
+	// An operation that another sync is still applying conflicts, rather than
+	// being applied twice.
+	pendingOp := &syncOp{ID: "pending", Type: syncRecord, Record: main}
+	body, err := json.Marshal(pendingOp)
+	if err != nil {
+		t.Fatalf("failed to marshal operation: %v", err)
+	}
+	sum := sha256.Sum256(body)
+	pending := &stronk.SavedResponse{Key: "pending", Path: syncOpPath, RequestHash: hex.EncodeToString(sum[:])}
+	if _, err := env.db.ReserveResponse(context.Background(), pending, time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	resp = sync(pendingOp)
+	if diff := cmp.Diff([]syncStatus{syncConflict}, statuses(resp)); diff != "" {
+		t.Errorf("unexpected statuses for pending operation (-want +got)\n%s", diff)
+	}
+
+	lifts, err := env.db.LiftHistory(context.Background(), stronk.LiftFilter{})
+	if err != nil {
+		t.Fatalf("LiftHistory: %v", err)
+	}
+	if n := len(lifts); n != 3 {
+		t.Errorf("got %d lifts, want 3", n)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	srv, _ := setup(t)
+	setTrainingMaxes(t, srv)
+
+	// Cleanups run last first, so streams are closed before the server.
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	// subscribe connects to the event stream, and returns a function to read
+	// events off it.
+	subscribe := func(lastID string) func() sseEvent {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/events", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to connect to event stream: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("event stream has content type %q", ct)
+		}
+		br := bufio.NewReader(resp.Body)
+		return func() sseEvent {
+			t.Helper()
+			return readEvent(t, br)
+		}
+	}
+	decode := func(e sseEvent) eventData {
+		t.Helper()
+		var dat eventData
+		if err := json.Unmarshal([]byte(e.Data), &dat); err != nil {
+			t.Fatalf("failed to decode %s event: %v", e.Type, err)
+		}
+		return dat
+	}
+
+	next := subscribe("")
+
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "40", Set: 0, Reps: 5})
+	recorded := next()
+	if recorded.Type != eventLiftRecorded {
+		t.Fatalf("got %s event, want %s", recorded.Type, eventLiftRecorded)
+	}
+	dat := decode(recorded)
+	if dat.Lift == nil || dat.Lift.Reps != 5 {
+		t.Errorf("recorded event has lift %+v, want the 5 rep warmup", dat.Lift)
+	}
+	if dat.NextLift == nil || dat.NextLift.NextSetIndex != 1 {
+		t.Errorf("recorded event has next lift %+v, want the second warmup", dat.NextLift)
+	}
+
+	edit := `{"id": 1, "note": "easy", "reps": 6}`
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/editLift", strings.NewReader(edit)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected response code from edit %d, wanted OK", w.Code)
+	}
+	edited := next()
+	if edited.Type != eventLiftEdited {
+		t.Fatalf("got %s event, want %s", edited.Type, eventLiftEdited)
+	}
+	if dat := decode(edited); dat.Lift == nil || dat.Lift.Note != "easy" {
+		t.Errorf("edited event has lift %+v, want the edited one", dat.Lift)
+	}
+
+	// A client that reconnects gets what it missed.
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "50", Set: 1, Reps: 5})
+	missed := subscribe(edited.ID)()
+	if missed.Type != eventLiftRecorded {
+		t.Fatalf("got %s event after reconnecting, want %s", missed.Type, eventLiftRecorded)
+	}
+	if dat := decode(missed); dat.Lift == nil || dat.Lift.SetNumber != 1 {
+		t.Errorf("missed event has lift %+v, want the second warmup", dat.Lift)
+	}
+
+	// One that was connected before a restart has to start over.
+	reset := subscribe("someotherboot-3")()
+	if reset.Type != eventReset {
+		t.Fatalf("got %s event for an unknown ID, want %s", reset.Type, eventReset)
+	}
+	if reset.ID != missed.ID {
+		t.Errorf("reset has ID %q, want the latest %q", reset.ID, missed.ID)
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	b := newEventBus()
+	for i := 0; i < eventHistory+10; i++ {
+		b.publish(eventLiftRecorded, []byte("{}"))
+	}
+	latest := b.eventID(b.seq)
+
+	missed, _, unsubscribe := b.subscribe(b.eventID(b.seq - 2))
+	defer unsubscribe()
+	if n := len(missed); n != 2 {
+		t.Errorf("got %d missed events, want 2", n)
+	}
+
+	// Events that fell out of history can't be replayed.
+	missed, _, unsubscribe = b.subscribe(b.eventID(5))
+	defer unsubscribe()
+	if len(missed) != 1 || missed[0].Type != eventReset || missed[0].ID != latest {
+		t.Errorf("got %+v for an expired ID, want a reset", missed)
+	}
+
+	// Subscribers that fall behind get dropped, rather than holding up
+	// publishing.
+	_, ch, unsubscribe := b.subscribe("")
+	defer unsubscribe()
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.publish(eventLiftRecorded, []byte("{}"))
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("got %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+}
+
+func TestChange(t *testing.T) {
+	srv, _ := setup(t)
+	ctx := context.Background()
+	_, ch, unsubscribe := srv.events.subscribe("")
+	defer unsubscribe()
+
+	// While one change is being made, others wait for its event to go out
+	// first, so events are published in the order their changes were made.
+	started, finish := make(chan struct{}), make(chan struct{})
+	firstDone := make(chan error)
+	go func() {
+		firstDone <- srv.change(ctx, eventLiftRecorded, func() (*eventData, error) {
+			close(started)
+			<-finish
+			return &eventData{}, nil
+		})
+	}()
+	<-started
+
+	// Waiting gives up with the request.
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	called := false
+	err := srv.change(timeout, eventLiftEdited, func() (*eventData, error) {
+		called = true
+		return &eventData{}, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("change that timed out waiting returned %v, want context.DeadlineExceeded", err)
+	}
+	if called {
+		t.Error("change that timed out waiting was made anyway")
+	}
+
+	secondDone := make(chan error)
+	go func() {
+		secondDone <- srv.change(ctx, eventWeekSkipped, func() (*eventData, error) {
+			return &eventData{Week: 1}, nil
+		})
+	}()
+	close(finish)
+	if err := <-firstDone; err != nil {
+		t.Fatalf("first change: %v", err)
+	}
+	if err := <-secondDone; err != nil {
+		t.Fatalf("second change: %v", err)
+	}
+
+	// Failed changes don't publish anything, or hold up later ones.
+	errFailed := errors.New("failed")
+	if err := srv.change(ctx, eventLiftEdited, func() (*eventData, error) { return nil, errFailed }); !errors.Is(err, errFailed) {
+		t.Errorf("failed change returned %v, want its error", err)
+	}
+	if err := srv.change(ctx, eventTrainingMaxesChanged, func() (*eventData, error) { return &eventData{}, nil }); err != nil {
+		t.Fatalf("change after a failed one: %v", err)
+	}
+
+	var got []eventType
+	for i := 0; i < 3; i++ {
+		got = append(got, (<-ch).Type)
+	}
+	if diff := cmp.Diff([]eventType{eventLiftRecorded, eventWeekSkipped, eventTrainingMaxesChanged}, got); diff != "" {
+		t.Errorf("unexpected events (-want +got)\n%s", diff)
+	}
+}
+
+type sseEvent struct {
+	ID   string
+	Type eventType
+	Data string
+}
+
+func readEvent(t *testing.T, br *bufio.Reader) sseEvent {
+	t.Helper()
+	var e sseEvent
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.Type = eventType(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			e.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestRepRecords(t *testing.T) {
+	srv, _ := setup(t)
+	setTrainingMaxes(t, srv)
+
+	main := func(set, reps int, weight string) recordReq {
+		return recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: weight, Set: set, Reps: reps}
+	}
+
+	doWarmups(t, srv)
+	// There's no record to beat yet.
+	if got := recordLift(t, srv, main(0, 5, "82.5")); got.NewRepRecord {
+		t.Error("first 5 rep set was flagged as a rep record")
+	}
+	if got := recordLift(t, srv, main(1, 5, "80")); got.NewRepRecord {
+		t.Error("lighter 5 rep set was flagged as a rep record")
+	}
+	top := recordLift(t, srv, main(2, 5, "95"))
+	if !top.NewRepRecord {
+		t.Error("heavier 5 rep set wasn't flagged as a rep record")
+	}
+	// Not the heaviest for its reps, but the most reps done at its weight.
+	if got := recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Assistance, Weight: "80", Reps: 10}); !got.NewRepRecord {
+		t.Error("most reps at a weight wasn't flagged as a rep record")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/records?exercise=OVERHEAD_PRESS", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if status := resp.StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+	var got stronk.RepRecords
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode records response: %v", err)
+	}
+	if n := len(got.ByReps); n != 2 {
+		t.Fatalf("got %d rep records, want 2", n)
+	}
+	if id := got.ByReps[0].Lift.ID; id != top.LiftID {
+		t.Errorf("5 rep record was lift %d, want %d", id, top.LiftID)
+	}
+	if n := len(got.ByWeight); n != 3 {
+		t.Errorf("got %d weight records, want 3", n)
+	}
+}
+
+func TestAchievements(t *testing.T) {
+	srv, _ := setup(t)
+	setTrainingMaxes(t, srv)
+
+	main := func(set, reps int, weight string) recordReq {
+		return recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: weight, Set: set, Reps: reps}
+	}
+
+	doWarmups(t, srv)
+	first := recordLift(t, srv, main(0, 5, "82.5"))
+	if n := len(first.Achievements); n != 0 {
+		t.Errorf("first lift had %d achievements, want none", n)
+	}
+	got := recordLift(t, srv, main(1, 5, "95"))
+	wantTypes := []stronk.AchievementType{stronk.OneRepMaxPR, stronk.WeightPR}
+	var gotTypes []stronk.AchievementType
+	for _, a := range got.Achievements {
+		gotTypes = append(gotTypes, a.Type)
+		if a.LiftID != got.LiftID || a.PreviousLiftID != first.LiftID {
+			t.Errorf("achievement %q was for lifts (%d, %d), want (%d, %d)", a.Type, a.LiftID, a.PreviousLiftID, got.LiftID, first.LiftID)
+		}
+	}
+	if diff := cmp.Diff(wantTypes, gotTypes); diff != "" {
+		t.Errorf("unexpected achievements (-want +got)\n%s", diff)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/achievements?exercise=OVERHEAD_PRESS", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if status := resp.StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+	var history []*stronk.Achievement
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode achievements response: %v", err)
+	}
+	if diff := cmp.Diff(got.Achievements, history); diff != "" {
+		t.Errorf("unexpected achievement history (-want +got)\n%s", diff)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	srv, _ := setup(t)
+	setTrainingMaxes(t, srv)
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "40", Set: 0, Reps: 5, Note: "easy"})
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: "50", Set: 1, Reps: 5})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if status := w.Result().StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from export %d, wanted OK", status)
+	}
+	exported := w.Body.Bytes()
+
+	dest, _ := setup(t)
+	doImport := func(body []byte) (*http.Response, stronk.ImportResult) {
+		r := httptest.NewRequest(http.MethodPost, "/api/import", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		dest.ServeHTTP(w, r)
+		resp := w.Result()
+		var res stronk.ImportResult
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				t.Fatalf("failed to decode import response: %v", err)
+			}
+		}
+		return resp, res
+	}
+
+	resp, got := doImport(exported)
+	if status := resp.StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from import %d, wanted OK", status)
+	}
+	want := stronk.ImportResult{Lifts: 2, TrainingMaxes: 4, SmallestDenoms: 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected first import result (-want +got)\n%s", diff)
+	}
+
+	// Importing again shouldn't insert anything.
+	_, got = doImport(exported)
+	want = stronk.ImportResult{Duplicates: 7}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected second import result (-want +got)\n%s", diff)
+	}
+
+	lifts, err := dest.db.LiftHistory(context.Background(), stronk.LiftFilter{})
+	if err != nil {
+		t.Fatalf("LiftHistory: %v", err)
+	}
+	if n := len(lifts); n != 2 {
+		t.Fatalf("got %d lifts after import, want 2", n)
+	}
+	if lifts[0].Note != "easy" {
+		t.Errorf("imported lift had note %q, want %q", lifts[0].Note, "easy")
+	}
+
+	// Lifts that don't fit the routine are rejected.
+	var doc map[string]interface{}
+	if err := json.Unmarshal(exported, &doc); err != nil {
+		t.Fatalf("failed to parse export: %v", err)
+	}
+	doc["Lifts"].([]interface{})[0].(map[string]interface{})["WeekNumber"] = 100
+	bad, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("failed to marshal export: %v", err)
+	}
+	if resp, _ := doImport(bad); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected response code from invalid import %d, wanted Bad Request", resp.StatusCode)
+	}
+}
+
+func TestExportLiftsCSV(t *testing.T) {
+	srv, env := setup(t)
+	setTrainingMaxes(t, srv)
+	doWarmups(t, srv)
+	recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Main, Weight: "65", Set: 0, Reps: 5})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/export/lifts.csv?"+query, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("setType=MAIN&unit=kg")
+	if status := w.Result().StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+	if ct := w.Result().Header.Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	rows := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if n := len(rows); n != 2 {
+		t.Fatalf("got %d CSV rows, want a header and one lift, CSV was:\n%s", n, w.Body.String())
+	}
+	if !strings.Contains(rows[1], ",MAIN,0,,29.48,KG,5,") {
+		t.Errorf("unexpected lift row %q", rows[1])
+	}
+	if !strings.HasSuffix(rows[1], ",1,Week 1,Press Day,") {
+		t.Errorf("lift row %q didn't have routine names", rows[1])
+	}
+
+	if status := get("unit=stone").Result().StatusCode; status != http.StatusBadRequest {
+		t.Errorf("unexpected response code for invalid unit %d, wanted Bad Request", status)
+	}
+
+	// A lift we can't write partway through aborts the response, rather than
+	// leaving the client with a truncated CSV that looks complete.
+	kgs := stronk.Weight{Value: 300, Unit: stronk.WeightUnit("DECI_KILOGRAMS")}
+	if _, err := env.db.RecordLift(context.Background(), stronk.Squat, stronk.Assistance, kgs, 0, 10, "", 0, 0, 0, false, "", 0, nil); err != nil {
+		t.Fatalf("RecordLift: %v", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Errorf("writing an unwritable lift panicked with %v, want http.ErrAbortHandler", r)
+			}
+		}()
+		get("")
+	}()
+}
+
+type fakeBackups struct {
+	snaps []*backup.Snapshot
+}
+
+func (f *fakeBackups) Snapshot() (*backup.Snapshot, error) {
+	snap := &backup.Snapshot{Name: fmt.Sprintf("snap-%d", len(f.snaps)), SizeBytes: 100}
+	f.snaps = append([]*backup.Snapshot{snap}, f.snaps...)
+	return snap, nil
+}
+
+func (f *fakeBackups) Snapshots() ([]*backup.Snapshot, error) {
+	return f.snaps, nil
+}
+
+func TestBackups(t *testing.T) {
+	srv, _ := setup(t)
+
+	do := func(method string) *http.Response {
+		r := httptest.NewRequest(method, "/api/admin/backups", nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	if status := do(http.MethodPost).StatusCode; status != http.StatusNotFound {
+		t.Fatalf("unexpected response code %d without backups configured, wanted Not Found", status)
+	}
+
+	srv.SetBackups(&fakeBackups{})
+	for i := 0; i < 2; i++ {
+		if status := do(http.MethodPost).StatusCode; status != http.StatusOK {
+			t.Fatalf("unexpected response code from server %d, wanted OK", status)
+		}
+	}
+
+	resp := do(http.MethodGet)
+	if status := resp.StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+	var got []*backup.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode backups response: %v", err)
+	}
+	want := []*backup.Snapshot{
+		{Name: "snap-1", SizeBytes: 100},
+		{Name: "snap-0", SizeBytes: 100},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected snapshots (-want +got)\n%s", diff)
+	}
+}
+
+// slowDB never finishes loading training maxes, it just waits for the caller
+// to give up.
+type slowDB struct {
+	*testdb.DB
+}
+
+func (s slowDB) TrainingMaxes(ctx context.Context) ([]*stronk.TrainingMax, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRequestTimeout(t *testing.T) {
+	srv := New(loadRoutine(t), slowDB{testdb.New()})
+	srv.SetRequestTimeout(10 * time.Millisecond)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/trainingMaxes", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if status := w.Result().StatusCode; status != http.StatusGatewayTimeout {
+		t.Errorf("unexpected response code from server %d, wanted Gateway Timeout", status)
+	}
+}
+
+func setTrainingMaxes(t *testing.T, srv *Server) {
+	t.Helper()
+
+	setTMReq := `{
+	"OverheadPress": "127.5",
+	"Squat": "230",
+	"BenchPress": "190",
+	"Deadlift": "280",
+	"SmallestDenom": "1.25"
+}`
+
+	r := httptest.NewRequest(http.MethodPost, "/api/setTrainingMaxes", strings.NewReader(setTMReq))
+	w := httptest.NewRecorder()
+	srv.serveSetTrainingMaxes(w, r)
+
+	if status := w.Result().StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+}
+
+func recordLift(t *testing.T, srv *Server, rr recordReq) recordLiftResp {
+	t.Helper()
+
+	req, err := json.Marshal(rr)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/recordLift", bytes.NewReader(req))
+	w := httptest.NewRecorder()
+	srv.serveRecordLift(w, r)
+
+	resp := w.Result()
+	if status := resp.StatusCode; status != http.StatusOK {
+		t.Fatalf("unexpected response code from server %d, wanted OK", status)
+	}
+
+	var got recordLiftResp
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode record lift response: %v", err)
+	}
+	return got
+}
+
+// doWarmups records the warmup sets for the first day of the example
+// routine, since lifts have to be recorded in order.
+func doWarmups(t *testing.T, srv *Server) {
+	t.Helper()
+	for i, weight := range []string{"40", "50", "60"} {
+		recordLift(t, srv, recordReq{Exercise: stronk.OverheadPress, SetType: stronk.Warmup, Weight: weight, Set: i, Reps: 5})
+	}
+}
+
 func testName(in recordReq) string {
 	return fmt.Sprintf("[%s] %s %d %d %d", in.SetType, in.Exercise, in.Set, in.Day, in.Week)
 }
@@ -744,7 +2097,7 @@ type testEnv struct {
 }
 
 func (e *testEnv) trainingMax(t *testing.T, ex stronk.Exercise) stronk.Weight {
-	tms, err := e.db.TrainingMaxes()
+	tms, err := e.db.TrainingMaxes(context.Background())
 	if err != nil {
 		t.Fatalf("failed to load training maxes: %v", err)
 	}
@@ -758,7 +2111,7 @@ func (e *testEnv) trainingMax(t *testing.T, ex stronk.Exercise) stronk.Weight {
 }
 
 func (e *testEnv) smallestDenom(t *testing.T) stronk.Weight {
-	w, err := e.db.SmallestDenom()
+	w, err := e.db.SmallestDenom(context.Background())
 	if err != nil {
 		t.Fatalf("failed to load smallest denom: %v", err)
 	}
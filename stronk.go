@@ -4,12 +4,19 @@ package stronk
 import (
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	ErrUserNotFound    = errors.New("user not found")
 	ErrNoSmallestDenom = errors.New("no smallest denom")
+	ErrInvalidRPE      = errors.New("RPE must be between 6 and 10, in half steps")
+	ErrInvalidRIR      = errors.New("reps in reserve can't be negative")
+	ErrMismatchedRIR   = errors.New("RPE and reps in reserve don't agree")
 )
 
 type SkippedWeek struct {
@@ -24,6 +31,26 @@ type ComparableLifts struct {
 	PREquivalentReps float64
 }
 
+// WorkoutContext is everything needed to figure out the next lift, loaded
+// from a single consistent snapshot of the database.
+type WorkoutContext struct {
+	RecentLifts   []*Lift
+	SkippedWeeks  []SkippedWeek
+	TrainingMaxes []*TrainingMax
+	SmallestDenom Weight
+	// FailureSets are, for each requested exercise, the best to-failure lift
+	// at each weight, most recent first. The best is the one with the highest
+	// one rep max equivalent, then the most recent, which is all that finding
+	// comparables needs, however long the history gets.
+	FailureSets map[Exercise][]*Lift
+}
+
+// Comparables returns the to-failure lifts to compare against a set of the
+// given weight, for an exercise that was requested.
+func (wc *WorkoutContext) Comparables(ex Exercise, weight Weight) *ComparableLifts {
+	return CalcComparables(wc.FailureSets[ex], weight)
+}
+
 func MainExercises() []Exercise {
 	return []Exercise{
 		OverheadPress,
@@ -75,11 +102,94 @@ func (w *Weight) String() string {
 type TrainingMax struct {
 	Max      Weight
 	Exercise Exercise
+	// SetAt is when the training max was set, so we know which lifts it applied
+	// to.
+	SetAt time.Time
+}
+
+// SmallestDenom is the smallest plate denomination available, as of when it
+// was set.
+type SmallestDenom struct {
+	Weight Weight
+	SetAt  time.Time
+}
+
+// UserData is everything a user has recorded, independent of how it's stored.
+// It's used for moving data between deployments.
+type UserData struct {
+	// Lifts, oldest first.
+	Lifts []*Lift
+	// TrainingMaxes is the full training max history, oldest first.
+	TrainingMaxes []*TrainingMax
+	// SmallestDenoms is the full smallest denomination history, oldest first.
+	SmallestDenoms []*SmallestDenom
+	SkippedWeeks   []SkippedWeek
+}
+
+// ImportResult counts the records inserted by importing UserData. Records
+// that were already present are counted as duplicates and left alone, so
+// importing the same data twice is a no-op.
+type ImportResult struct {
+	Lifts          int
+	TrainingMaxes  int
+	SmallestDenoms int
+	SkippedWeeks   int
+	Duplicates     int
+}
+
+// SavedResponse is the response to a request made with an idempotency key,
+// kept so that retrying the request gets the same response instead of doing
+// the work twice.
+type SavedResponse struct {
+	Key  string
+	Path string
+	// RequestHash identifies the request body, so a key can't be reused for a
+	// different request.
+	RequestHash string
+	// Status is zero while the request is still being handled.
+	Status    int
+	Body      []byte
+	CreatedAt time.Time
 }
 
 type Routine struct {
-	Name  string
-	Weeks []*WorkoutWeek
+	Name string
+	// RestSeconds is how long to rest after completing a set, keyed by the set
+	// type of the movement. Individual sets can override this.
+	RestSeconds map[SetType]int
+	Weeks       []*WorkoutWeek
+}
+
+// RestTarget returns how long to rest after completing the given set of the
+// given movement, or zero if the routine doesn't say.
+func (r *Routine) RestTarget(mvmt *Movement, set *Set) time.Duration {
+	if set != nil && set.RestSeconds > 0 {
+		return time.Duration(set.RestSeconds) * time.Second
+	}
+	if r == nil || mvmt == nil {
+		return 0
+	}
+	return time.Duration(r.RestSeconds[mvmt.SetType]) * time.Second
+}
+
+// FailureExercises returns every exercise with a to-failure set anywhere in
+// the routine, in the order they first appear.
+func (r *Routine) FailureExercises() []Exercise {
+	var exs []Exercise
+	seen := make(map[Exercise]bool)
+	for _, w := range r.Weeks {
+		for _, d := range w.Days {
+			for _, mvmt := range d.Movements {
+				for _, set := range mvmt.Sets {
+					if set.ToFailure && !seen[mvmt.Exercise] {
+						seen[mvmt.Exercise] = true
+						exs = append(exs, mvmt.Exercise)
+					}
+				}
+			}
+		}
+	}
+	return exs
 }
 
 func (r *Routine) Clone() *Routine {
@@ -87,9 +197,18 @@ func (r *Routine) Clone() *Routine {
 		return nil
 	}
 
+	var rest map[SetType]int
+	if r.RestSeconds != nil {
+		rest = make(map[SetType]int)
+		for st, secs := range r.RestSeconds {
+			rest[st] = secs
+		}
+	}
+
 	return &Routine{
-		Name:  r.Name,
-		Weeks: cloneWeeks(r.Weeks),
+		Name:        r.Name,
+		RestSeconds: rest,
+		Weeks:       cloneWeeks(r.Weeks),
 	}
 }
 
@@ -143,6 +262,47 @@ func (w *WorkoutDay) Clone() *WorkoutDay {
 	}
 }
 
+// SetPosition identifies a single set in a WorkoutDay.
+type SetPosition struct {
+	MovementIndex int
+	SetIndex      int
+}
+
+// SetOrder returns every set in the day, in the order they should be done.
+// That's usually just each movement's sets in turn, but adjacent movements
+// that share a Group are done in alternation, one set from each movement per
+// round, e.g. dips and rows would be dip 1, row 1, dip 2, row 2, etc.
+func (w *WorkoutDay) SetOrder() []SetPosition {
+	var out []SetPosition
+	for start := 0; start < len(w.Movements); {
+		// Find the end of the group starting at this movement, which is just the
+		// movement itself if it isn't grouped.
+		end := start + 1
+		if grp := w.Movements[start].Group; grp != "" {
+			for end < len(w.Movements) && w.Movements[end].Group == grp {
+				end++
+			}
+		}
+
+		for round := 0; ; round++ {
+			added := false
+			for i := start; i < end; i++ {
+				if round >= len(w.Movements[i].Sets) {
+					continue
+				}
+				out = append(out, SetPosition{MovementIndex: i, SetIndex: round})
+				added = true
+			}
+			if !added {
+				break
+			}
+		}
+
+		start = end
+	}
+	return out
+}
+
 func cloneMovements(mvmts []*Movement) []*Movement {
 	var out []*Movement
 	for _, mvmt := range mvmts {
@@ -154,9 +314,56 @@ func cloneMovements(mvmts []*Movement) []*Movement {
 type Movement struct {
 	Exercise Exercise
 	SetType  SetType
-	Sets     []*Set
+	// Group, if set, links this movement with the adjacent movements that share
+	// the same Group into a superset (or a circuit, for three or more). Their
+	// sets are done in alternation, see WorkoutDay.SetOrder.
+	Group string
+	Sets  []*Set
+
+	// Jokers, if set, means joker sets are suggested after a strong to-failure
+	// set in this movement.
+	Jokers *JokerConfig
+	// FirstSetLast, if set, means extra sets at the weight of the first set are
+	// suggested after the to-failure set in this movement.
+	FirstSetLast *FirstSetLastConfig
+
+	// JokerSets and FirstSetLastSets aren't set when users configure them, only
+	// in responses sent to clients. They contain any extra sets already done,
+	// followed by the next suggested one, if any.
+	JokerSets        []*Set
+	FirstSetLastSets []*Set
+}
+
+// JokerConfig configures joker sets, which are progressively heavier sets done
+// after a to-failure set that went well.
+type JokerConfig struct {
+	// IncrementPercentage is how much heavier each joker set is than the set
+	// before it, usually 5-10%.
+	IncrementPercentage int
+	// MinExtraReps is how many reps past the rep target the to-failure set needs
+	// to get for joker sets to be suggested.
+	MinExtraReps int
+	// MaxSets is the most joker sets that will be suggested.
+	MaxSets int
+}
+
+// FirstSetLastConfig configures "first set last" sets, which are done at the
+// weight of the movement's first set, after the to-failure set.
+type FirstSetLastConfig struct {
+	Sets int
+	// RepTarget defaults to the rep target of the movement's first set.
+	RepTarget int
 }
 
+// ExtraSet indicates that a lift isn't part of the routine, but was added on
+// based on how the to-failure set went.
+type ExtraSet string
+
+const (
+	JokerSet        = ExtraSet("JOKER")
+	FirstSetLastSet = ExtraSet("FIRST_SET_LAST")
+)
+
 func (m *Movement) Clone() *Movement {
 	if m == nil {
 		return nil
@@ -165,10 +372,30 @@ func (m *Movement) Clone() *Movement {
 	return &Movement{
 		Exercise: m.Exercise,
 		SetType:  m.SetType,
+		Group:    m.Group,
 		Sets:     cloneSets(m.Sets),
+
+		Jokers:       m.Jokers.Clone(),
+		FirstSetLast: m.FirstSetLast.Clone(),
 	}
 }
 
+func (j *JokerConfig) Clone() *JokerConfig {
+	if j == nil {
+		return nil
+	}
+	out := *j
+	return &out
+}
+
+func (f *FirstSetLastConfig) Clone() *FirstSetLastConfig {
+	if f == nil {
+		return nil
+	}
+	out := *f
+	return &out
+}
+
 func cloneSets(sets []*Set) []*Set {
 	var out []*Set
 	for _, set := range sets {
@@ -185,6 +412,18 @@ type Set struct {
 	// TrainingMaxPercentage is a number between 0 and 100 indicating what
 	// portion of your training max this lift is going for.
 	TrainingMaxPercentage int
+	// TargetRPE, if non-zero, prescribes the set by effort instead of (or in
+	// addition to) a percentage of the training max, e.g. a top single @ RPE 8.
+	// Sets with a TargetRPE are "top sets" that back-off sets are based on.
+	TargetRPE float64
+	// BackOffPercentage, if non-zero, prescribes the set as a percentage lighter
+	// than the most recent top set of the same exercise earlier in the day, e.g.
+	// 8 for "-8%". It's based on the weight actually lifted for the top set, if
+	// it's been recorded.
+	BackOffPercentage int
+	// RestSeconds, if non-zero, is how long to rest after this set, overriding
+	// the routine-level default for the set type.
+	RestSeconds int
 
 	// WeightTarget isn't set when users configure it, only in responses sent to
 	// clients.
@@ -206,12 +445,21 @@ func (s *Set) Clone() *Set {
 		RepTarget:             s.RepTarget,
 		ToFailure:             s.ToFailure,
 		TrainingMaxPercentage: s.TrainingMaxPercentage,
+		TargetRPE:             s.TargetRPE,
+		BackOffPercentage:     s.BackOffPercentage,
+		RestSeconds:           s.RestSeconds,
 		WeightTarget:          s.WeightTarget,
 	}
 }
 
 type LiftID int
 
+// HistoricalIteration is the iteration number of lifts imported from before
+// the user started using the routine, e.g. from another app. They count
+// towards records and comparables, but not towards progress through the
+// routine.
+const HistoricalIteration = -1
+
 type Lift struct {
 	ID        LiftID
 	Exercise  Exercise
@@ -229,6 +477,27 @@ type Lift struct {
 	WeekNumber      int
 	IterationNumber int
 	ToFailure       bool
+
+	// RPE is the rating of perceived exertion for the set, from 6 to 10 in half
+	// steps. Zero means it wasn't recorded.
+	RPE float64
+	// RIR is the number of reps in reserve, i.e. how many more reps could have
+	// been done. Nil means it wasn't recorded.
+	RIR *int
+
+	// Extra is empty for sets that are part of the routine. Note that the
+	// SetNumber of an extra set is its index among extra sets of the same kind.
+	Extra ExtraSet
+
+	// CreatedAt is when the lift was recorded, which we treat as when the set
+	// was completed.
+	CreatedAt time.Time
+}
+
+// IsHistorical reports whether the lift was imported from outside of the
+// routine, see HistoricalIteration.
+func (l *Lift) IsHistorical() bool {
+	return l.IterationNumber == HistoricalIteration
 }
 
 func (l *Lift) AsOneRepMax() Weight {
@@ -239,11 +508,55 @@ func (l *Lift) AsOneRepMax() Weight {
 	}
 }
 
+// AsRPEOneRepMax is like AsOneRepMax, but accounts for reps left in the tank,
+// based on the recorded reps in reserve, or the RPE if that wasn't recorded.
+// E.g. 5 reps @ RPE 8 is treated like 7 reps to failure. If neither was
+// recorded, it's the same as AsOneRepMax.
+func (l *Lift) AsRPEOneRepMax() Weight {
+	reps := float64(l.Reps) + l.repsInReserve()
+	return Weight{
+		Value: int(float64(l.Weight.Value) + 0.033333333*float64(l.Weight.Value)*reps),
+		Unit:  l.Weight.Unit,
+	}
+}
+
+// MaxRepsInReserve is the most reps in reserve that count towards estimating
+// a one rep max, which is the bottom of the RPE scale. Past that, "how many
+// more could you have done" is a guess that would wildly inflate estimates.
+const MaxRepsInReserve = 4
+
+func (l *Lift) repsInReserve() float64 {
+	var rir float64
+	if l.RIR != nil {
+		rir = float64(*l.RIR)
+	} else if l.RPE > 0 {
+		rir = 10 - l.RPE
+	}
+	return math.Min(rir, MaxRepsInReserve)
+}
+
+// ValidateEffort checks that an RPE and reps in reserve, as recorded on a
+// Lift, are valid. Both are optional, but if both are given, they have to say
+// the same thing. A half step RPE means somewhere between two whole numbers of
+// reps in reserve, so e.g. RPE 8.5 goes with either 1 or 2.
+func ValidateEffort(rpe float64, rir *int) error {
+	if rpe != 0 && (rpe < 10-MaxRepsInReserve || rpe > 10 || rpe*2 != float64(int(rpe*2))) {
+		return ErrInvalidRPE
+	}
+	if rir != nil && *rir < 0 {
+		return ErrInvalidRIR
+	}
+	if rpe != 0 && rir != nil && math.Abs(10-rpe-float64(*rir)) > 0.5 {
+		return ErrMismatchedRIR
+	}
+	return nil
+}
+
 func (l *Lift) CalcEquivalentReps(weight Weight) float64 {
 	// To calculate how many reps that would be, we basically run the ORM calc in reverse:
 	// ORM = Weight + (Weight * Num reps * 0.0333333)
 	// (ORM - Weight) / (Weight * 0.0333333) = Num reps
-	orm := l.AsOneRepMax()
+	orm := l.AsRPEOneRepMax()
 	return float64((orm.Value-weight.Value)*30) / float64(weight.Value)
 }
 
@@ -254,7 +567,7 @@ func FindPR(lifts []*Lift) *Lift {
 
 	var max, maxIndex int
 	for i, l := range lifts {
-		orm := l.AsOneRepMax()
+		orm := l.AsRPEOneRepMax()
 		if orm.Value > max {
 			max = orm.Value
 			maxIndex = i
@@ -264,8 +577,16 @@ func FindPR(lifts []*Lift) *Lift {
 	return lifts[maxIndex]
 }
 
+// CalcComparables finds the closest and PR lifts to the given weight. Like
+// FindClosest, only lifts in the same unit are considered.
 func CalcComparables(lifts []*Lift, weight Weight) *ComparableLifts {
-	pr := FindPR(lifts)
+	var sameUnit []*Lift
+	for _, l := range lifts {
+		if l.Weight.Unit == weight.Unit {
+			sameUnit = append(sameUnit, l)
+		}
+	}
+	pr := FindPR(sameUnit)
 	var equivReps float64
 	if pr != nil {
 		equivReps = pr.CalcEquivalentReps(weight)
@@ -277,25 +598,450 @@ func CalcComparables(lifts []*Lift, weight Weight) *ComparableLifts {
 	}
 }
 
+// FindClosest returns the lift closest in weight to the given one, breaking
+// ties by the highest one rep max equivalent, then by order in lifts. Lifts
+// in a different unit aren't comparable.
 func FindClosest(lifts []*Lift, weight Weight) *Lift {
-	if len(lifts) == 0 {
+	var closest *Lift
+	for _, l := range lifts {
+		if l.Weight.Unit != weight.Unit {
+			continue
+		}
+		if closest == nil {
+			closest = l
+			continue
+		}
+		dist, best := abs(l.Weight.Value-weight.Value), abs(closest.Weight.Value-weight.Value)
+		if dist < best || dist == best && l.AsRPEOneRepMax().Value > closest.AsRPEOneRepMax().Value {
+			closest = l
+		}
+	}
+	return closest
+}
+
+// LiftFilter narrows down a lift history lookup. Zero-valued fields don't
+// filter anything.
+type LiftFilter struct {
+	Exercise Exercise
+	SetType  SetType
+}
+
+// Matches returns true if the lift satisfies the filter.
+func (f LiftFilter) Matches(l *Lift) bool {
+	if f.Exercise != "" && l.Exercise != f.Exercise {
+		return false
+	}
+	if f.SetType != "" && l.SetType != f.SetType {
+		return false
+	}
+	return true
+}
+
+// MaxRepRecord is the highest rep count we track rep records for, anything
+// higher is more cardio than strength.
+const MaxRepRecord = 20
+
+// RepRecord is the heaviest lift done for a given number of reps.
+type RepRecord struct {
+	Reps int
+	Lift *Lift
+	// Previous is the record Lift beat, if it wasn't the first lift done for
+	// this number of reps.
+	Previous *Lift `json:",omitempty"`
+}
+
+// WeightRecord is the lift with the most reps done at a given weight.
+type WeightRecord struct {
+	Weight Weight
+	Lift   *Lift
+	// Previous is the record Lift beat, if it wasn't the first lift done at this
+	// weight.
+	Previous *Lift `json:",omitempty"`
+}
+
+type RepRecords struct {
+	Exercise Exercise
+	// ByReps contains a record for each rep count, from 1 to MaxRepRecord, that
+	// has been done, in increasing order of reps.
+	ByReps []*RepRecord
+	// ByWeight contains a record for each weight that has been lifted, heaviest
+	// first.
+	ByWeight []*WeightRecord
+}
+
+// CalcRepRecords builds the rep record table for an exercise. Warmup sets
+// aren't considered, and ties go to whoever did it first.
+func CalcRepRecords(ex Exercise, lifts []*Lift) *RepRecords {
+	var lfs []*Lift
+	for _, l := range lifts {
+		if l.Exercise != ex || l.SetType == Warmup || l.Reps < 1 {
+			continue
+		}
+		lfs = append(lfs, l)
+	}
+	slices.SortStableFunc(lfs, func(a, b *Lift) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return int(a.ID - b.ID)
+	})
+
+	byReps := make(map[int]*RepRecord)
+	byWeight := make(map[Weight]*WeightRecord)
+	for _, l := range lfs {
+		if l.Reps <= MaxRepRecord {
+			if cur, ok := byReps[l.Reps]; !ok {
+				byReps[l.Reps] = &RepRecord{Reps: l.Reps, Lift: l}
+			} else if l.Weight.Value > cur.Lift.Weight.Value {
+				byReps[l.Reps] = &RepRecord{Reps: l.Reps, Lift: l, Previous: cur.Lift}
+			}
+		}
+		if cur, ok := byWeight[l.Weight]; !ok {
+			byWeight[l.Weight] = &WeightRecord{Weight: l.Weight, Lift: l}
+		} else if l.Reps > cur.Lift.Reps {
+			byWeight[l.Weight] = &WeightRecord{Weight: l.Weight, Lift: l, Previous: cur.Lift}
+		}
+	}
+
+	out := &RepRecords{
+		Exercise: ex,
+		ByReps:   []*RepRecord{},
+		ByWeight: []*WeightRecord{},
+	}
+	for reps := 1; reps <= MaxRepRecord; reps++ {
+		if rec, ok := byReps[reps]; ok {
+			out.ByReps = append(out.ByReps, rec)
+		}
+	}
+	for _, rec := range byWeight {
+		out.ByWeight = append(out.ByWeight, rec)
+	}
+	slices.SortFunc(out.ByWeight, func(a, b *WeightRecord) int { return b.Weight.Value - a.Weight.Value })
+
+	return out
+}
+
+// IsNewRecord returns true if the given lift beat a previous record in either
+// table, i.e. it's the heaviest lift done for its number of reps, or the most
+// reps done at its weight, and something else was before it. The first lift
+// done for a number of reps or at a weight doesn't count.
+func (r *RepRecords) IsNewRecord(id LiftID) bool {
+	for _, rec := range r.ByReps {
+		if rec.Lift.ID == id && rec.Previous != nil {
+			return true
+		}
+	}
+	for _, rec := range r.ByWeight {
+		if rec.Lift.ID == id && rec.Previous != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type AchievementType string
+
+const (
+	// OneRepMaxPR means the lift had the highest estimated one rep max ever.
+	OneRepMaxPR = AchievementType("ONE_REP_MAX_PR")
+	// RepPR means the lift had the most reps ever done at its weight.
+	RepPR = AchievementType("REP_PR")
+	// WeightPR means the lift was the heaviest weight ever lifted.
+	WeightPR = AchievementType("WEIGHT_PR")
+)
+
+// Achievement is a personal record set by a lift.
+type Achievement struct {
+	Type     AchievementType
+	Exercise Exercise
+	LiftID   LiftID
+	// Weight is the estimated one rep max for a OneRepMaxPR, and the weight
+	// lifted otherwise.
+	Weight Weight
+	Reps   int
+
+	// The Previous* fields describe the record that was beaten.
+	PreviousLiftID LiftID
+	PreviousWeight Weight
+	PreviousReps   int
+
+	AchievedAt time.Time
+}
+
+// CalcAchievements returns the records that a lift beat, given all previous
+// lifts. A record needs to exist to be beaten, so e.g. the first time a weight
+// is lifted isn't a RepPR. Like rep records, warmup sets don't count.
+func CalcAchievements(lift *Lift, previous []*Lift) []*Achievement {
+	if lift.SetType == Warmup || lift.Reps < 1 {
+		return nil
+	}
+
+	var bestORM, heaviest, mostReps *Lift
+	for _, l := range previous {
+		if l.ID == lift.ID || l.Exercise != lift.Exercise || l.SetType == Warmup || l.Reps < 1 {
+			continue
+		}
+		if bestORM == nil || l.AsRPEOneRepMax().Value > bestORM.AsRPEOneRepMax().Value {
+			bestORM = l
+		}
+		if heaviest == nil || l.Weight.Value > heaviest.Weight.Value {
+			heaviest = l
+		}
+		if l.Weight == lift.Weight && (mostReps == nil || l.Reps > mostReps.Reps) {
+			mostReps = l
+		}
+	}
+
+	achievement := func(typ AchievementType, weight Weight, prev *Lift, prevWeight Weight) *Achievement {
+		return &Achievement{
+			Type:           typ,
+			Exercise:       lift.Exercise,
+			LiftID:         lift.ID,
+			Weight:         weight,
+			Reps:           lift.Reps,
+			PreviousLiftID: prev.ID,
+			PreviousWeight: prevWeight,
+			PreviousReps:   prev.Reps,
+			AchievedAt:     lift.CreatedAt,
+		}
+	}
+
+	var out []*Achievement
+	if orm := lift.AsRPEOneRepMax(); bestORM != nil && orm.Value > bestORM.AsRPEOneRepMax().Value {
+		out = append(out, achievement(OneRepMaxPR, orm, bestORM, bestORM.AsRPEOneRepMax()))
+	}
+	if mostReps != nil && lift.Reps > mostReps.Reps {
+		out = append(out, achievement(RepPR, lift.Weight, mostReps, mostReps.Weight))
+	}
+	if heaviest != nil && lift.Weight.Value > heaviest.Weight.Value {
+		out = append(out, achievement(WeightPR, lift.Weight, heaviest, heaviest.Weight))
+	}
+	return out
+}
+
+// VolumeGroup is a dimension that volume statistics can be grouped by.
+type VolumeGroup string
+
+const (
+	ByExercise  = VolumeGroup("EXERCISE")
+	BySetType   = VolumeGroup("SET_TYPE")
+	ByDay       = VolumeGroup("DAY")
+	ByWeek      = VolumeGroup("WEEK")
+	ByIteration = VolumeGroup("ITERATION")
+)
+
+// VolumeStats aggregates the training volume for a group of lifts.
+type VolumeStats struct {
+	// These identify the group, and are only set if they're part of the
+	// grouping. Grouping by day also groups by week and iteration, since days
+	// are numbered within a week, and weeks within an iteration.
+	Exercise        Exercise `json:",omitempty"`
+	SetType         SetType  `json:",omitempty"`
+	IterationNumber int
+	WeekNumber      int
+	DayNumber       int
+
+	Sets int
+	// HardSets are non-warmup sets, not counting those that were recorded as
+	// being easy, i.e. under RPE 7 or more than three reps in reserve.
+	HardSets  int
+	TotalReps int
+	// Tonnage is the total weight moved, i.e. the sum of weight × reps.
+	Tonnage Weight
+	// AverageIntensity is the average weight lifted as a percentage of the
+	// training max at the time, for sets where we know the training max.
+	AverageIntensity float64
+}
+
+// IsHardSet returns true if the lift counts towards a hard set count.
+func (l *Lift) IsHardSet() bool {
+	if l.SetType == Warmup {
+		return false
+	}
+	if l.RIR != nil {
+		return *l.RIR <= 3
+	}
+	if l.RPE > 0 {
+		return l.RPE >= 7
+	}
+	return true
+}
+
+type volumeKey struct {
+	ex              Exercise
+	st              SetType
+	iter, week, day int
+}
+
+// CalcVolumeStats groups lifts by the given dimensions and sums up their
+// volume. The training max history is used to work out intensity, and can be
+// in any order.
+func CalcVolumeStats(lifts []*Lift, tmHistory []*TrainingMax, groupBy []VolumeGroup) []*VolumeStats {
+	group := make(map[VolumeGroup]bool)
+	for _, g := range groupBy {
+		group[g] = true
+	}
+
+	tms := slices.Clone(tmHistory)
+	slices.SortStableFunc(tms, func(a, b *TrainingMax) int { return a.SetAt.Compare(b.SetAt) })
+	tmAt := func(l *Lift) (Weight, bool) {
+		var (
+			tm    Weight
+			found bool
+		)
+		for _, t := range tms {
+			if t.Exercise != l.Exercise {
+				continue
+			}
+			if t.SetAt.After(l.CreatedAt) {
+				break
+			}
+			tm, found = t.Max, true
+		}
+		return tm, found
+	}
+
+	type acc struct {
+		stats        *VolumeStats
+		intensitySum float64
+		intensityN   int
+	}
+	m := make(map[volumeKey]*acc)
+	var keys []volumeKey
+	for _, l := range lifts {
+		var k volumeKey
+		if group[ByExercise] {
+			k.ex = l.Exercise
+		}
+		if group[BySetType] {
+			k.st = l.SetType
+		}
+		if group[ByIteration] || group[ByWeek] || group[ByDay] {
+			k.iter = l.IterationNumber
+		}
+		if group[ByWeek] || group[ByDay] {
+			k.week = l.WeekNumber
+		}
+		if group[ByDay] {
+			k.day = l.DayNumber
+		}
+
+		a, ok := m[k]
+		if !ok {
+			a = &acc{stats: &VolumeStats{
+				Exercise:        k.ex,
+				SetType:         k.st,
+				IterationNumber: k.iter,
+				WeekNumber:      k.week,
+				DayNumber:       k.day,
+				Tonnage:         Weight{Unit: l.Weight.Unit},
+			}}
+			m[k] = a
+			keys = append(keys, k)
+		}
+
+		a.stats.Sets++
+		if l.IsHardSet() {
+			a.stats.HardSets++
+		}
+		a.stats.TotalReps += l.Reps
+		a.stats.Tonnage.Value += l.Weight.Value * l.Reps
+		if tm, ok := tmAt(l); ok && tm.Value > 0 {
+			a.intensitySum += 100 * float64(l.Weight.Value) / float64(tm.Value)
+			a.intensityN++
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b volumeKey) int {
+		if a.iter != b.iter {
+			return a.iter - b.iter
+		}
+		if a.week != b.week {
+			return a.week - b.week
+		}
+		if a.day != b.day {
+			return a.day - b.day
+		}
+		if a.ex != b.ex {
+			return strings.Compare(string(a.ex), string(b.ex))
+		}
+		return strings.Compare(string(a.st), string(b.st))
+	})
+
+	out := []*VolumeStats{}
+	for _, k := range keys {
+		a := m[k]
+		if a.intensityN > 0 {
+			a.stats.AverageIntensity = a.intensitySum / float64(a.intensityN)
+		}
+		out = append(out, a.stats)
+	}
+	return out
+}
+
+// RestStatus describes where the user is in their rest between sets.
+type RestStatus struct {
+	LastSetCompletedAt time.Time
+	// RecommendedRestSeconds is zero if the routine doesn't specify a rest
+	// target for the last set.
+	RecommendedRestSeconds int
+	// RemainingSeconds is how much longer to rest, it's never negative.
+	RemainingSeconds int
+}
+
+// CalcRestStatus returns how far into their rest a user is, given when they
+// finished their last set and how long they should rest after it.
+func CalcRestStatus(lastSetAt time.Time, target time.Duration, now time.Time) *RestStatus {
+	remaining := target - now.Sub(lastSetAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &RestStatus{
+		LastSetCompletedAt:     lastSetAt,
+		RecommendedRestSeconds: int(target / time.Second),
+		RemainingSeconds:       int(remaining.Round(time.Second) / time.Second),
+	}
+}
+
+// RestStats summarizes the rest taken between sets in a single session (i.e.
+// one day of one week of one iteration).
+type RestStats struct {
+	Intervals       int
+	TotalSeconds    int
+	AverageSeconds  int
+	ShortestSeconds int
+	LongestSeconds  int
+}
+
+// CalcRestStats computes rest statistics from the gaps between consecutive
+// lifts, which should all be from the same session. It returns nil if there
+// are fewer than two lifts, since there's no rest to speak of.
+func CalcRestStats(lifts []*Lift) *RestStats {
+	if len(lifts) < 2 {
 		return nil
 	}
 
-	var (
-		closest  = abs(lifts[0].Weight.Value - weight.Value)
-		max, idx int
-	)
+	times := make([]time.Time, len(lifts))
 	for i, l := range lifts {
-		dist := abs(l.Weight.Value - weight.Value)
-		orm := l.AsOneRepMax()
-		if dist < closest || dist == closest && orm.Value > max {
-			closest = dist
-			max = orm.Value
-			idx = i
+		times[i] = l.CreatedAt
+	}
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+
+	stats := &RestStats{ShortestSeconds: -1}
+	for i := 1; i < len(times); i++ {
+		secs := int(times[i].Sub(times[i-1]) / time.Second)
+		stats.Intervals++
+		stats.TotalSeconds += secs
+		if stats.ShortestSeconds == -1 || secs < stats.ShortestSeconds {
+			stats.ShortestSeconds = secs
+		}
+		if secs > stats.LongestSeconds {
+			stats.LongestSeconds = secs
 		}
 	}
-	return lifts[idx]
+	stats.AverageSeconds = stats.TotalSeconds / stats.Intervals
+
+	return stats
 }
 
 func abs(x int) int {
@@ -1,6 +1,13 @@
 package stronk
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
 
 func TestWeightString(t *testing.T) {
 	tests := []struct {
@@ -34,3 +41,379 @@ func TestWeightString(t *testing.T) {
 		})
 	}
 }
+
+func TestCalcRestStats(t *testing.T) {
+	start := time.Date(2023, 6, 10, 8, 0, 0, 0, time.UTC)
+	at := func(secs int) *Lift {
+		return &Lift{CreatedAt: start.Add(time.Duration(secs) * time.Second)}
+	}
+
+	tests := []struct {
+		desc  string
+		lifts []*Lift
+		want  *RestStats
+	}{
+		{
+			desc:  "no lifts",
+			lifts: nil,
+			want:  nil,
+		},
+		{
+			desc:  "single lift",
+			lifts: []*Lift{at(0)},
+			want:  nil,
+		},
+		{
+			desc: "out of order",
+			// Lifts usually come back newest first.
+			lifts: []*Lift{at(330), at(90), at(0)},
+			want: &RestStats{
+				Intervals:       2,
+				TotalSeconds:    330,
+				AverageSeconds:  165,
+				ShortestSeconds: 90,
+				LongestSeconds:  240,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := CalcRestStats(test.lifts)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected rest stats (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetOrder(t *testing.T) {
+	mvmt := func(group string, sets int) *Movement {
+		return &Movement{Group: group, Sets: make([]*Set, sets)}
+	}
+	pos := func(mvmt, set int) SetPosition {
+		return SetPosition{MovementIndex: mvmt, SetIndex: set}
+	}
+
+	tests := []struct {
+		desc string
+		in   []*Movement
+		want []SetPosition
+	}{
+		{
+			desc: "no groups",
+			in:   []*Movement{mvmt("", 2), mvmt("", 1)},
+			want: []SetPosition{pos(0, 0), pos(0, 1), pos(1, 0)},
+		},
+		{
+			desc: "superset",
+			in:   []*Movement{mvmt("", 1), mvmt("a", 2), mvmt("a", 2)},
+			want: []SetPosition{pos(0, 0), pos(1, 0), pos(2, 0), pos(1, 1), pos(2, 1)},
+		},
+		{
+			desc: "uneven circuit",
+			in:   []*Movement{mvmt("a", 3), mvmt("a", 1), mvmt("a", 2)},
+			want: []SetPosition{pos(0, 0), pos(1, 0), pos(2, 0), pos(0, 1), pos(2, 1), pos(0, 2)},
+		},
+		{
+			desc: "separate groups",
+			in:   []*Movement{mvmt("a", 2), mvmt("a", 1), mvmt("b", 1), mvmt("b", 2)},
+			want: []SetPosition{pos(0, 0), pos(1, 0), pos(0, 1), pos(2, 0), pos(3, 0), pos(3, 1)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			day := &WorkoutDay{Movements: test.in}
+			if diff := cmp.Diff(test.want, day.SetOrder()); diff != "" {
+				t.Errorf("unexpected set order (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAsRPEOneRepMax(t *testing.T) {
+	intPtr := func(in int) *int { return &in }
+	wt := Weight{Value: 2000, Unit: DeciPounds}
+
+	tests := []struct {
+		desc string
+		in   Lift
+		want Weight
+	}{
+		{
+			desc: "no RPE or RIR",
+			in:   Lift{Weight: wt, Reps: 5},
+			// Same as AsOneRepMax
+			want: Weight{Value: 2333, Unit: DeciPounds},
+		},
+		{
+			desc: "RPE 8",
+			in:   Lift{Weight: wt, Reps: 5, RPE: 8},
+			// Treated as 7 reps
+			want: Weight{Value: 2466, Unit: DeciPounds},
+		},
+		{
+			desc: "RPE 9.5",
+			in:   Lift{Weight: wt, Reps: 5, RPE: 9.5},
+			want: Weight{Value: 2366, Unit: DeciPounds},
+		},
+		{
+			desc: "RIR takes precedence",
+			in:   Lift{Weight: wt, Reps: 5, RPE: 8, RIR: intPtr(1)},
+			want: Weight{Value: 2399, Unit: DeciPounds},
+		},
+		{
+			desc: "reps in reserve are capped",
+			in:   Lift{Weight: wt, Reps: 5, RIR: intPtr(9)},
+			// Treated as 9 reps
+			want: Weight{Value: 2599, Unit: DeciPounds},
+		},
+		{
+			desc: "low RPE is capped",
+			in:   Lift{Weight: wt, Reps: 5, RPE: 1},
+			want: Weight{Value: 2599, Unit: DeciPounds},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := test.in.AsRPEOneRepMax(); got != test.want {
+				t.Errorf("AsRPEOneRepMax() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateEffort(t *testing.T) {
+	intPtr := func(in int) *int { return &in }
+
+	tests := []struct {
+		rpe     float64
+		rir     *int
+		wantErr error
+	}{
+		{rpe: 0, rir: nil},
+		{rpe: 0, rir: intPtr(6)},
+		{rpe: 8, rir: intPtr(2)},
+		{rpe: 6},
+		{rpe: 7.5},
+		{rpe: 10},
+		{rpe: 0.5, wantErr: ErrInvalidRPE},
+		{rpe: 5.5, wantErr: ErrInvalidRPE},
+		{rpe: 10.5, wantErr: ErrInvalidRPE},
+		{rpe: 8.25, wantErr: ErrInvalidRPE},
+		{rir: intPtr(-1), wantErr: ErrInvalidRIR},
+		{rpe: 8.5, rir: intPtr(1)},
+		{rpe: 8.5, rir: intPtr(2)},
+		{rpe: 9.5, rir: intPtr(0)},
+		{rpe: 10, rir: intPtr(3), wantErr: ErrMismatchedRIR},
+		{rpe: 9, rir: intPtr(2), wantErr: ErrMismatchedRIR},
+		{rpe: 8.5, rir: intPtr(3), wantErr: ErrMismatchedRIR},
+	}
+
+	for _, test := range tests {
+		if err := ValidateEffort(test.rpe, test.rir); !errors.Is(err, test.wantErr) {
+			t.Errorf("ValidateEffort(%g, %v) = %v, want %v", test.rpe, test.rir, err, test.wantErr)
+		}
+	}
+}
+
+func TestCalcRepRecords(t *testing.T) {
+	start := time.Date(2023, 6, 10, 8, 0, 0, 0, time.UTC)
+	wt := func(v int) Weight { return Weight{Value: v, Unit: DeciPounds} }
+	lift := func(id LiftID, st SetType, weight, reps int) *Lift {
+		return &Lift{
+			ID:        id,
+			Exercise:  Squat,
+			SetType:   st,
+			Weight:    wt(weight),
+			Reps:      reps,
+			CreatedAt: start.Add(time.Duration(id) * time.Minute),
+		}
+	}
+
+	var (
+		warmup        = lift(1, Warmup, 2500, 1)
+		first5        = lift(2, Main, 2000, 5)
+		tied5         = lift(3, Main, 2000, 5)
+		heavy3        = lift(4, Main, 2200, 3)
+		light8        = lift(5, Assistance, 2000, 8)
+		tooMany       = lift(6, Assistance, 1000, 25)
+		heavy5        = lift(7, Main, 2100, 5)
+		otherExercise = &Lift{ID: 8, Exercise: Deadlift, SetType: Main, Weight: wt(4000), Reps: 5}
+	)
+
+	got := CalcRepRecords(Squat, []*Lift{tooMany, light8, heavy3, tied5, first5, warmup, heavy5, otherExercise})
+	want := &RepRecords{
+		Exercise: Squat,
+		ByReps: []*RepRecord{
+			{Reps: 3, Lift: heavy3},
+			{Reps: 5, Lift: heavy5, Previous: first5},
+			{Reps: 8, Lift: light8},
+		},
+		ByWeight: []*WeightRecord{
+			{Weight: wt(2200), Lift: heavy3},
+			{Weight: wt(2100), Lift: heavy5},
+			{Weight: wt(2000), Lift: light8, Previous: first5},
+			{Weight: wt(1000), Lift: tooMany},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected rep records (-want +got)\n%s", diff)
+	}
+
+	tests := []struct {
+		desc string
+		lift *Lift
+		want bool
+	}{
+		// There was nothing to beat.
+		{"first 5 rep set", first5, false},
+		{"first 3 rep set", heavy3, false},
+		{"tied 5 rep set", tied5, false},
+		{"heavier 5 rep set", heavy5, true},
+		// Most reps at 200 lbs.
+		{"8 reps at a known weight", light8, true},
+	}
+	for _, test := range tests {
+		if got := got.IsNewRecord(test.lift.ID); got != test.want {
+			t.Errorf("IsNewRecord(%s) = %t, want %t", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCalcAchievements(t *testing.T) {
+	wt := func(v int) Weight { return Weight{Value: v, Unit: DeciPounds} }
+	lift := func(id LiftID, st SetType, weight, reps int) *Lift {
+		return &Lift{ID: id, Exercise: Squat, SetType: st, Weight: wt(weight), Reps: reps}
+	}
+
+	var (
+		warmup = lift(1, Warmup, 3000, 1)
+		fives  = lift(2, Main, 2000, 5)
+		triple = lift(3, Main, 2200, 3)
+		other  = &Lift{ID: 4, Exercise: Deadlift, SetType: Main, Weight: wt(4000), Reps: 5}
+	)
+	previous := []*Lift{warmup, fives, triple, other}
+
+	tests := []struct {
+		desc     string
+		in       *Lift
+		previous []*Lift
+		want     []AchievementType
+	}{
+		{
+			desc:     "first lift",
+			in:       lift(5, Main, 2000, 5),
+			previous: []*Lift{},
+			want:     nil,
+		},
+		{
+			desc: "warmups don't count",
+			in:   lift(5, Warmup, 5000, 5),
+			want: nil,
+		},
+		{
+			desc: "more reps at same weight",
+			in:   lift(5, Main, 2000, 6),
+			want: []AchievementType{RepPR},
+		},
+		{
+			desc: "more reps at same weight, with a better ORM",
+			in:   lift(5, Main, 2000, 8),
+			want: []AchievementType{OneRepMaxPR, RepPR},
+		},
+		{
+			desc: "heavier than ever, ignoring warmups",
+			in:   lift(5, Main, 2300, 1),
+			want: []AchievementType{WeightPR},
+		},
+		{
+			desc: "nothing special",
+			in:   lift(5, Assistance, 1500, 10),
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			prev := previous
+			if test.previous != nil {
+				prev = test.previous
+			}
+			var got []AchievementType
+			for _, a := range CalcAchievements(test.in, prev) {
+				got = append(got, a.Type)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected achievements (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCalcVolumeStats(t *testing.T) {
+	start := time.Date(2023, 6, 10, 8, 0, 0, 0, time.UTC)
+	wt := func(v int) Weight { return Weight{Value: v, Unit: DeciPounds} }
+	intPtr := func(in int) *int { return &in }
+	lift := func(ex Exercise, st SetType, iter, week, weight, reps int) *Lift {
+		return &Lift{
+			Exercise:        ex,
+			SetType:         st,
+			Weight:          wt(weight),
+			Reps:            reps,
+			WeekNumber:      week,
+			IterationNumber: iter,
+			CreatedAt:       start.Add(time.Duration(iter*7+week) * 24 * time.Hour),
+		}
+	}
+	easy := lift(Squat, Assistance, 1, 0, 1000, 10)
+	easy.RIR = intPtr(5)
+
+	lifts := []*Lift{
+		lift(Squat, Warmup, 0, 0, 1000, 5),
+		lift(Squat, Main, 0, 0, 1500, 5),
+		lift(Squat, Main, 0, 1, 1600, 3),
+		lift(Deadlift, Main, 0, 0, 2000, 5),
+		lift(Squat, Main, 1, 0, 1800, 5),
+		easy,
+	}
+	tms := []*TrainingMax{
+		// Squat TM goes up for the second iteration.
+		{Exercise: Squat, Max: wt(2400), SetAt: start.Add(7 * 24 * time.Hour)},
+		{Exercise: Squat, Max: wt(2000), SetAt: start},
+	}
+
+	got := CalcVolumeStats(lifts, tms, []VolumeGroup{ByIteration, ByExercise})
+	want := []*VolumeStats{
+		{
+			Exercise:         Deadlift,
+			Sets:             1,
+			HardSets:         1,
+			TotalReps:        5,
+			Tonnage:          wt(10000),
+			AverageIntensity: 0,
+		},
+		{
+			Exercise:         Squat,
+			Sets:             3,
+			HardSets:         2,
+			TotalReps:        13,
+			Tonnage:          wt(5000 + 7500 + 4800),
+			AverageIntensity: (50 + 75 + 80) / 3.0,
+		},
+		{
+			Exercise:         Squat,
+			IterationNumber:  1,
+			Sets:             2,
+			HardSets:         1,
+			TotalReps:        15,
+			Tonnage:          wt(9000 + 10000),
+			AverageIntensity: (75 + 100.0/2.4) / 2,
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 0.001)); diff != "" {
+		t.Errorf("unexpected volume stats (-want +got)\n%s", diff)
+	}
+}
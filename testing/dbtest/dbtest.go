@@ -0,0 +1,1055 @@
+// Package dbtest is a conformance suite for server.DB implementations, so
+// that sqldb, pgdb and the in-memory testdb stay interchangeable. Every method
+// of the interface is covered, including result order and tie-breaking.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bcspragu/stronk"
+	"github.com/bcspragu/stronk/server"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// Factory returns a new, empty database for a single test. Implementations
+// should clean it up with t.Cleanup.
+type Factory func(t *testing.T) server.DB
+
+// Run runs the behavior tests against databases returned by newDB.
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, server.DB)
+	}{
+		{"SmallestDenom", testSmallestDenom},
+		{"TrainingMaxes", testTrainingMaxes},
+		{"SkippedWeeks", testSkippedWeeks},
+		{"RecordAndEditLift", testRecordAndEditLift},
+		{"RecentLifts", testRecentLifts},
+		{"LiftHistory", testLiftHistory},
+		{"Comparables", testComparables},
+		{"RecentFailureSets", testRecentFailureSets},
+		{"WorkoutContext", testWorkoutContext},
+		{"RecordNextLift", testRecordNextLift},
+		{"SkipNextWeek", testSkipNextWeek},
+		{"Achievements", testAchievements},
+		{"ExportImport", testExportImport},
+		{"SavedResponses", testSavedResponses},
+		{"Canceled", testCanceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newDB(t))
+		})
+	}
+}
+
+// ignoreGenerated ignores fields the database fills in itself.
+var ignoreGenerated = cmp.Options{
+	cmpopts.IgnoreFields(stronk.Lift{}, "ID", "CreatedAt"),
+	cmpopts.IgnoreFields(stronk.TrainingMax{}, "SetAt"),
+	cmpopts.IgnoreFields(stronk.Achievement{}, "AchievedAt"),
+}
+
+func lbs(v int) stronk.Weight {
+	return stronk.Weight{Value: v * 10, Unit: stronk.DeciPounds}
+}
+
+func intPtr(v int) *int { return &v }
+
+func testSmallestDenom(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	if _, err := db.SmallestDenom(ctx); !errors.Is(err, stronk.ErrNoSmallestDenom) {
+		t.Fatalf("SmallestDenom on empty DB returned %v, want ErrNoSmallestDenom", err)
+	}
+
+	// The most recent one wins, even if it was set in the same second.
+	for _, v := range []int{50, 25} {
+		if err := db.SetSmallestDenom(ctx, stronk.Weight{Value: v, Unit: stronk.DeciPounds}); err != nil {
+			t.Fatalf("SetSmallestDenom: %v", err)
+		}
+	}
+	got, err := db.SmallestDenom(ctx)
+	if err != nil {
+		t.Fatalf("SmallestDenom: %v", err)
+	}
+	if want := (stronk.Weight{Value: 25, Unit: stronk.DeciPounds}); got != want {
+		t.Errorf("SmallestDenom = %+v, want %+v", got, want)
+	}
+
+	// Importing an older one doesn't replace it.
+	old := &stronk.SmallestDenom{Weight: stronk.Weight{Value: 100, Unit: stronk.DeciPounds}, SetAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := db.ImportData(ctx, &stronk.UserData{SmallestDenoms: []*stronk.SmallestDenom{old}}); err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+	if got, err = db.SmallestDenom(ctx); err != nil {
+		t.Fatalf("SmallestDenom: %v", err)
+	}
+	if want := (stronk.Weight{Value: 25, Unit: stronk.DeciPounds}); got != want {
+		t.Errorf("SmallestDenom after import = %+v, want %+v", got, want)
+	}
+}
+
+func testTrainingMaxes(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	got, err := db.TrainingMaxes(ctx)
+	if err != nil {
+		t.Fatalf("TrainingMaxes: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("TrainingMaxes on empty DB returned %d maxes", len(got))
+	}
+
+	// Set twice, most likely in the same second, the second set should win.
+	if err := db.SetTrainingMaxes(ctx, lbs(90), lbs(190), lbs(140), lbs(240)); err != nil {
+		t.Fatalf("SetTrainingMaxes: %v", err)
+	}
+	if err := db.SetTrainingMaxes(ctx, lbs(100), lbs(200), lbs(150), lbs(250)); err != nil {
+		t.Fatalf("SetTrainingMaxes: %v", err)
+	}
+
+	// An older import shows up in the history, but isn't current.
+	old := &stronk.TrainingMax{Exercise: stronk.Squat, Max: lbs(135), SetAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := db.ImportData(ctx, &stronk.UserData{TrainingMaxes: []*stronk.TrainingMax{old}}); err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+
+	// Current maxes come back in the order the exercises were created, which
+	// for the main lifts is stronk.MainExercises.
+	want := []*stronk.TrainingMax{
+		{Exercise: stronk.OverheadPress, Max: lbs(100)},
+		{Exercise: stronk.Squat, Max: lbs(200)},
+		{Exercise: stronk.BenchPress, Max: lbs(150)},
+		{Exercise: stronk.Deadlift, Max: lbs(250)},
+	}
+	if got, err = db.TrainingMaxes(ctx); err != nil {
+		t.Fatalf("TrainingMaxes: %v", err)
+	}
+	if diff := cmp.Diff(want, got, ignoreGenerated); diff != "" {
+		t.Errorf("unexpected training maxes (-want +got)\n%s", diff)
+	}
+
+	hist, err := db.TrainingMaxHistory(ctx)
+	if err != nil {
+		t.Fatalf("TrainingMaxHistory: %v", err)
+	}
+	wantHist := []*stronk.TrainingMax{
+		old,
+		{Exercise: stronk.OverheadPress, Max: lbs(90)},
+		{Exercise: stronk.Squat, Max: lbs(190)},
+		{Exercise: stronk.BenchPress, Max: lbs(140)},
+		{Exercise: stronk.Deadlift, Max: lbs(240)},
+		want[0], want[1], want[2], want[3],
+	}
+	if diff := cmp.Diff(wantHist, hist, ignoreGenerated); diff != "" {
+		t.Errorf("unexpected training max history (-want +got)\n%s", diff)
+	}
+	if !hist[0].SetAt.Equal(old.SetAt) {
+		t.Errorf("imported training max was set at %v, want %v", hist[0].SetAt, old.SetAt)
+	}
+	for _, tm := range hist {
+		if tm.SetAt.IsZero() {
+			t.Errorf("training max for %q has no timestamp", tm.Exercise)
+		}
+	}
+}
+
+func testSkippedWeeks(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	got, err := db.SkippedWeeks(ctx)
+	if err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("SkippedWeeks on empty DB returned %d weeks", len(got))
+	}
+
+	skips := []stronk.SkippedWeek{
+		{Week: 1, Iteration: 0, Note: "vacation"},
+		{Week: 0, Iteration: 1, Note: "sick"},
+		{Week: 2, Iteration: 0, Note: "moving"},
+		// Skipping the same week twice keeps both, newest first.
+		{Week: 1, Iteration: 0, Note: "still on vacation"},
+	}
+	for _, wk := range skips {
+		if err := db.SkipWeek(ctx, wk.Note, wk.Week, wk.Iteration); err != nil {
+			t.Fatalf("SkipWeek: %v", err)
+		}
+	}
+
+	if got, err = db.SkippedWeeks(ctx); err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	want := []stronk.SkippedWeek{skips[1], skips[2], skips[3], skips[0]}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected skipped weeks (-want +got)\n%s", diff)
+	}
+}
+
+func testRecordAndEditLift(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	id, err := db.RecordLift(ctx, stronk.Exercise("Dips"), stronk.Assistance, lbs(0), 1, 12, "bodyweight", 2, 1, 0, false, "", 0, nil)
+	if err != nil {
+		t.Fatalf("RecordLift: %v", err)
+	}
+
+	got, err := db.Lift(ctx, id)
+	if err != nil {
+		t.Fatalf("Lift: %v", err)
+	}
+	want := &stronk.Lift{
+		ID:         id,
+		Exercise:   stronk.Exercise("Dips"),
+		SetType:    stronk.Assistance,
+		Weight:     lbs(0),
+		SetNumber:  1,
+		Reps:       12,
+		Note:       "bodyweight",
+		DayNumber:  2,
+		WeekNumber: 1,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected lift (-want +got)\n%s", diff)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("lift has no timestamp")
+	}
+
+	if err := db.EditLift(ctx, id, "felt good", 10, 8.5, intPtr(2)); err != nil {
+		t.Fatalf("EditLift: %v", err)
+	}
+	if got, err = db.Lift(ctx, id); err != nil {
+		t.Fatalf("Lift: %v", err)
+	}
+	want.Note, want.Reps, want.RPE, want.RIR = "felt good", 10, 8.5, intPtr(2)
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected lift after edit (-want +got)\n%s", diff)
+	}
+
+	// Clearing effort clears it.
+	if err := db.EditLift(ctx, id, "", 10, 0, nil); err != nil {
+		t.Fatalf("EditLift: %v", err)
+	}
+	if got, err = db.Lift(ctx, id); err != nil {
+		t.Fatalf("Lift: %v", err)
+	}
+	want.Note, want.RPE, want.RIR = "", 0, nil
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected lift after clearing edit (-want +got)\n%s", diff)
+	}
+
+	// Returned lifts are copies, modifying them doesn't change what's stored.
+	got.Reps = 100
+	if got, err = db.Lift(ctx, id); err != nil {
+		t.Fatalf("Lift: %v", err)
+	}
+	if got.Reps != 10 {
+		t.Errorf("modifying a returned lift changed the stored one, reps = %d", got.Reps)
+	}
+
+	if _, err := db.Lift(ctx, id+1000); err == nil {
+		t.Error("Lift with unknown ID returned no error")
+	}
+	if err := db.EditLift(ctx, id+1000, "", 1, 0, nil); err == nil {
+		t.Error("EditLift with unknown ID returned no error")
+	}
+}
+
+func testRecentLifts(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	got, err := db.RecentLifts(ctx)
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("RecentLifts on empty DB returned %d lifts", len(got))
+	}
+
+	record := func(set, day, week, iter int) {
+		t.Helper()
+		if _, err := db.RecordLift(ctx, stronk.Squat, stronk.Main, lbs(200), set, 5, "", day, week, iter, false, "", 0, nil); err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+	}
+	record(0, 0, 0, 0)
+	record(0, 1, 0, 0)
+	record(0, 0, 1, 0)
+	record(0, 0, 0, stronk.HistoricalIteration)
+	// Same spot in the routine, the later one comes first.
+	record(1, 0, 1, 0)
+
+	if got, err = db.RecentLifts(ctx); err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	lift := func(set, day, week int) *stronk.Lift {
+		return &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: set, Reps: 5, DayNumber: day, WeekNumber: week}
+	}
+	want := []*stronk.Lift{lift(1, 0, 1), lift(0, 0, 1), lift(0, 1, 0), lift(0, 0, 0)}
+	if diff := cmp.Diff(want, got, ignoreGenerated); diff != "" {
+		t.Errorf("unexpected recent lifts (-want +got)\n%s", diff)
+	}
+
+	// Only the most recent 100 are returned.
+	for i := 0; i < 100; i++ {
+		record(i, 0, 2, 0)
+	}
+	if got, err = db.RecentLifts(ctx); err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if n := len(got); n != 100 {
+		t.Fatalf("RecentLifts returned %d lifts, want 100", n)
+	}
+	if first, last := got[0].SetNumber, got[99].SetNumber; first != 99 || last != 0 {
+		t.Errorf("RecentLifts returned sets %d to %d, want 99 to 0", first, last)
+	}
+}
+
+func testLiftHistory(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	lifts := []*stronk.Lift{
+		{Exercise: stronk.Squat, SetType: stronk.Warmup, Weight: lbs(100), SetNumber: 1, Reps: 5},
+		{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 1, Reps: 5},
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(300), SetNumber: 1, Reps: 5, DayNumber: 1},
+		{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(180), SetNumber: 1, Reps: 8, IterationNumber: stronk.HistoricalIteration},
+	}
+	for _, l := range lifts {
+		if _, err := db.RecordLift(ctx, l.Exercise, l.SetType, l.Weight, l.SetNumber, l.Reps, "", l.DayNumber, l.WeekNumber, l.IterationNumber, false, "", 0, nil); err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+	}
+	// Imported lifts are ordered by when they happened, not when they were
+	// imported.
+	imported := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(150), SetNumber: 1, Reps: 10, IterationNumber: stronk.HistoricalIteration, CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := db.ImportData(ctx, &stronk.UserData{Lifts: []*stronk.Lift{imported}}); err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+
+	tests := []struct {
+		filter stronk.LiftFilter
+		want   []*stronk.Lift
+	}{
+		{stronk.LiftFilter{}, append([]*stronk.Lift{imported}, lifts...)},
+		{stronk.LiftFilter{Exercise: stronk.Squat}, []*stronk.Lift{imported, lifts[0], lifts[1], lifts[3]}},
+		{stronk.LiftFilter{SetType: stronk.Main}, []*stronk.Lift{imported, lifts[1], lifts[2], lifts[3]}},
+		{stronk.LiftFilter{Exercise: stronk.Squat, SetType: stronk.Main}, []*stronk.Lift{imported, lifts[1], lifts[3]}},
+		{stronk.LiftFilter{Exercise: stronk.BenchPress}, nil},
+	}
+	for _, test := range tests {
+		got, err := db.LiftHistory(ctx, test.filter)
+		if err != nil {
+			t.Fatalf("LiftHistory(%+v): %v", test.filter, err)
+		}
+		if diff := cmp.Diff(test.want, got, ignoreGenerated, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("unexpected lift history for %+v (-want +got)\n%s", test.filter, diff)
+		}
+	}
+}
+
+func testComparables(t *testing.T, db server.DB) {
+	ctx := context.Background()
+	if err := db.SetSmallestDenom(ctx, lbs(5)); err != nil {
+		t.Fatalf("SetSmallestDenom: %v", err)
+	}
+	comparables := func(weight stronk.Weight) *stronk.ComparableLifts {
+		t.Helper()
+		wc, err := db.WorkoutContext(ctx, []stronk.Exercise{stronk.BenchPress})
+		if err != nil {
+			t.Fatalf("WorkoutContext: %v", err)
+		}
+		return wc.Comparables(stronk.BenchPress, weight)
+	}
+
+	if diff := cmp.Diff(&stronk.ComparableLifts{}, comparables(lbs(150))); diff != "" {
+		t.Errorf("unexpected comparables with no lifts (-want +got)\n%s", diff)
+	}
+
+	kgs := func(v int) stronk.Weight { return stronk.Weight{Value: v, Unit: stronk.WeightUnit("DECI_KILOGRAMS")} }
+	lifts := []*stronk.Lift{
+		// Not to failure, never comparable.
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(200), SetNumber: 1, Reps: 5},
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(140), SetNumber: 3, Reps: 12, ToFailure: true},
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(160), SetNumber: 3, Reps: 5, ToFailure: true, WeekNumber: 1},
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(170), SetNumber: 3, Reps: 3, ToFailure: true, RIR: intPtr(1), WeekNumber: 2},
+		// Just as close as the 160 lb set, with a lower e1RM.
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(150), SetNumber: 3, Reps: 2, ToFailure: true, WeekNumber: 3},
+		// Reps in reserve are capped, so this isn't a ~220 lb e1RM.
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(120), SetNumber: 3, Reps: 5, ToFailure: true, RIR: intPtr(20), WeekNumber: 3, DayNumber: 2},
+		// A different unit is never the closest weight, even if the number is.
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: kgs(1550), SetNumber: 3, Reps: 1, ToFailure: true, WeekNumber: 3, DayNumber: 1},
+		// Nor the PR, even with a bigger e1RM than any of the pound lifts.
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: kgs(1500), SetNumber: 3, Reps: 10, ToFailure: true, WeekNumber: 3, DayNumber: 1},
+		// A different exercise, never comparable.
+		{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(150), SetNumber: 3, Reps: 20, ToFailure: true},
+	}
+	for _, l := range lifts {
+		id, err := db.RecordLift(ctx, l.Exercise, l.SetType, l.Weight, l.SetNumber, l.Reps, "", l.DayNumber, l.WeekNumber, l.IterationNumber, l.ToFailure, "", 0, l.RIR)
+		if err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+		l.ID = id
+	}
+
+	got := comparables(lbs(155))
+	// 140x12 is an e1RM of ~196, the best of the lot.
+	want := &stronk.ComparableLifts{
+		ClosestWeight:    lifts[2],
+		PersonalRecord:   lifts[1],
+		PREquivalentReps: lifts[1].CalcEquivalentReps(lbs(155)),
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected comparables (-want +got)\n%s", diff)
+	}
+
+	// Matching a PR exactly, the more recent lift wins.
+	again := *lifts[1]
+	again.WeekNumber = 4
+	var err error
+	if again.ID, err = db.RecordLift(ctx, again.Exercise, again.SetType, again.Weight, again.SetNumber, again.Reps, "", again.DayNumber, again.WeekNumber, again.IterationNumber, true, "", 0, nil); err != nil {
+		t.Fatalf("RecordLift: %v", err)
+	}
+	got = comparables(lbs(140))
+	want = &stronk.ComparableLifts{
+		ClosestWeight:    &again,
+		PersonalRecord:   &again,
+		PREquivalentReps: again.CalcEquivalentReps(lbs(140)),
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected comparables after tying PR (-want +got)\n%s", diff)
+	}
+}
+
+func testWorkoutContext(t *testing.T, db server.DB) {
+	ctx := context.Background()
+	exs := []stronk.Exercise{stronk.BenchPress, stronk.Squat, stronk.OverheadPress}
+
+	if _, err := db.WorkoutContext(ctx, exs); !errors.Is(err, stronk.ErrNoSmallestDenom) {
+		t.Fatalf("WorkoutContext on empty DB returned %v, want ErrNoSmallestDenom", err)
+	}
+
+	if err := db.SetSmallestDenom(ctx, lbs(5)); err != nil {
+		t.Fatalf("SetSmallestDenom: %v", err)
+	}
+	if err := db.SetTrainingMaxes(ctx, lbs(100), lbs(200), lbs(150), lbs(250)); err != nil {
+		t.Fatalf("SetTrainingMaxes: %v", err)
+	}
+	if err := db.SkipWeek(ctx, "deload", 3, 0); err != nil {
+		t.Fatalf("SkipWeek: %v", err)
+	}
+	lifts := []*stronk.Lift{
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(130), SetNumber: 1, Reps: 5},
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(140), SetNumber: 3, Reps: 10, ToFailure: true},
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(150), SetNumber: 3, Reps: 6, ToFailure: true, WeekNumber: 1},
+		// Worse than the earlier set at the same weight, so not included.
+		{Exercise: stronk.BenchPress, SetType: stronk.Main, Weight: lbs(140), SetNumber: 3, Reps: 8, ToFailure: true, WeekNumber: 2},
+		{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(180), SetNumber: 3, Reps: 8, ToFailure: true, DayNumber: 1},
+		// Not requested, so not included.
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(220), SetNumber: 3, Reps: 8, ToFailure: true, DayNumber: 2},
+		// Historical lifts aren't recent, but still count for comparables.
+		{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 1, Reps: 10, ToFailure: true, IterationNumber: stronk.HistoricalIteration},
+	}
+	for _, l := range lifts {
+		id, err := db.RecordLift(ctx, l.Exercise, l.SetType, l.Weight, l.SetNumber, l.Reps, "", l.DayNumber, l.WeekNumber, l.IterationNumber, l.ToFailure, "", 0, nil)
+		if err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+		l.ID = id
+	}
+
+	got, err := db.WorkoutContext(ctx, exs)
+	if err != nil {
+		t.Fatalf("WorkoutContext: %v", err)
+	}
+
+	// Everything should match what the individual methods return.
+	recent, err := db.RecentLifts(ctx)
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	skipped, err := db.SkippedWeeks(ctx)
+	if err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	tms, err := db.TrainingMaxes(ctx)
+	if err != nil {
+		t.Fatalf("TrainingMaxes: %v", err)
+	}
+	if diff := cmp.Diff(recent, got.RecentLifts); diff != "" {
+		t.Errorf("unexpected recent lifts (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(skipped, got.SkippedWeeks); diff != "" {
+		t.Errorf("unexpected skipped weeks (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(tms, got.TrainingMaxes); diff != "" {
+		t.Errorf("unexpected training maxes (-want +got)\n%s", diff)
+	}
+	if got.SmallestDenom != lbs(5) {
+		t.Errorf("smallest denom = %v, want %v", got.SmallestDenom, lbs(5))
+	}
+	if _, ok := got.FailureSets[stronk.Deadlift]; ok {
+		t.Error("failure sets included deadlift, which wasn't requested")
+	}
+
+	wantFailureSets := map[stronk.Exercise][]*stronk.Lift{
+		stronk.BenchPress: {lifts[2], lifts[1]},
+		stronk.Squat:      {lifts[4], lifts[6]},
+	}
+	if diff := cmp.Diff(wantFailureSets, got.FailureSets, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected failure sets (-want +got)\n%s", diff)
+	}
+
+	comparables := []struct {
+		ex     stronk.Exercise
+		weight stronk.Weight
+		want   *stronk.ComparableLifts
+	}{
+		// 140x10 is an e1RM of ~186, 150x6 is 180.
+		{stronk.BenchPress, lbs(135), &stronk.ComparableLifts{ClosestWeight: lifts[1], PersonalRecord: lifts[1]}},
+		{stronk.BenchPress, lbs(150), &stronk.ComparableLifts{ClosestWeight: lifts[2], PersonalRecord: lifts[1]}},
+		// 180 and 200 are just as close, the historical 200x10 has the higher e1RM.
+		{stronk.Squat, lbs(190), &stronk.ComparableLifts{ClosestWeight: lifts[6], PersonalRecord: lifts[6]}},
+		{stronk.Deadlift, lbs(190), &stronk.ComparableLifts{}},
+	}
+	for _, c := range comparables {
+		if c.want.PersonalRecord != nil {
+			c.want.PREquivalentReps = c.want.PersonalRecord.CalcEquivalentReps(c.weight)
+		}
+		if diff := cmp.Diff(c.want, got.Comparables(c.ex, c.weight), cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+			t.Errorf("unexpected comparables for %s at %v (-want +got)\n%s", c.ex, c.weight, diff)
+		}
+	}
+}
+
+func testRecordNextLift(t *testing.T, db server.DB) {
+	ctx := context.Background()
+	exs := []stronk.Exercise{stronk.Squat}
+
+	if err := db.SetSmallestDenom(ctx, lbs(5)); err != nil {
+		t.Fatalf("SetSmallestDenom: %v", err)
+	}
+	first := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 0, Reps: 5}
+	firstID, err := db.RecordLift(ctx, first.Exercise, first.SetType, first.Weight, first.SetNumber, first.Reps, "", 0, 0, 0, false, "", 0, nil)
+	if err != nil {
+		t.Fatalf("RecordLift: %v", err)
+	}
+	first.ID = firstID
+
+	// A failed check means nothing is recorded.
+	errStale := errors.New("stale")
+	next := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(220), SetNumber: 1, Reps: 8, Note: "grindy", ToFailure: true, RIR: intPtr(0)}
+	achieved := false
+	_, _, err = db.RecordNextLift(ctx, next, exs, func(*stronk.WorkoutContext) error { return errStale }, func(stronk.LiftID, []*stronk.Lift) []*stronk.Achievement {
+		achieved = true
+		return nil
+	})
+	if !errors.Is(err, errStale) {
+		t.Fatalf("RecordNextLift with failing check returned %v, want the check's error", err)
+	}
+	if achieved {
+		t.Error("achievements were calculated for a lift that wasn't recorded")
+	}
+	recent, err := db.RecentLifts(ctx)
+	if err != nil {
+		t.Fatalf("RecentLifts: %v", err)
+	}
+	if diff := cmp.Diff([]*stronk.Lift{first}, recent, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected lifts after failed check (-want +got)\n%s", diff)
+	}
+
+	// The check sees the state before the lift, achievements and the returned
+	// context include it.
+	var (
+		before  *stronk.WorkoutContext
+		history []*stronk.Lift
+		ach     *stronk.Achievement
+	)
+	id, after, err := db.RecordNextLift(ctx, next, exs, func(wc *stronk.WorkoutContext) error {
+		before = wc
+		return nil
+	}, func(id stronk.LiftID, h []*stronk.Lift) []*stronk.Achievement {
+		history = h
+		ach = &stronk.Achievement{Type: stronk.WeightPR, Exercise: stronk.Squat, LiftID: id, Weight: lbs(220), Reps: 8, PreviousLiftID: firstID, PreviousWeight: lbs(200), PreviousReps: 5}
+		return []*stronk.Achievement{ach}
+	})
+	if err != nil {
+		t.Fatalf("RecordNextLift: %v", err)
+	}
+	if diff := cmp.Diff([]*stronk.Lift{first}, before.RecentLifts, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected recent lifts passed to check (-want +got)\n%s", diff)
+	}
+	want := *next
+	want.ID = id
+	if diff := cmp.Diff([]*stronk.Lift{&want, first}, after.RecentLifts, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected recent lifts after recording (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff([]*stronk.Lift{&want}, after.FailureSets[stronk.Squat], cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected failure sets after recording (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff([]*stronk.Lift{first, &want}, history, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected history passed to achieve (-want +got)\n%s", diff)
+	}
+	achs, err := db.Achievements(ctx, stronk.Squat)
+	if err != nil {
+		t.Fatalf("Achievements: %v", err)
+	}
+	if diff := cmp.Diff([]*stronk.Achievement{ach}, achs, cmpopts.IgnoreFields(stronk.Achievement{}, "AchievedAt")); diff != "" {
+		t.Errorf("unexpected achievements after recording (-want +got)\n%s", diff)
+	}
+
+	got, err := db.Lift(ctx, id)
+	if err != nil {
+		t.Fatalf("Lift: %v", err)
+	}
+	if diff := cmp.Diff(&want, got, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected recorded lift (-want +got)\n%s", diff)
+	}
+
+	// Lifts done offline are recorded as done when the client says they were.
+	doneAt := time.Date(2023, 6, 10, 8, 30, 15, 0, time.UTC)
+	offline := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 2, Reps: 5, CreatedAt: doneAt}
+	id, _, err = db.RecordNextLift(ctx, offline, exs, func(*stronk.WorkoutContext) error { return nil }, nil)
+	if err != nil {
+		t.Fatalf("RecordNextLift: %v", err)
+	}
+	if got, err = db.Lift(ctx, id); err != nil {
+		t.Fatalf("Lift: %v", err)
+	}
+	if !got.CreatedAt.Equal(doneAt) {
+		t.Errorf("offline lift was recorded at %v, want %v", got.CreatedAt, doneAt)
+	}
+}
+
+func testSkipNextWeek(t *testing.T, db server.DB) {
+	ctx := context.Background()
+	exs := []stronk.Exercise{stronk.Squat}
+
+	if err := db.SetSmallestDenom(ctx, lbs(5)); err != nil {
+		t.Fatalf("SetSmallestDenom: %v", err)
+	}
+	first := stronk.SkippedWeek{Week: 1, Iteration: 0, Note: "vacation"}
+	if err := db.SkipWeek(ctx, first.Note, first.Week, first.Iteration); err != nil {
+		t.Fatalf("SkipWeek: %v", err)
+	}
+
+	// A failed check means nothing is skipped.
+	errStale := errors.New("stale")
+	_, err := db.SkipNextWeek(ctx, "sick", 2, 0, exs, func(*stronk.WorkoutContext) error { return errStale })
+	if !errors.Is(err, errStale) {
+		t.Fatalf("SkipNextWeek with failing check returned %v, want the check's error", err)
+	}
+	got, err := db.SkippedWeeks(ctx)
+	if err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	if diff := cmp.Diff([]stronk.SkippedWeek{first}, got); diff != "" {
+		t.Errorf("unexpected skipped weeks after failed check (-want +got)\n%s", diff)
+	}
+
+	// The check sees the state before the skip, the returned context includes
+	// it.
+	var before *stronk.WorkoutContext
+	after, err := db.SkipNextWeek(ctx, "sick", 2, 0, exs, func(wc *stronk.WorkoutContext) error {
+		before = wc
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SkipNextWeek: %v", err)
+	}
+	if diff := cmp.Diff([]stronk.SkippedWeek{first}, before.SkippedWeeks); diff != "" {
+		t.Errorf("unexpected skipped weeks passed to check (-want +got)\n%s", diff)
+	}
+	want := []stronk.SkippedWeek{{Week: 2, Iteration: 0, Note: "sick"}, first}
+	if diff := cmp.Diff(want, after.SkippedWeeks); diff != "" {
+		t.Errorf("unexpected skipped weeks after skipping (-want +got)\n%s", diff)
+	}
+	if got, err = db.SkippedWeeks(ctx); err != nil {
+		t.Fatalf("SkippedWeeks: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected skipped weeks (-want +got)\n%s", diff)
+	}
+}
+
+func testRecentFailureSets(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	lifts := []*stronk.Lift{
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(300), SetNumber: 3, Reps: 7, ToFailure: true},
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(310), SetNumber: 3, Reps: 6, ToFailure: true, WeekNumber: 1},
+		// Not to failure.
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(280), SetNumber: 2, Reps: 5, WeekNumber: 1},
+		// Extra sets don't count.
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(320), SetNumber: 4, Reps: 3, ToFailure: true, WeekNumber: 1, Extra: stronk.JokerSet},
+		// Neither does assistance work.
+		{Exercise: stronk.Exercise("Rows"), SetType: stronk.Assistance, Weight: lbs(100), SetNumber: 1, Reps: 12, ToFailure: true},
+		// Or historical lifts.
+		{Exercise: stronk.Deadlift, SetType: stronk.Main, Weight: lbs(250), SetNumber: 1, Reps: 10, ToFailure: true, IterationNumber: stronk.HistoricalIteration},
+	}
+	for _, l := range lifts {
+		if _, err := db.RecordLift(ctx, l.Exercise, l.SetType, l.Weight, l.SetNumber, l.Reps, "", l.DayNumber, l.WeekNumber, l.IterationNumber, l.ToFailure, l.Extra, 0, nil); err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+	}
+
+	got, err := db.RecentFailureSets(ctx)
+	if err != nil {
+		t.Fatalf("RecentFailureSets: %v", err)
+	}
+	want := []*stronk.Lift{lifts[1], lifts[0]}
+	if diff := cmp.Diff(want, got, ignoreGenerated); diff != "" {
+		t.Errorf("unexpected failure sets (-want +got)\n%s", diff)
+	}
+
+	// Only the most recent 250 are returned.
+	for i := 0; i < 250; i++ {
+		if _, err := db.RecordLift(ctx, stronk.Deadlift, stronk.Main, lbs(300), 3, 5, "", 0, 0, 1, true, "", 0, nil); err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+	}
+	if got, err = db.RecentFailureSets(ctx); err != nil {
+		t.Fatalf("RecentFailureSets: %v", err)
+	}
+	if n := len(got); n != 250 {
+		t.Fatalf("RecentFailureSets returned %d lifts, want 250", n)
+	}
+	for _, l := range got {
+		if l.IterationNumber != 1 {
+			t.Fatalf("RecentFailureSets returned a lift from iteration %d, want only the newest 250", l.IterationNumber)
+		}
+	}
+}
+
+func testAchievements(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	if err := db.RecordAchievements(ctx, nil); err != nil {
+		t.Fatalf("RecordAchievements(nil): %v", err)
+	}
+
+	record := func(ex stronk.Exercise, w stronk.Weight, reps int) stronk.LiftID {
+		t.Helper()
+		id, err := db.RecordLift(ctx, ex, stronk.Main, w, 3, reps, "", 0, 0, 0, true, "", 0, nil)
+		if err != nil {
+			t.Fatalf("RecordLift: %v", err)
+		}
+		return id
+	}
+	prevSquat, squat := record(stronk.Squat, lbs(200), 5), record(stronk.Squat, lbs(200), 8)
+	prevBench, bench := record(stronk.BenchPress, lbs(150), 5), record(stronk.BenchPress, lbs(160), 5)
+
+	// Imported lifts are older than everything recorded here, despite having
+	// a higher ID.
+	oldAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(100), SetNumber: 1, Reps: 20, IterationNumber: stronk.HistoricalIteration, ToFailure: true, CreatedAt: oldAt}
+	if _, err := db.ImportData(ctx, &stronk.UserData{Lifts: []*stronk.Lift{old}}); err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+	hist, err := db.LiftHistory(ctx, stronk.LiftFilter{Exercise: stronk.Squat})
+	if err != nil {
+		t.Fatalf("LiftHistory: %v", err)
+	}
+	oldID := hist[0].ID
+
+	achs := []*stronk.Achievement{
+		{Type: stronk.RepPR, Exercise: stronk.Squat, LiftID: squat, Weight: lbs(200), Reps: 8, PreviousLiftID: prevSquat, PreviousWeight: lbs(200), PreviousReps: 5},
+		{Type: stronk.OneRepMaxPR, Exercise: stronk.Squat, LiftID: squat, Weight: lbs(253), Reps: 8, PreviousLiftID: prevSquat, PreviousWeight: lbs(233), PreviousReps: 5},
+		{Type: stronk.WeightPR, Exercise: stronk.BenchPress, LiftID: bench, Weight: lbs(160), Reps: 5, PreviousLiftID: prevBench, PreviousWeight: lbs(150), PreviousReps: 5},
+		{Type: stronk.RepPR, Exercise: stronk.Squat, LiftID: oldID, Weight: lbs(100), Reps: 20, PreviousLiftID: prevSquat, PreviousWeight: lbs(100), PreviousReps: 15},
+	}
+	if err := db.RecordAchievements(ctx, achs); err != nil {
+		t.Fatalf("RecordAchievements: %v", err)
+	}
+
+	// Achievements for the same lift stay in the order they were recorded.
+	got, err := db.Achievements(ctx, stronk.Squat)
+	if err != nil {
+		t.Fatalf("Achievements: %v", err)
+	}
+	if diff := cmp.Diff([]*stronk.Achievement{achs[0], achs[1], achs[3]}, got, ignoreGenerated); diff != "" {
+		t.Errorf("unexpected squat achievements (-want +got)\n%s", diff)
+	}
+	// They're timestamped with the lift.
+	if at := got[2].AchievedAt; !at.Equal(oldAt) {
+		t.Errorf("achievement for imported lift at %v, want %v", at, oldAt)
+	}
+
+	// All exercises, newest first.
+	if got, err = db.Achievements(ctx, ""); err != nil {
+		t.Fatalf("Achievements: %v", err)
+	}
+	if diff := cmp.Diff([]*stronk.Achievement{achs[2], achs[0], achs[1], achs[3]}, got, ignoreGenerated); diff != "" {
+		t.Errorf("unexpected achievements (-want +got)\n%s", diff)
+	}
+
+	if got, err = db.Achievements(ctx, stronk.Deadlift); err != nil {
+		t.Fatalf("Achievements: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %d deadlift achievements, want none", len(got))
+	}
+}
+
+func testExportImport(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	at := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	data := &stronk.UserData{
+		Lifts: []*stronk.Lift{
+			{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 1, Reps: 5, Note: "easy", ToFailure: true, RPE: 7, CreatedAt: at},
+			{Exercise: stronk.Exercise("Chin-ups"), SetType: stronk.Assistance, Weight: lbs(0), SetNumber: 1, Reps: 10, RIR: intPtr(1), CreatedAt: at.Add(time.Minute)},
+		},
+		TrainingMaxes: []*stronk.TrainingMax{
+			{Exercise: stronk.Squat, Max: lbs(225), SetAt: at.Add(-time.Hour)},
+		},
+		SmallestDenoms: []*stronk.SmallestDenom{
+			{Weight: stronk.Weight{Value: 25, Unit: stronk.DeciPounds}, SetAt: at.Add(-time.Hour)},
+		},
+		SkippedWeeks: []stronk.SkippedWeek{
+			{Week: 2, Iteration: 0, Note: "deload"},
+		},
+	}
+
+	res, err := db.ImportData(ctx, data)
+	if err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+	if diff := cmp.Diff(&stronk.ImportResult{Lifts: 2, TrainingMaxes: 1, SmallestDenoms: 1, SkippedWeeks: 1}, res); diff != "" {
+		t.Errorf("unexpected import result (-want +got)\n%s", diff)
+	}
+
+	// Importing the same data again is a no-op.
+	if res, err = db.ImportData(ctx, data); err != nil {
+		t.Fatalf("ImportData: %v", err)
+	}
+	if diff := cmp.Diff(&stronk.ImportResult{Duplicates: 5}, res); diff != "" {
+		t.Errorf("unexpected result re-importing (-want +got)\n%s", diff)
+	}
+
+	got, err := db.ExportData(ctx)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	timesEqual := cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })
+	if diff := cmp.Diff(data, got, cmpopts.IgnoreFields(stronk.Lift{}, "ID"), timesEqual); diff != "" {
+		t.Errorf("unexpected exported data (-want +got)\n%s", diff)
+	}
+}
+
+func testSavedResponses(t *testing.T, db server.DB) {
+	ctx := context.Background()
+	longAgo := time.Now().Add(-24 * time.Hour)
+	ignoreCreatedAt := cmpopts.IgnoreFields(stronk.SavedResponse{}, "CreatedAt")
+
+	got, err := db.SavedResponse(ctx, "unknown")
+	if err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got saved response %+v for unknown key, want nil", got)
+	}
+	if err := db.SaveResponse(ctx, &stronk.SavedResponse{Key: "unknown", Status: 200}); err == nil {
+		t.Error("SaveResponse for a key that wasn't reserved succeeded, want an error")
+	}
+
+	first := &stronk.SavedResponse{Key: "abc", Path: "/api/recordLift", RequestHash: "1234"}
+	if got, err = db.ReserveResponse(ctx, first, longAgo, longAgo); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("got saved response %+v when reserving a new key, want nil", got)
+	}
+
+	// A duplicate sees the reservation, which has no status yet.
+	pending, err := db.ReserveResponse(ctx, first, longAgo, longAgo)
+	if err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	if diff := cmp.Diff(first, pending, ignoreCreatedAt); diff != "" {
+		t.Errorf("unexpected pending response (-want +got)\n%s", diff)
+	}
+	if pending != nil && pending.CreatedAt.IsZero() {
+		t.Error("reservation had no creation time")
+	}
+
+	first.Status, first.Body = 200, []byte(`{"LiftID":1}`)
+	if err := db.SaveResponse(ctx, first); err != nil {
+		t.Fatalf("SaveResponse: %v", err)
+	}
+	// The first response for a key wins.
+	second := &stronk.SavedResponse{Key: "abc", Path: "/api/recordLift", RequestHash: "1234", Status: 200, Body: []byte(`{"LiftID":2}`)}
+	if err := db.SaveResponse(ctx, second); err == nil {
+		t.Error("SaveResponse for a key with a saved response succeeded, want an error")
+	}
+	// Releasing only drops reservations, not saved responses.
+	if err := db.ReleaseResponse(ctx, "abc"); err != nil {
+		t.Fatalf("ReleaseResponse: %v", err)
+	}
+
+	if got, err = db.SavedResponse(ctx, "abc"); err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if diff := cmp.Diff(first, got, ignoreCreatedAt); diff != "" {
+		t.Errorf("unexpected saved response (-want +got)\n%s", diff)
+	}
+	if got, err = db.ReserveResponse(ctx, first, longAgo, longAgo); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	if diff := cmp.Diff(first, got, ignoreCreatedAt); diff != "" {
+		t.Errorf("unexpected response when reserving a saved key (-want +got)\n%s", diff)
+	}
+
+	// A released reservation can be reserved again.
+	other := &stronk.SavedResponse{Key: "def", Path: "/api/editLift", RequestHash: "5678"}
+	if _, err := db.ReserveResponse(ctx, other, longAgo, longAgo); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	if err := db.ReleaseResponse(ctx, "def"); err != nil {
+		t.Fatalf("ReleaseResponse: %v", err)
+	}
+	if got, err = db.SavedResponse(ctx, "def"); err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got saved response %+v after releasing it, want nil", got)
+	}
+	if got, err = db.ReserveResponse(ctx, other, longAgo, longAgo); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got saved response %+v when reserving a released key, want nil", got)
+	}
+
+	// Abandoned reservations are dropped, but saved responses are kept until
+	// they expire.
+	soon := time.Now().Add(time.Hour)
+	abandoned := &stronk.SavedResponse{Key: "ghi", Path: "/api/skipOptionalWeek", RequestHash: "9012"}
+	if got, err = db.ReserveResponse(ctx, abandoned, soon, longAgo); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got saved response %+v when reserving a new key, want nil", got)
+	}
+	if got, err = db.SavedResponse(ctx, "def"); err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got reservation %+v after it was abandoned, want nil", got)
+	}
+	if got, err = db.SavedResponse(ctx, "abc"); err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if got == nil {
+		t.Error("saved response was dropped as abandoned")
+	}
+
+	// Reserving a key drops expired responses. Some responses, like editLift's,
+	// don't have a body.
+	last := &stronk.SavedResponse{Key: "jkl", Path: "/api/editLift", RequestHash: "3456"}
+	if _, err := db.ReserveResponse(ctx, last, longAgo, soon); err != nil {
+		t.Fatalf("ReserveResponse: %v", err)
+	}
+	last.Status = 200
+	if err := db.SaveResponse(ctx, last); err != nil {
+		t.Fatalf("SaveResponse: %v", err)
+	}
+	if got, err = db.SavedResponse(ctx, "abc"); err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got saved response %+v after it expired, want nil", got)
+	}
+	if got, err = db.SavedResponse(ctx, "jkl"); err != nil {
+		t.Fatalf("SavedResponse: %v", err)
+	}
+	if diff := cmp.Diff(last, got, ignoreCreatedAt); diff != "" {
+		t.Errorf("unexpected saved response (-want +got)\n%s", diff)
+	}
+}
+
+func testCanceled(t *testing.T, db server.DB) {
+	ctx := context.Background()
+
+	id, err := db.RecordLift(ctx, stronk.Squat, stronk.Main, lbs(200), 1, 5, "", 0, 0, 0, true, "", 0, nil)
+	if err != nil {
+		t.Fatalf("RecordLift: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	calls := map[string]func() error{
+		"SkippedWeeks": func() error { _, err := db.SkippedWeeks(canceled); return err },
+		"SkipWeek":     func() error { return db.SkipWeek(canceled, "", 1, 0) },
+		"SkipNextWeek": func() error {
+			_, err := db.SkipNextWeek(canceled, "", 1, 0, nil, func(*stronk.WorkoutContext) error { return nil })
+			return err
+		},
+		"SetTrainingMaxes": func() error {
+			return db.SetTrainingMaxes(canceled, lbs(100), lbs(200), lbs(150), lbs(250))
+		},
+		"TrainingMaxes":      func() error { _, err := db.TrainingMaxes(canceled); return err },
+		"TrainingMaxHistory": func() error { _, err := db.TrainingMaxHistory(canceled); return err },
+		"SetSmallestDenom":   func() error { return db.SetSmallestDenom(canceled, lbs(5)) },
+		"SmallestDenom":      func() error { _, err := db.SmallestDenom(canceled); return err },
+		"RecordLift": func() error {
+			_, err := db.RecordLift(canceled, stronk.Squat, stronk.Main, lbs(200), 2, 5, "", 0, 0, 0, false, "", 0, nil)
+			return err
+		},
+		"Lift":        func() error { _, err := db.Lift(canceled, id); return err },
+		"EditLift":    func() error { return db.EditLift(canceled, id, "", 6, 0, nil) },
+		"RecentLifts": func() error { _, err := db.RecentLifts(canceled); return err },
+		"LiftHistory": func() error { _, err := db.LiftHistory(canceled, stronk.LiftFilter{}); return err },
+		"RecordAchievements": func() error {
+			return db.RecordAchievements(canceled, []*stronk.Achievement{{Type: stronk.RepPR, LiftID: id, Weight: lbs(200), Reps: 5, PreviousLiftID: id, PreviousWeight: lbs(200), PreviousReps: 4}})
+		},
+		"Achievements":      func() error { _, err := db.Achievements(canceled, ""); return err },
+		"RecentFailureSets": func() error { _, err := db.RecentFailureSets(canceled); return err },
+		"WorkoutContext": func() error {
+			_, err := db.WorkoutContext(canceled, []stronk.Exercise{stronk.Squat})
+			return err
+		},
+		"RecordNextLift": func() error {
+			l := &stronk.Lift{Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 2, Reps: 5}
+			_, _, err := db.RecordNextLift(canceled, l, nil, func(*stronk.WorkoutContext) error { return nil }, nil)
+			return err
+		},
+		"ExportData": func() error { _, err := db.ExportData(canceled); return err },
+		"ImportData": func() error {
+			_, err := db.ImportData(canceled, &stronk.UserData{SkippedWeeks: []stronk.SkippedWeek{{Week: 2}}})
+			return err
+		},
+		"SavedResponse": func() error { _, err := db.SavedResponse(canceled, "abc"); return err },
+		"ReserveResponse": func() error {
+			_, err := db.ReserveResponse(canceled, &stronk.SavedResponse{Key: "abc"}, time.Now(), time.Now())
+			return err
+		},
+		"SaveResponse":    func() error { return db.SaveResponse(canceled, &stronk.SavedResponse{Key: "abc", Status: 200}) },
+		"ReleaseResponse": func() error { return db.ReleaseResponse(canceled, "abc") },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s with a canceled context returned %v, want context.Canceled", name, err)
+		}
+	}
+
+	// Nothing was written.
+	data, err := db.ExportData(ctx)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	want := &stronk.UserData{Lifts: []*stronk.Lift{
+		{ID: id, Exercise: stronk.Squat, SetType: stronk.Main, Weight: lbs(200), SetNumber: 1, Reps: 5, ToFailure: true},
+	}}
+	if diff := cmp.Diff(want, data, cmpopts.IgnoreFields(stronk.Lift{}, "CreatedAt")); diff != "" {
+		t.Errorf("unexpected data after canceled calls (-want +got)\n%s", diff)
+	}
+}
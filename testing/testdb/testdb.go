@@ -1,67 +1,162 @@
 // Package testdb is an in-memory implementation of the server.DB interface.
+// It behaves the same as sqldb, which is checked by the shared tests in
+// testing/dbtest.
 package testdb
 
 import (
+	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/bcspragu/stronk"
 )
 
 func New() *DB {
-	return &DB{}
+	return &DB{
+		now: time.Now,
+		// Like sqldb, the main lifts always exist.
+		exercises: stronk.MainExercises(),
+		responses: make(map[string]*stronk.SavedResponse),
+	}
 }
 
 type DB struct {
+	now func() time.Time
+
+	// exercises are in the order they were created, which is the order
+	// TrainingMaxes returns them in.
+	exercises []stronk.Exercise
+
+	// lifts are in the order they were recorded, i.e. by ID. The other slices
+	// are kept sorted by timestamp, with ties broken by insertion order.
 	lifts          []*stronk.Lift
 	trainingMaxes  []*stronk.TrainingMax
-	smallestDenoms []stronk.Weight
+	smallestDenoms []*stronk.SmallestDenom
 	skippedWeeks   []stronk.SkippedWeek
+	achievements   []*stronk.Achievement
+
+	responses map[string]*stronk.SavedResponse
+}
+
+// SetClock overrides the function used to timestamp recorded lifts.
+func (db *DB) SetClock(now func() time.Time) {
+	db.now = now
+}
+
+// timestamp returns the current time at the precision our databases store.
+func (db *DB) timestamp() time.Time {
+	return db.now().UTC().Truncate(time.Second)
+}
+
+func (db *DB) addExercise(ex stronk.Exercise) {
+	for _, e := range db.exercises {
+		if e == ex {
+			return
+		}
+	}
+	db.exercises = append(db.exercises, ex)
 }
 
-func (db *DB) Lift(id stronk.LiftID) (*stronk.Lift, error) {
+func (db *DB) Lift(ctx context.Context, id stronk.LiftID) (*stronk.Lift, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	for _, l := range db.lifts {
 		if l.ID == id {
-			return l, nil
+			return copyLift(l), nil
 		}
 	}
 	return nil, fmt.Errorf("lift %d not found", id)
 }
 
-func (db *DB) EditLift(id stronk.LiftID, note string, reps int) error {
+func (db *DB) EditLift(ctx context.Context, id stronk.LiftID, note string, reps int, rpe float64, rir *int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	for _, l := range db.lifts {
 		if l.ID == id {
 			l.Note = note
 			l.Reps = reps
+			l.RPE = rpe
+			l.RIR = copyInt(rir)
 			return nil
 		}
 	}
 	return fmt.Errorf("lift %d not found", id)
 }
 
-func (db *DB) RecentLifts() ([]*stronk.Lift, error) {
-	lifts := make([]*stronk.Lift, len(db.lifts))
-	copy(lifts, db.lifts)
+func (db *DB) RecentLifts(ctx context.Context) ([]*stronk.Lift, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return db.recent(100, func(l *stronk.Lift) bool { return !l.IsHistorical() }), nil
+}
 
-	sort.Slice(lifts, func(i, j int) bool {
-		if lifts[i].IterationNumber != lifts[j].IterationNumber {
-			return lifts[i].IterationNumber > lifts[j].IterationNumber
+// recent returns up to limit lifts matching the filter, ordered from the
+// latest point in the routine to the earliest.
+func (db *DB) recent(limit int, filter func(*stronk.Lift) bool) []*stronk.Lift {
+	var lifts []*stronk.Lift
+	for _, l := range db.lifts {
+		if filter(l) {
+			lifts = append(lifts, copyLift(l))
 		}
+	}
+	sort.SliceStable(lifts, func(i, j int) bool { return newerInRoutine(lifts[i], lifts[j]) })
+	if len(lifts) > limit {
+		lifts = lifts[:limit]
+	}
+	return lifts
+}
 
-		if lifts[i].WeekNumber != lifts[j].WeekNumber {
-			return lifts[i].WeekNumber > lifts[j].WeekNumber
+// newerInRoutine orders lifts by where they fall in the routine, newest
+// first, falling back to when they were recorded.
+func newerInRoutine(a, b *stronk.Lift) bool {
+	if a.IterationNumber != b.IterationNumber {
+		return a.IterationNumber > b.IterationNumber
+	}
+	if a.WeekNumber != b.WeekNumber {
+		return a.WeekNumber > b.WeekNumber
+	}
+	if a.DayNumber != b.DayNumber {
+		return a.DayNumber > b.DayNumber
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+func (db *DB) LiftHistory(ctx context.Context, filter stronk.LiftFilter) ([]*stronk.Lift, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out []*stronk.Lift
+	for _, l := range db.lifts {
+		if filter.Matches(l) {
+			out = append(out, copyLift(l))
 		}
+	}
+	sortByCreation(out)
+	return out, nil
+}
 
-		if lifts[i].DayNumber != lifts[j].DayNumber {
-			return lifts[i].DayNumber > lifts[j].DayNumber
+// sortByCreation orders lifts oldest first. Imported lifts can be older than
+// ones recorded before them, so this isn't just the order of db.lifts.
+func sortByCreation(lifts []*stronk.Lift) {
+	sort.SliceStable(lifts, func(i, j int) bool {
+		if !lifts[i].CreatedAt.Equal(lifts[j].CreatedAt) {
+			return lifts[i].CreatedAt.Before(lifts[j].CreatedAt)
 		}
-		return lifts[i].ID > lifts[j].ID
+		return lifts[i].ID < lifts[j].ID
 	})
-
-	return lifts, nil
 }
 
-func (db *DB) RecordLift(ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool) (stronk.LiftID, error) {
+func (db *DB) RecordLift(ctx context.Context, ex stronk.Exercise, st stronk.SetType, weight stronk.Weight, set int, reps int, note string, day, week, iter int, toFailure bool, extra stronk.ExtraSet, rpe float64, rir *int) (stronk.LiftID, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	db.addExercise(ex)
 	id := stronk.LiftID(len(db.lifts) + 1)
 	db.lifts = append(db.lifts, &stronk.Lift{
 		ID:              id,
@@ -75,64 +170,317 @@ func (db *DB) RecordLift(ex stronk.Exercise, st stronk.SetType, weight stronk.We
 		IterationNumber: iter,
 		Note:            note,
 		ToFailure:       toFailure,
+		RPE:             rpe,
+		RIR:             copyInt(rir),
+		Extra:           extra,
+		CreatedAt:       db.timestamp(),
 	})
 	return id, nil
 }
 
-func (db *DB) SetTrainingMaxes(press, squat, bench, deadlift stronk.Weight) error {
+func (db *DB) SetTrainingMaxes(ctx context.Context, press, squat, bench, deadlift stronk.Weight) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := db.timestamp()
 	db.trainingMaxes = append(db.trainingMaxes,
-		&stronk.TrainingMax{Exercise: stronk.OverheadPress, Max: press},
-		&stronk.TrainingMax{Exercise: stronk.Squat, Max: squat},
-		&stronk.TrainingMax{Exercise: stronk.BenchPress, Max: bench},
-		&stronk.TrainingMax{Exercise: stronk.Deadlift, Max: deadlift},
+		&stronk.TrainingMax{Exercise: stronk.OverheadPress, Max: press, SetAt: now},
+		&stronk.TrainingMax{Exercise: stronk.Squat, Max: squat, SetAt: now},
+		&stronk.TrainingMax{Exercise: stronk.BenchPress, Max: bench, SetAt: now},
+		&stronk.TrainingMax{Exercise: stronk.Deadlift, Max: deadlift, SetAt: now},
 	)
+	sortTrainingMaxes(db.trainingMaxes)
 	return nil
 }
 
-func (db *DB) TrainingMaxes() ([]*stronk.TrainingMax, error) {
-	var (
-		out   []*stronk.TrainingMax
-		found = make(map[stronk.Exercise]bool)
-	)
-	tms := db.trainingMaxes
-	for i := len(tms) - 1; i >= 0; i-- {
-		tm := tms[i]
-		if found[tm.Exercise] {
-			continue
+func sortTrainingMaxes(tms []*stronk.TrainingMax) {
+	sort.SliceStable(tms, func(i, j int) bool { return tms[i].SetAt.Before(tms[j].SetAt) })
+}
+
+func (db *DB) TrainingMaxes(ctx context.Context) ([]*stronk.TrainingMax, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	latest := make(map[stronk.Exercise]*stronk.TrainingMax)
+	for _, tm := range db.trainingMaxes {
+		// Sorted oldest first, so later entries win.
+		latest[tm.Exercise] = tm
+	}
+
+	var out []*stronk.TrainingMax
+	for _, ex := range db.exercises {
+		if tm, ok := latest[ex]; ok {
+			cp := *tm
+			out = append(out, &cp)
 		}
-		out = append(out, tm)
-		found[tm.Exercise] = true
 	}
+	return out, nil
+}
 
+func (db *DB) TrainingMaxHistory(ctx context.Context) ([]*stronk.TrainingMax, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out []*stronk.TrainingMax
+	for _, tm := range db.trainingMaxes {
+		cp := *tm
+		out = append(out, &cp)
+	}
 	return out, nil
 }
 
-func (db *DB) SetSmallestDenom(small stronk.Weight) error {
-	db.smallestDenoms = append(db.smallestDenoms, small)
+func (db *DB) SetSmallestDenom(ctx context.Context, small stronk.Weight) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.smallestDenoms = append(db.smallestDenoms, &stronk.SmallestDenom{
+		Weight: small,
+		SetAt:  db.timestamp(),
+	})
+	sortSmallestDenoms(db.smallestDenoms)
 	return nil
 }
 
-func (db *DB) SmallestDenom() (stronk.Weight, error) {
+func sortSmallestDenoms(sds []*stronk.SmallestDenom) {
+	sort.SliceStable(sds, func(i, j int) bool { return sds[i].SetAt.Before(sds[j].SetAt) })
+}
+
+func (db *DB) SmallestDenom(ctx context.Context) (stronk.Weight, error) {
+	if err := ctx.Err(); err != nil {
+		return stronk.Weight{}, err
+	}
 	denoms := db.smallestDenoms
 	if len(denoms) == 0 {
 		return stronk.Weight{}, stronk.ErrNoSmallestDenom
 	}
-	return denoms[len(denoms)-1], nil
+	return denoms[len(denoms)-1].Weight, nil
 }
 
-func (db *DB) ComparableLifts(ex stronk.Exercise, weight stronk.Weight) (*stronk.ComparableLifts, error) {
-	return &stronk.ComparableLifts{}, nil
+// failureSets returns the best to-failure lift at each weight for an exercise,
+// most recent first, see stronk.WorkoutContext.FailureSets.
+func (db *DB) failureSets(ex stronk.Exercise) []*stronk.Lift {
+	lifts := db.recent(len(db.lifts), func(l *stronk.Lift) bool {
+		return l.Exercise == ex && l.ToFailure
+	})
+	best := make(map[stronk.Weight]*stronk.Lift)
+	for _, l := range lifts {
+		// Ties go to the most recent lift, which comes first.
+		if b, ok := best[l.Weight]; !ok || l.AsRPEOneRepMax().Value > b.AsRPEOneRepMax().Value {
+			best[l.Weight] = l
+		}
+	}
+	var out []*stronk.Lift
+	for _, l := range lifts {
+		if best[l.Weight] == l {
+			out = append(out, l)
+		}
+	}
+	return out
 }
 
-func (db *DB) RecentFailureSets() ([]*stronk.Lift, error) {
-	return []*stronk.Lift{}, nil
+func (db *DB) WorkoutContext(ctx context.Context, exs []stronk.Exercise) (*stronk.WorkoutContext, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var (
+		wc  = &stronk.WorkoutContext{FailureSets: make(map[stronk.Exercise][]*stronk.Lift)}
+		err error
+	)
+	if wc.RecentLifts, err = db.RecentLifts(ctx); err != nil {
+		return nil, err
+	}
+	if wc.SkippedWeeks, err = db.SkippedWeeks(ctx); err != nil {
+		return nil, err
+	}
+	if wc.TrainingMaxes, err = db.TrainingMaxes(ctx); err != nil {
+		return nil, err
+	}
+	if wc.SmallestDenom, err = db.SmallestDenom(ctx); err != nil {
+		return nil, err
+	}
+	for _, ex := range exs {
+		if lfs := db.failureSets(ex); len(lfs) > 0 {
+			wc.FailureSets[ex] = lfs
+		}
+	}
+	return wc, nil
 }
 
-func (db *DB) SkippedWeeks() ([]stronk.SkippedWeek, error) {
-	return db.skippedWeeks, nil
+func (db *DB) RecordNextLift(ctx context.Context, l *stronk.Lift, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error, achieve func(stronk.LiftID, []*stronk.Lift) []*stronk.Achievement) (stronk.LiftID, *stronk.WorkoutContext, error) {
+	before, err := db.WorkoutContext(ctx, exs)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := check(before); err != nil {
+		return 0, nil, err
+	}
+	id, err := db.RecordLift(ctx, l.Exercise, l.SetType, l.Weight, l.SetNumber, l.Reps, l.Note, l.DayNumber, l.WeekNumber, l.IterationNumber, l.ToFailure, l.Extra, l.RPE, l.RIR)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !l.CreatedAt.IsZero() {
+		db.lifts[id-1].CreatedAt = l.CreatedAt.UTC().Truncate(time.Second)
+	}
+	if achieve != nil {
+		history, err := db.LiftHistory(ctx, stronk.LiftFilter{Exercise: l.Exercise})
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := db.RecordAchievements(ctx, achieve(id, history)); err != nil {
+			return 0, nil, err
+		}
+	}
+	wc, err := db.WorkoutContext(ctx, exs)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, wc, nil
 }
 
-func (db *DB) SkipWeek(note string, week, iter int) error {
+func (db *DB) SavedResponse(ctx context.Context, key string) (*stronk.SavedResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, ok := db.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	return copyResponse(r), nil
+}
+
+func (db *DB) ReserveResponse(ctx context.Context, resp *stronk.SavedResponse, abandonBefore, expireBefore time.Time) (*stronk.SavedResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Like sqldb, expiry is at the precision timestamps are stored at.
+	expireBefore = expireBefore.UTC().Truncate(time.Second)
+	abandonBefore = abandonBefore.UTC().Truncate(time.Second)
+	for key, r := range db.responses {
+		if r.CreatedAt.Before(expireBefore) || (r.Status == 0 && r.CreatedAt.Before(abandonBefore)) {
+			delete(db.responses, key)
+		}
+	}
+	if r, ok := db.responses[resp.Key]; ok {
+		return copyResponse(r), nil
+	}
+	db.responses[resp.Key] = &stronk.SavedResponse{
+		Key:         resp.Key,
+		Path:        resp.Path,
+		RequestHash: resp.RequestHash,
+		CreatedAt:   db.timestamp(),
+	}
+	return nil, nil
+}
+
+func (db *DB) SaveResponse(ctx context.Context, resp *stronk.SavedResponse) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r, ok := db.responses[resp.Key]
+	if !ok || r.Status != 0 {
+		return fmt.Errorf("idempotency key %q isn't reserved", resp.Key)
+	}
+	r.Status = resp.Status
+	r.Body = append([]byte(nil), resp.Body...)
+	return nil
+}
+
+func (db *DB) ReleaseResponse(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r, ok := db.responses[key]; ok && r.Status == 0 {
+		delete(db.responses, key)
+	}
+	return nil
+}
+
+func copyResponse(r *stronk.SavedResponse) *stronk.SavedResponse {
+	cp := *r
+	cp.Body = append([]byte(nil), r.Body...)
+	return &cp
+}
+
+func (db *DB) RecentFailureSets(ctx context.Context) ([]*stronk.Lift, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return db.recent(250, func(l *stronk.Lift) bool {
+		return l.SetType == stronk.Main && l.ToFailure && l.Extra == "" && !l.IsHistorical()
+	}), nil
+}
+
+func (db *DB) RecordAchievements(ctx context.Context, achs []*stronk.Achievement) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, a := range achs {
+		cp := *a
+		db.achievements = append(db.achievements, &cp)
+	}
+	return nil
+}
+
+func (db *DB) Achievements(ctx context.Context, ex stronk.Exercise) ([]*stronk.Achievement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	lifts := make(map[stronk.LiftID]*stronk.Lift)
+	for _, l := range db.lifts {
+		lifts[l.ID] = l
+	}
+
+	var out []*stronk.Achievement
+	for _, a := range db.achievements {
+		// Like sqldb, the exercise and timestamp come from the lift itself.
+		l, ok := lifts[a.LiftID]
+		if !ok {
+			continue
+		}
+		if ex != "" && l.Exercise != ex {
+			continue
+		}
+		cp := *a
+		cp.Exercise = l.Exercise
+		cp.AchievedAt = l.CreatedAt
+		out = append(out, &cp)
+	}
+	// Newest lifts first, but keep achievements for the same lift in the order
+	// they were recorded.
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].AchievedAt.Equal(out[j].AchievedAt) {
+			return out[i].AchievedAt.After(out[j].AchievedAt)
+		}
+		return out[i].LiftID > out[j].LiftID
+	})
+	return out, nil
+}
+
+func (db *DB) SkippedWeeks(ctx context.Context) ([]stronk.SkippedWeek, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out []stronk.SkippedWeek
+	// Walk backwards so that ties go to the most recently skipped.
+	for i := len(db.skippedWeeks) - 1; i >= 0; i-- {
+		out = append(out, db.skippedWeeks[i])
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Iteration != out[j].Iteration {
+			return out[i].Iteration > out[j].Iteration
+		}
+		return out[i].Week > out[j].Week
+	})
+	if len(out) > 100 {
+		out = out[:100]
+	}
+	return out, nil
+}
+
+func (db *DB) SkipWeek(ctx context.Context, note string, week, iter int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	db.skippedWeeks = append(db.skippedWeeks, stronk.SkippedWeek{
 		Week:      week,
 		Iteration: iter,
@@ -140,3 +488,149 @@ func (db *DB) SkipWeek(note string, week, iter int) error {
 	})
 	return nil
 }
+
+func (db *DB) SkipNextWeek(ctx context.Context, note string, week, iter int, exs []stronk.Exercise, check func(*stronk.WorkoutContext) error) (*stronk.WorkoutContext, error) {
+	before, err := db.WorkoutContext(ctx, exs)
+	if err != nil {
+		return nil, err
+	}
+	if err := check(before); err != nil {
+		return nil, err
+	}
+	if err := db.SkipWeek(ctx, note, week, iter); err != nil {
+		return nil, err
+	}
+	return db.WorkoutContext(ctx, exs)
+}
+
+func (db *DB) ExportData(ctx context.Context) (*stronk.UserData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data := &stronk.UserData{}
+	for _, l := range db.lifts {
+		data.Lifts = append(data.Lifts, copyLift(l))
+	}
+	sortByCreation(data.Lifts)
+	for _, tm := range db.trainingMaxes {
+		cp := *tm
+		data.TrainingMaxes = append(data.TrainingMaxes, &cp)
+	}
+	for _, sd := range db.smallestDenoms {
+		cp := *sd
+		data.SmallestDenoms = append(data.SmallestDenoms, &cp)
+	}
+	data.SkippedWeeks = append(data.SkippedWeeks, db.skippedWeeks...)
+	return data, nil
+}
+
+func (db *DB) ImportData(ctx context.Context, data *stronk.UserData) (*stronk.ImportResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res := &stronk.ImportResult{}
+
+	for _, l := range data.Lifts {
+		db.addExercise(l.Exercise)
+		if db.hasLift(l) {
+			res.Duplicates++
+			continue
+		}
+		cp := copyLift(l)
+		cp.ID = stronk.LiftID(len(db.lifts) + 1)
+		cp.CreatedAt = l.CreatedAt.UTC().Truncate(time.Second)
+		db.lifts = append(db.lifts, cp)
+		res.Lifts++
+	}
+
+	for _, tm := range data.TrainingMaxes {
+		db.addExercise(tm.Exercise)
+		dup := false
+		for _, existing := range db.trainingMaxes {
+			if existing.Exercise == tm.Exercise && existing.Max == tm.Max && existing.SetAt.Equal(tm.SetAt.Truncate(time.Second)) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			res.Duplicates++
+			continue
+		}
+		cp := *tm
+		cp.SetAt = tm.SetAt.UTC().Truncate(time.Second)
+		db.trainingMaxes = append(db.trainingMaxes, &cp)
+		res.TrainingMaxes++
+	}
+	sortTrainingMaxes(db.trainingMaxes)
+
+	for _, sd := range data.SmallestDenoms {
+		dup := false
+		for _, existing := range db.smallestDenoms {
+			if existing.Weight == sd.Weight && existing.SetAt.Equal(sd.SetAt.Truncate(time.Second)) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			res.Duplicates++
+			continue
+		}
+		cp := *sd
+		cp.SetAt = sd.SetAt.UTC().Truncate(time.Second)
+		db.smallestDenoms = append(db.smallestDenoms, &cp)
+		res.SmallestDenoms++
+	}
+	sortSmallestDenoms(db.smallestDenoms)
+
+	for _, wk := range data.SkippedWeeks {
+		dup := false
+		for _, existing := range db.skippedWeeks {
+			if existing.Week == wk.Week && existing.Iteration == wk.Iteration {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			res.Duplicates++
+			continue
+		}
+		db.skippedWeeks = append(db.skippedWeeks, wk)
+		res.SkippedWeeks++
+	}
+
+	return res, nil
+}
+
+// hasLift reports whether an equivalent lift, ignoring its ID, was already
+// recorded.
+func (db *DB) hasLift(l *stronk.Lift) bool {
+	for _, existing := range db.lifts {
+		if existing.Exercise == l.Exercise &&
+			existing.SetType == l.SetType &&
+			existing.SetNumber == l.SetNumber &&
+			existing.DayNumber == l.DayNumber &&
+			existing.WeekNumber == l.WeekNumber &&
+			existing.IterationNumber == l.IterationNumber &&
+			existing.Extra == l.Extra &&
+			existing.CreatedAt.Equal(l.CreatedAt.Truncate(time.Second)) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyLift returns a deep copy, so that callers can't modify stored lifts,
+// same as with a real database.
+func copyLift(l *stronk.Lift) *stronk.Lift {
+	cp := *l
+	cp.RIR = copyInt(l.RIR)
+	return &cp
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	cp := *v
+	return &cp
+}
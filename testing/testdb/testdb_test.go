@@ -0,0 +1,14 @@
+package testdb
+
+import (
+	"testing"
+
+	"github.com/bcspragu/stronk/server"
+	"github.com/bcspragu/stronk/testing/dbtest"
+)
+
+func TestDB(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) server.DB {
+		return New()
+	})
+}